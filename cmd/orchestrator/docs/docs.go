@@ -118,6 +118,152 @@ const docTemplate = `{
                     }
                 }
             }
+        },
+        "/explain": {
+            "get": {
+                "description": "Evaluates the cost centre rules sent to Finout locally and returns the matching rule chain",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "explain"
+                ],
+                "summary": "Explain how an AWS account or capability maps to a cost centre",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "AWS account id or alias",
+                        "name": "awsAccount",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Capability id or root id",
+                        "name": "capability",
+                        "in": "query"
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK"
+                    },
+                    "400": {
+                        "description": "Bad Request"
+                    },
+                    "404": {
+                        "description": "Not Found"
+                    },
+                    "500": {
+                        "description": "Internal Server Error"
+                    }
+                }
+            }
+        },
+        "/finout/virtualtag/export": {
+            "get": {
+                "description": "Converts the AWS account rules of the live Finout virtual tag into mapping.json entries and lists the rules that can't be represented",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "finout"
+                ],
+                "summary": "Export the live cost centre virtual tag in the mapping file format",
+                "parameters": [
+                    {
+                        "type": "boolean",
+                        "description": "Merge with the current mapping file",
+                        "name": "merge",
+                        "in": "query"
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK"
+                    },
+                    "400": {
+                        "description": "Bad Request"
+                    },
+                    "404": {
+                        "description": "Not Found"
+                    },
+                    "500": {
+                        "description": "Internal Server Error"
+                    }
+                }
+            }
+        },
+        "/report/departments": {
+            "get": {
+                "description": "Aggregates the members of each capability group by department and job title, and flags capabilities whose members mostly belong to a department with a different cost centre",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "report"
+                ],
+                "summary": "Get a report of capability members by Azure AD department and job title",
+                "responses": {
+                    "200": {
+                        "description": "OK"
+                    },
+                    "500": {
+                        "description": "Internal Server Error"
+                    }
+                }
+            }
+        },
+        "/report/disabled-members": {
+            "get": {
+                "description": "Lists the capability members that the last CapSvc2Azure run skipped because their directory account is disabled or doesn't exist, so they can be removed from the capability",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "report"
+                ],
+                "summary": "Get a report of capability members with a disabled or missing Azure AD account",
+                "responses": {
+                    "200": {
+                        "description": "OK"
+                    },
+                    "404": {
+                        "description": "Not Found"
+                    }
+                }
+            }
+        },
+        "/report/untagged": {
+            "get": {
+                "description": "Lists the AWS accounts contributing to the Untagged cost centre in Finout, with a suggestion for the likely missing mapping",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "report"
+                ],
+                "summary": "Get a report of untagged spend per AWS account",
+                "parameters": [
+                    {
+                        "type": "integer",
+                        "default": 30,
+                        "description": "Number of days to report on",
+                        "name": "days",
+                        "in": "query"
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK"
+                    },
+                    "400": {
+                        "description": "Bad Request"
+                    },
+                    "500": {
+                        "description": "Internal Server Error"
+                    }
+                }
+            }
         }
     }
 }`
@@ -7,6 +7,7 @@ import (
 	"net/http"
 	"os"
 	"os/signal"
+	"strconv"
 	"sync"
 	"syscall"
 	"time"
@@ -23,6 +24,7 @@ import (
 
 	"github.com/gin-gonic/gin"
 	"github.com/go-co-op/gocron"
+	"github.com/joomcode/errorx"
 	"github.com/prometheus/client_golang/prometheus/promhttp"
 	swaggerFiles "github.com/swaggo/files"
 	ginSwagger "github.com/swaggo/gin-swagger"
@@ -30,7 +32,6 @@ import (
 )
 
 const TIME_FORMAT = "2006-01-02 15:04:05.999999999 -0700 MST"
-const CAPABILITY_GROUP_PREFIX = "CI_SSU_Cap -"
 
 func metricsHandler() gin.HandlerFunc {
 	h := promhttp.Handler()
@@ -140,6 +141,137 @@ func runCapSvc2Azure(c *gin.Context) {
 	}
 }
 
+// UntaggedSpendReport             godoc
+// @Summary      Get a report of untagged spend per AWS account
+// @Description  Lists the AWS accounts contributing to the Untagged cost centre in Finout, with a suggestion for the likely missing mapping
+// @Tags         report
+// @Produce      json
+// @Param        days query int false "Number of days to report on" default(30)
+// @Success      200
+// @Failure      400
+// @Failure      500
+// @Router       /report/untagged [get]
+func getUntaggedSpendReport(c *gin.Context) {
+	days, err := strconv.Atoi(c.DefaultQuery("days", "30"))
+	if err != nil || days < 1 {
+		c.IndentedJSON(http.StatusBadRequest, gin.H{"message": "days must be a positive integer"})
+		return
+	}
+
+	to := time.Now()
+	report, err := handler.BuildUntaggedSpendReport(c.Request.Context(), to.AddDate(0, 0, -days), to)
+	if err != nil {
+		util.Logger.Error("Unable to build untagged spend report", zap.Error(err))
+		c.IndentedJSON(http.StatusInternalServerError, gin.H{"message": err.Error()})
+		return
+	}
+
+	c.IndentedJSON(http.StatusOK, report)
+}
+
+// DisabledMembersReport             godoc
+// @Summary      Get a report of capability members with a disabled or missing Azure AD account
+// @Description  Lists the capability members that the last CapSvc2Azure run skipped because their directory account is disabled or doesn't exist, so they can be removed from the capability
+// @Tags         report
+// @Produce      json
+// @Success      200
+// @Failure      404
+// @Router       /report/disabled-members [get]
+func getDisabledMembersReport(c *gin.Context) {
+	report, ok := handler.GetDisabledMembersReport()
+	if !ok {
+		c.IndentedJSON(http.StatusNotFound, gin.H{"message": "capSvcToAad job has not completed yet"})
+		return
+	}
+
+	c.IndentedJSON(http.StatusOK, report)
+}
+
+// DepartmentAttributionReport             godoc
+// @Summary      Get a report of capability members by Azure AD department and job title
+// @Description  Aggregates the members of each capability group by department and job title, and flags capabilities whose members mostly belong to a department with a different cost centre
+// @Tags         report
+// @Produce      json
+// @Success      200
+// @Failure      500
+// @Router       /report/departments [get]
+func getDepartmentAttributionReport(c *gin.Context) {
+	report, err := handler.BuildDepartmentAttributionReport(c.Request.Context())
+	if err != nil {
+		util.Logger.Error("Unable to build department attribution report", zap.Error(err))
+		c.IndentedJSON(http.StatusInternalServerError, gin.H{"message": err.Error()})
+		return
+	}
+
+	c.IndentedJSON(http.StatusOK, report)
+}
+
+// ExplainCostCentre             godoc
+// @Summary      Explain how an AWS account or capability maps to a cost centre
+// @Description  Evaluates the cost centre rules sent to Finout locally and returns the matching rule chain
+// @Tags         explain
+// @Produce      json
+// @Param        awsAccount query string false "AWS account id or alias"
+// @Param        capability query string false "Capability id or root id"
+// @Success      200
+// @Failure      400
+// @Failure      404
+// @Failure      500
+// @Router       /explain [get]
+func getExplainCostCentre(c *gin.Context) {
+	explanation, err := handler.ExplainCostCentre(c.Request.Context(), c.Query("awsAccount"), c.Query("capability"))
+	if err != nil {
+		switch {
+		case errorx.IsOfType(err, handler.InvalidInput):
+			c.IndentedJSON(http.StatusBadRequest, gin.H{"message": err.Error()})
+		case errorx.IsOfType(err, handler.NotFound):
+			c.IndentedJSON(http.StatusNotFound, gin.H{"message": err.Error()})
+		default:
+			util.Logger.Error("Unable to explain cost centre", zap.Error(err))
+			c.IndentedJSON(http.StatusInternalServerError, gin.H{"message": err.Error()})
+		}
+		return
+	}
+
+	c.IndentedJSON(http.StatusOK, explanation)
+}
+
+// ExportVirtualTag             godoc
+// @Summary      Export the live cost centre virtual tag in the mapping file format
+// @Description  Converts the AWS account rules of the live Finout virtual tag into mapping.json entries and lists the rules that can't be represented
+// @Tags         finout
+// @Produce      json
+// @Param        merge query bool false "Merge with the current mapping file"
+// @Success      200
+// @Failure      400
+// @Failure      404
+// @Failure      500
+// @Router       /finout/virtualtag/export [get]
+func getExportVirtualTag(c *gin.Context) {
+	merge := false
+	if val := c.Query("merge"); val != "" {
+		parsed, err := strconv.ParseBool(val)
+		if err != nil {
+			c.IndentedJSON(http.StatusBadRequest, gin.H{"message": "merge must be a boolean"})
+			return
+		}
+		merge = parsed
+	}
+
+	export, err := handler.ExportCostCentreVirtualTag(c.Request.Context(), merge)
+	if err != nil {
+		if errorx.IsOfType(err, handler.NotFound) {
+			c.IndentedJSON(http.StatusNotFound, gin.H{"message": err.Error()})
+			return
+		}
+		util.Logger.Error("Unable to export virtual tag", zap.Error(err))
+		c.IndentedJSON(http.StatusInternalServerError, gin.H{"message": err.Error()})
+		return
+	}
+
+	c.IndentedJSON(http.StatusOK, export)
+}
+
 // main
 // Sets up:
 // - Prometheus metrics
@@ -171,6 +303,10 @@ func main() {
 	configPrefix := "AFS_SCHEDULER_JOB"
 	orc.AddJob(configPrefix, orchestrator.NewJob("aadToFinout", handler.Azure2FinoutHandler), &orchestrator.Schedule{})
 	orc.AddJob(configPrefix, orchestrator.NewJob("costCentreToFinout", handler.CostCentre2FinoutHandler), &orchestrator.Schedule{})
+	orc.AddJob(configPrefix, orchestrator.NewJob(handler.UntaggedSpendReportName, handler.UntaggedSpendReportHandler), &orchestrator.Schedule{})
+	orc.AddJob(configPrefix, orchestrator.NewJob(handler.CostDigestName, handler.CostDigestHandler), &orchestrator.Schedule{})
+	orc.AddJob(configPrefix, orchestrator.NewJob(handler.CostMetricsName, handler.CostMetricsHandler), &orchestrator.Schedule{})
+	orc.AddJob(configPrefix, orchestrator.NewJob(handler.AppCredentialExpiryName, handler.AppCredentialExpiryHandler), &orchestrator.Schedule{})
 
 	// Orchestrator goroutine; Handles scheduling jobs
 	orc.Run()
@@ -192,6 +328,11 @@ func main() {
 		v1.POST("/awsmapping", runAwsMapping)
 		v1.POST("/aws2k8s", runAws2K8s)
 		v1.POST("/capsvc2azure", runCapSvc2Azure)
+		v1.GET("/report/untagged", getUntaggedSpendReport)
+		v1.GET("/report/disabled-members", getDisabledMembersReport)
+		v1.GET("/report/departments", getDepartmentAttributionReport)
+		v1.GET("/explain", getExplainCostCentre)
+		v1.GET("/finout/virtualtag/export", getExportVirtualTag)
 		v1.GET("/mgmt/shutdown", func(c *gin.Context) {
 			go func() {
 				time.Sleep(time.Second * 2)
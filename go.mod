@@ -1,6 +1,6 @@
 module go.dfds.cloud/aad-finout-sync
 
-go 1.19
+go 1.21
 
 //replace go.dfds.cloud/orchestrator v1.0.0 => /Users/sequoiia/projects/dfds/go/orchestrator
 
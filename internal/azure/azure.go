@@ -24,9 +24,37 @@ type Client struct {
 }
 
 type Config struct {
-	TenantId     string `json:"tenantId"`
-	ClientId     string `json:"clientId"`
-	ClientSecret string `json:"clientSecret"`
+	TenantId      string `json:"tenantId"`
+	ClientId      string `json:"clientId"`
+	ClientSecret  string `json:"clientSecret"`
+	GraphEndpoint string `json:"graphEndpoint"`
+	LoginEndpoint string `json:"loginEndpoint"`
+	// AuthMethod is one of util.ClientAuthSecret (default), util.ClientAuthCertificate or util.ClientAuthFederated.
+	AuthMethod         string `json:"authMethod"`
+	CertificatePath    string `json:"certificatePath"`
+	PrivateKeyPath     string `json:"privateKeyPath"`
+	FederatedTokenFile string `json:"federatedTokenFile"`
+}
+
+const DefaultGraphEndpoint = "https://graph.microsoft.com"
+const DefaultLoginEndpoint = "https://login.microsoftonline.com"
+
+// graphUrl formats path and appends it to the configured Microsoft Graph endpoint.
+func (c *Client) graphUrl(path string, a ...interface{}) string {
+	endpoint := c.config.GraphEndpoint
+	if endpoint == "" {
+		endpoint = DefaultGraphEndpoint
+	}
+
+	return strings.TrimSuffix(endpoint, "/") + fmt.Sprintf(path, a...)
+}
+
+func (c *Client) loginEndpoint() string {
+	if c.config.LoginEndpoint == "" {
+		return DefaultLoginEndpoint
+	}
+
+	return strings.TrimSuffix(c.config.LoginEndpoint, "/")
 }
 
 func (c *Client) RefreshAuth() error {
@@ -41,13 +69,24 @@ func (c *Client) RefreshAuth() error {
 }
 
 func (c *Client) getNewToken() (*util.RefreshAuthResponse, error) {
+	tokenEndpoint := fmt.Sprintf("%s/%s/oauth2/v2.0/token", c.loginEndpoint(), c.config.TenantId)
+
 	reqPayload := url.Values{}
-	reqPayload.Set("client_id", c.config.ClientId)
 	reqPayload.Set("grant_type", "client_credentials")
-	reqPayload.Set("scope", "https://graph.microsoft.com/.default")
-	reqPayload.Set("client_secret", c.config.ClientSecret)
+	reqPayload.Set("scope", c.graphUrl("/.default"))
+	err := util.ClientCredentials{
+		Method:             c.config.AuthMethod,
+		ClientId:           c.config.ClientId,
+		ClientSecret:       c.config.ClientSecret,
+		CertificatePath:    c.config.CertificatePath,
+		PrivateKeyPath:     c.config.PrivateKeyPath,
+		FederatedTokenFile: c.config.FederatedTokenFile,
+	}.SetFormValues(reqPayload, tokenEndpoint)
+	if err != nil {
+		return nil, err
+	}
 
-	req, err := http.NewRequest("POST", fmt.Sprintf("https://login.microsoftonline.com/%s/oauth2/v2.0/token", c.config.TenantId), strings.NewReader(reqPayload.Encode()))
+	req, err := http.NewRequest("POST", tokenEndpoint, strings.NewReader(reqPayload.Encode()))
 	if err != nil {
 		return nil, err
 	}
@@ -59,13 +98,15 @@ func (c *Client) getNewToken() (*util.RefreshAuthResponse, error) {
 		return nil, err
 	}
 
+	defer resp.Body.Close()
+
 	rawData, err := io.ReadAll(resp.Body)
 	if err != nil {
 		return nil, err
 	}
 
 	if resp.StatusCode != 200 {
-		return nil, err
+		return nil, fmt.Errorf("response returned unexpected status code: %d", resp.StatusCode)
 	}
 
 	var tokenResponse *util.RefreshAuthResponse
@@ -103,95 +144,54 @@ func (c *Client) HasTokenExpired() bool {
 	return c.tokenClient.Token.IsExpired()
 }
 
-func (c *Client) GetGroups(prefix string) (*GroupsListResponse, error) {
-	req, err := http.NewRequest("GET", "https://graph.microsoft.com/v1.0/groups", nil)
-	if err != nil {
-		return nil, err
-	}
-	err = c.prepareHttpRequest(req)
-	if err != nil {
-		return nil, err
-	}
-
-	urlQueryValues := req.URL.Query()
-	urlQueryValues.Set("$filter", fmt.Sprintf("startswith(displayName,'%s')", prefix))
-	req.URL.RawQuery = urlQueryValues.Encode()
+// ListGroups returns a pager over all groups in the directory.
+func (c *Client) ListGroups(options *QueryOptions) *Pager[GroupsListResponseGroup] {
+	return newPager[GroupsListResponseGroup](c, c.graphUrl("/v1.0/groups"), options)
+}
 
-	resp, err := c.httpClient.Do(req)
+func (c *Client) GetGroups(ctx context.Context, prefix string) (*GroupsListResponse, error) {
+	groups, err := c.ListGroups(&QueryOptions{Filter: fmt.Sprintf("startswith(displayName,'%s')", prefix)}).All(ctx)
 	if err != nil {
 		return nil, err
 	}
 
-	defer resp.Body.Close()
+	return &GroupsListResponse{Value: groups}, nil
+}
 
-	rawData, err := io.ReadAll(resp.Body)
+func (c *Client) ListAdministrativeUnits(options *QueryOptions) *Pager[*GetAdministrativeUnitsResponseUnit] {
+	return newPager[*GetAdministrativeUnitsResponseUnit](c, c.graphUrl("/v1.0/directory/administrativeUnits"), options)
+}
+
+// GetAdministrativeUnits returns the administrative units with the given display name.
+func (c *Client) GetAdministrativeUnits(ctx context.Context, name string) (*GetAdministrativeUnitsResponse, error) {
+	aUnits, err := c.ListAdministrativeUnits(&QueryOptions{Filter: fmt.Sprintf("displayName eq '%s'", strings.ReplaceAll(name, "'", "''"))}).All(ctx)
 	if err != nil {
 		return nil, err
 	}
 
-	var payload *GroupsListResponse
+	return &GetAdministrativeUnitsResponse{Value: aUnits}, nil
+}
 
-	err = json.Unmarshal(rawData, &payload)
+func (c *Client) CreateAdministrativeUnitGroup(ctx context.Context, requestPayload CreateAdministrativeUnitGroupRequest) (*CreateAdministrativeUnitGroupResponse, error) {
+	serialised, err := json.Marshal(requestPayload)
 	if err != nil {
 		return nil, err
 	}
 
-	nextLink := payload.OdataNextLink
-
-	for nextLink != "" {
-		req, err := http.NewRequest("GET", nextLink, nil)
-		if err != nil {
-			return nil, err
-		}
-		err = c.prepareHttpRequest(req)
-		if err != nil {
-			return nil, err
-		}
-
-		resp, err := c.httpClient.Do(req)
-		if err != nil {
-			return nil, err
-		}
-
-		rawData, err := io.ReadAll(resp.Body)
-		if err != nil {
-			return nil, err
-		}
-
-		var buffer *GroupsListResponse
-
-		err = json.Unmarshal(rawData, &buffer)
-		if err != nil {
-			return nil, err
-		}
-
-		nextLink = buffer.OdataNextLink
-
-		payload.Value = append(payload.Value, buffer.Value...)
-	}
-
-	return payload, nil
-}
-
-func (c *Client) GetAdministrativeUnits() (*GetAdministrativeUnitsResponse, error) {
-	req, err := http.NewRequest("GET", "https://graph.microsoft.com/v1.0/directory/administrativeUnits", nil)
+	req, err := http.NewRequestWithContext(ctx, "POST",
+		c.graphUrl("/v1.0/directory/administrativeUnits/%s/members", requestPayload.ParentAdministrativeUnitId), bytes.NewBuffer(serialised))
 	if err != nil {
 		return nil, err
 	}
-	err = c.prepareHttpRequest(req)
+	err = c.prepareJsonRequest(req)
 	if err != nil {
 		return nil, err
 	}
 
-	urlQueryValues := req.URL.Query()
-	urlQueryValues.Set("$filter", "startswith(displayName,'Team - Cloud Engineering')")
-	req.URL.RawQuery = urlQueryValues.Encode()
-
 	resp, err := c.httpClient.Do(req)
 	if err != nil {
 		return nil, err
 	}
-
 	defer resp.Body.Close()
 
 	rawData, err := io.ReadAll(resp.Body)
@@ -199,59 +199,51 @@ func (c *Client) GetAdministrativeUnits() (*GetAdministrativeUnitsResponse, erro
 		return nil, err
 	}
 
-	var payload *GetAdministrativeUnitsResponse
+	if resp.StatusCode != http.StatusCreated {
+		return nil, ApiError{resp.StatusCode}
+	}
 
+	var payload CreateAdministrativeUnitGroupResponse
 	err = json.Unmarshal(rawData, &payload)
 	if err != nil {
 		return nil, err
 	}
 
-	return payload, nil
+	return &payload, nil
 }
 
-func (c *Client) CreateAdministrativeUnitGroup(ctx context.Context, requestPayload CreateAdministrativeUnitGroupRequest) (*CreateAdministrativeUnitGroupResponse, error) {
+// UpdateGroup updates the properties of a group that are set in requestPayload.
+func (c *Client) UpdateGroup(ctx context.Context, id string, requestPayload UpdateGroupRequest) error {
 	serialised, err := json.Marshal(requestPayload)
 	if err != nil {
-		return nil, err
+		return err
 	}
 
-	req, err := http.NewRequestWithContext(ctx, "POST",
-		fmt.Sprintf("https://graph.microsoft.com/v1.0/directory/administrativeUnits/%s/members",
-			requestPayload.ParentAdministrativeUnitId), bytes.NewBuffer(serialised))
+	req, err := http.NewRequestWithContext(ctx, "PATCH", c.graphUrl("/v1.0/groups/%s", id), bytes.NewBuffer(serialised))
 	if err != nil {
-		return nil, err
+		return err
 	}
 	err = c.prepareJsonRequest(req)
 	if err != nil {
-		return nil, err
+		return err
 	}
 
 	resp, err := c.httpClient.Do(req)
 	if err != nil {
-		return nil, err
-	}
-	defer resp.Body.Close()
-
-	rawData, err := io.ReadAll(resp.Body)
-	if err != nil {
-		return nil, err
+		return err
 	}
 
-	if resp.StatusCode != http.StatusCreated {
-		return nil, ApiError{resp.StatusCode}
-	}
+	defer resp.Body.Close()
 
-	var payload CreateAdministrativeUnitGroupResponse
-	err = json.Unmarshal(rawData, &payload)
-	if err != nil {
-		return nil, err
+	if resp.StatusCode != http.StatusNoContent {
+		return HttpError.Wrap(ApiError{resp.StatusCode}, fmt.Sprintf("Unexpected HTTP response when updating group %s. Status code: %d", id, resp.StatusCode))
 	}
 
-	return &payload, nil
+	return nil
 }
 
-func (c *Client) DeleteAdministrativeUnitGroup(aUnitId string, groupId string) error {
-	req, err := http.NewRequest("DELETE", fmt.Sprintf("https://graph.microsoft.com/v1.0/directory/administrativeUnits/%s/members/%s", aUnitId, groupId), nil)
+func (c *Client) DeleteAdministrativeUnitGroup(ctx context.Context, aUnitId string, groupId string) error {
+	req, err := http.NewRequestWithContext(ctx, "DELETE", c.graphUrl("/v1.0/directory/administrativeUnits/%s/members/%s", aUnitId, groupId), nil)
 	if err != nil {
 		return err
 	}
@@ -276,7 +268,7 @@ func (c *Client) DeleteAdministrativeUnitGroup(aUnitId string, groupId string) e
 
 func (c *Client) AddGroupMember(groupId string, upn string) error {
 	requestPayload := AddGroupMemberRequest{
-		OdataId: fmt.Sprintf("https://graph.microsoft.com/v1.0/users/%s", upn),
+		OdataId: c.graphUrl("/v1.0/users/%s", upn),
 	}
 
 	serialised, err := json.Marshal(requestPayload)
@@ -284,7 +276,7 @@ func (c *Client) AddGroupMember(groupId string, upn string) error {
 		return err
 	}
 
-	req, err := http.NewRequest("POST", fmt.Sprintf("https://graph.microsoft.com/v1.0/groups/%s/members/$ref", groupId), bytes.NewBuffer([]byte(serialised)))
+	req, err := http.NewRequest("POST", c.graphUrl("/v1.0/groups/%s/members/$ref", groupId), bytes.NewBuffer([]byte(serialised)))
 	if err != nil {
 		return err
 	}
@@ -300,21 +292,25 @@ func (c *Client) AddGroupMember(groupId string, upn string) error {
 
 	defer resp.Body.Close()
 
-	if resp.StatusCode != 204 {
-		if resp.StatusCode == 404 {
+	return addGroupMemberResult(resp.StatusCode, upn)
+}
+
+func addGroupMemberResult(statusCode int, upn string) error {
+	if statusCode != 204 {
+		if statusCode == 404 {
 			return AdUserNotFound.New(fmt.Sprintf("User %s not found, skipping", upn))
 		}
 
-		if resp.StatusCode == 403 {
+		if statusCode == 403 {
 			return HttpError403.New("Response returned with unexpected 403. Skipping entry")
 		}
 
-		if resp.StatusCode == 400 {
+		if statusCode == 400 {
 			util.Logger.Info("Response returned with unexpected 400. User might already be a member.")
 			return nil
 		}
 
-		return HttpError.New(fmt.Sprintf("Unexpected HTTP response. Status code: %d", resp.StatusCode))
+		return HttpError.New(fmt.Sprintf("Unexpected HTTP response. Status code: %d", statusCode))
 	}
 
 	return nil
@@ -322,7 +318,7 @@ func (c *Client) AddGroupMember(groupId string, upn string) error {
 
 func (c *Client) DeleteGroupMember(groupId string, memberId string) error {
 
-	req, err := http.NewRequest("DELETE", fmt.Sprintf("https://graph.microsoft.com/v1.0/groups/%s/members/%s/$ref", groupId, memberId), nil)
+	req, err := http.NewRequest("DELETE", c.graphUrl("/v1.0/groups/%s/members/%s/$ref", groupId, memberId), nil)
 	if err != nil {
 		return err
 	}
@@ -338,92 +334,71 @@ func (c *Client) DeleteGroupMember(groupId string, memberId string) error {
 
 	defer resp.Body.Close()
 
-	if resp.StatusCode != 204 {
-		if resp.StatusCode == 404 {
-			util.Logger.Info(fmt.Sprintf("User %s not found, skipping", memberId), zap.String("jobName", "capSvcToAad")) //TODO: Move this outside of azure client
+	return deleteGroupMemberResult(resp.StatusCode, memberId, "capSvcToAad")
+}
+
+func deleteGroupMemberResult(statusCode int, memberId string, jobName string) error {
+	if statusCode != 204 {
+		if statusCode == 404 {
+			util.Logger.Info(fmt.Sprintf("User %s not found, skipping", memberId), zap.String("jobName", jobName)) //TODO: Move this outside of azure client
 			return nil
 		}
 
-		if resp.StatusCode == 403 {
-			util.Logger.Info("Response returned with unexpected 403. Skipping entry", zap.String("jobName", "capSvcToAad")) //TODO: Move this outside of azure client
+		if statusCode == 403 {
+			util.Logger.Info("Response returned with unexpected 403. Skipping entry", zap.String("jobName", jobName)) //TODO: Move this outside of azure client
 			return nil
 		}
 
-		return HttpError.New(fmt.Sprintf("Unexpected HTTP response. Status code: %d", resp.StatusCode))
+		return HttpError.New(fmt.Sprintf("Unexpected HTTP response. Status code: %d", statusCode))
 	}
 
 	return nil
 }
 
-func (c *Client) GetAdministrativeUnitMembers(id string) (*GetAdministrativeUnitMembersResponse, error) {
-	req, err := http.NewRequest("GET", fmt.Sprintf("https://graph.microsoft.com/v1.0/directory/administrativeUnits/%s/members", id), nil)
-	if err != nil {
-		return nil, err
-	}
+func (c *Client) ListAdministrativeUnitMembers(id string, options *QueryOptions) *Pager[GetAdministrativeUnitMembersResponseUnit] {
+	return newPager[GetAdministrativeUnitMembersResponseUnit](c, c.graphUrl("/v1.0/directory/administrativeUnits/%s/members", id), options)
+}
 
-	err = c.prepareHttpRequest(req)
+func (c *Client) GetAdministrativeUnitMembers(ctx context.Context, id string) (*GetAdministrativeUnitMembersResponse, error) {
+	members, err := c.ListAdministrativeUnitMembers(id, nil).All(ctx)
 	if err != nil {
 		return nil, err
 	}
 
-	resp, err := c.httpClient.Do(req)
+	return &GetAdministrativeUnitMembersResponse{Value: members}, nil
+}
+
+// IsAdministrativeUnitMember returns true if the object with memberId, e.g. a group, is a member of the administrative unit.
+func (c *Client) IsAdministrativeUnitMember(ctx context.Context, aUnitId string, memberId string) (bool, error) {
+	req, err := http.NewRequestWithContext(ctx, "GET", c.graphUrl("/v1.0/directory/administrativeUnits/%s/members/%s", aUnitId, memberId), nil)
 	if err != nil {
-		return nil, err
+		return false, err
 	}
-
-	defer resp.Body.Close()
-
-	rawData, err := io.ReadAll(resp.Body)
+	(&QueryOptions{Select: []string{"id"}}).apply(req)
+	err = c.prepareHttpRequest(req)
 	if err != nil {
-		return nil, err
+		return false, err
 	}
 
-	var payload *GetAdministrativeUnitMembersResponse
-
-	err = json.Unmarshal(rawData, &payload)
+	resp, err := c.httpClient.Do(req)
 	if err != nil {
-		return nil, err
+		return false, err
 	}
 
-	nextLink := payload.OdataNextLink
-
-	for nextLink != "" {
-		req, err := http.NewRequest("GET", nextLink, nil)
-		if err != nil {
-			return nil, err
-		}
-		err = c.prepareHttpRequest(req)
-		if err != nil {
-			return nil, err
-		}
-
-		resp, err := c.httpClient.Do(req)
-		if err != nil {
-			return nil, err
-		}
-
-		rawData, err := io.ReadAll(resp.Body)
-		if err != nil {
-			return nil, err
-		}
-
-		var buffer *GetAdministrativeUnitMembersResponse
-
-		err = json.Unmarshal(rawData, &buffer)
-		if err != nil {
-			return nil, err
-		}
-
-		nextLink = buffer.OdataNextLink
+	defer resp.Body.Close()
 
-		payload.Value = append(payload.Value, buffer.Value...)
+	switch resp.StatusCode {
+	case http.StatusOK:
+		return true, nil
+	case http.StatusNotFound:
+		return false, nil
+	default:
+		return false, HttpError.Wrap(ApiError{resp.StatusCode}, fmt.Sprintf("Unexpected HTTP response when checking if %s is a member of administrative unit %s. Status code: %d", memberId, aUnitId, resp.StatusCode))
 	}
-
-	return payload, nil
 }
 
 func (c *Client) GetUserViaUPN(upn string) (*GetUserViaUPNResponse, error) {
-	req, err := http.NewRequest("GET", fmt.Sprintf("https://graph.microsoft.com/v1.0/users/%s", upn), nil)
+	req, err := http.NewRequest("GET", c.graphUrl("/v1.0/users/%s", upn), nil)
 	if err != nil {
 		return nil, err
 	}
@@ -454,11 +429,14 @@ func (c *Client) GetUserViaUPN(upn string) (*GetUserViaUPNResponse, error) {
 	return payload, nil
 }
 
-func (c *Client) GetGroupMembers(id string) (*GroupMembers, error) {
-	req, err := http.NewRequest("GET", fmt.Sprintf("https://graph.microsoft.com/v1.0/groups/%s/members?$select=id,displayName,givenName,surname,userPrincipalName,email,department,jobTitle", id), nil)
+// GetUser returns the user with the given object id or user principal name, with the properties in UserResolverSelect.
+// It returns AdUserNotFound if there is no such user.
+func (c *Client) GetUser(ctx context.Context, id string) (*UsersListResponseUser, error) {
+	req, err := http.NewRequestWithContext(ctx, "GET", c.graphUrl("/v1.0/users/%s", url.PathEscape(id)), nil)
 	if err != nil {
 		return nil, err
 	}
+	(&QueryOptions{Select: UserResolverSelect}).apply(req)
 	err = c.prepareHttpRequest(req)
 	if err != nil {
 		return nil, err
@@ -471,13 +449,20 @@ func (c *Client) GetGroupMembers(id string) (*GroupMembers, error) {
 
 	defer resp.Body.Close()
 
+	if resp.StatusCode == http.StatusNotFound {
+		return nil, AdUserNotFound.New(fmt.Sprintf("User %s not found", id))
+	}
+
 	rawData, err := io.ReadAll(resp.Body)
 	if err != nil {
 		return nil, err
 	}
 
-	var payload *GroupMembers
+	if resp.StatusCode != http.StatusOK {
+		return nil, HttpError.Wrap(ApiError{resp.StatusCode}, fmt.Sprintf("Unexpected HTTP response when getting user %s. Status code: %d", id, resp.StatusCode))
+	}
 
+	var payload *UsersListResponseUser
 	err = json.Unmarshal(rawData, &payload)
 	if err != nil {
 		return nil, err
@@ -486,107 +471,82 @@ func (c *Client) GetGroupMembers(id string) (*GroupMembers, error) {
 	return payload, nil
 }
 
-func (c *Client) GetApplicationRoles(appId string) (*GetApplicationRolesResponse, error) {
-	req, err := http.NewRequest("GET", "https://graph.microsoft.com/v1.0/applications", nil)
-	if err != nil {
-		return nil, err
-	}
-	err = c.prepareHttpRequest(req)
-	if err != nil {
-		return nil, err
-	}
+func (c *Client) ListUsers(options *QueryOptions) *Pager[*UsersListResponseUser] {
+	return newPager[*UsersListResponseUser](c, c.graphUrl("/v1.0/users"), options)
+}
 
-	urlQueryValues := req.URL.Query()
-	urlQueryValues.Set("$filter", fmt.Sprintf("appId eq '%s'", appId))
-	urlQueryValues.Set("$select", "displayName, appId, appRoles")
-	req.URL.RawQuery = urlQueryValues.Encode()
+// GroupOwnersSelect is the default set of properties requested for group owners.
+var GroupOwnersSelect = []string{"id", "displayName", "userPrincipalName"}
 
-	resp, err := c.httpClient.Do(req)
-	if err != nil {
-		return nil, err
+// ListGroupOwners returns a pager over the owners of a group. If options is nil, GroupOwnersSelect is used.
+func (c *Client) ListGroupOwners(id string, options *QueryOptions) *Pager[GroupOwnersOwner] {
+	if options == nil {
+		options = &QueryOptions{Select: GroupOwnersSelect}
 	}
+	return newPager[GroupOwnersOwner](c, c.graphUrl("/v1.0/groups/%s/owners", id), options)
+}
 
-	defer resp.Body.Close()
+// GroupMembersSelect is the default set of properties requested for group members.
+var GroupMembersSelect = []string{"id", "displayName", "givenName", "surname", "userPrincipalName", "mail", "department", "jobTitle", "accountEnabled"}
 
-	rawData, err := io.ReadAll(resp.Body)
-	if err != nil {
-		return nil, err
+// ListGroupMembers returns a pager over the members of a group. If options is nil, GroupMembersSelect is used.
+func (c *Client) ListGroupMembers(id string, options *QueryOptions) *Pager[GroupMembersMember] {
+	if options == nil {
+		options = &QueryOptions{Select: GroupMembersSelect}
 	}
+	return newPager[GroupMembersMember](c, c.graphUrl("/v1.0/groups/%s/members", id), options)
+}
 
-	var payload *GetApplicationRolesResponse
-
-	err = json.Unmarshal(rawData, &payload)
+func (c *Client) GetGroupMembers(ctx context.Context, id string) (*GroupMembers, error) {
+	members, err := c.ListGroupMembers(id, nil).All(ctx)
 	if err != nil {
 		return nil, err
 	}
 
-	return payload, nil
+	return &GroupMembers{Value: members}, nil
 }
 
-func (c *Client) GetAssignmentsForApplication(appObjectId string) (*GetAssignmentsForApplicationResponse, error) {
-	req, err := http.NewRequest("GET", fmt.Sprintf("https://graph.microsoft.com/beta/servicePrincipals/%s/appRoleAssignedTo", appObjectId), nil)
-	if err != nil {
-		return nil, err
-	}
-	err = c.prepareHttpRequest(req)
-	if err != nil {
-		return nil, err
-	}
-
-	resp, err := c.httpClient.Do(req)
+func (c *Client) GetApplicationRoles(ctx context.Context, appId string) (*GetApplicationRolesResponse, error) {
+	apps, err := newPager[GetApplicationRolesResponseApplication](c, c.graphUrl("/v1.0/applications"), &QueryOptions{
+		Filter: fmt.Sprintf("appId eq '%s'", appId),
+		Select: []string{"displayName", "appId", "appRoles"},
+	}).All(ctx)
 	if err != nil {
 		return nil, err
 	}
 
-	defer resp.Body.Close()
+	return &GetApplicationRolesResponse{Value: apps}, nil
+}
 
-	rawData, err := io.ReadAll(resp.Body)
+// GetApplicationCredentials returns the client secrets and certificates of the application registration with the given appId.
+// Reading registrations other than the client's own requires the Application.Read.All permission.
+func (c *Client) GetApplicationCredentials(ctx context.Context, appId string) (*ApplicationCredentials, error) {
+	apps, err := newPager[ApplicationCredentials](c, c.graphUrl("/v1.0/applications"), &QueryOptions{
+		Filter: fmt.Sprintf("appId eq '%s'", appId),
+		Select: []string{"id", "displayName", "appId", "passwordCredentials", "keyCredentials"},
+	}).All(ctx)
 	if err != nil {
 		return nil, err
 	}
 
-	var payload *GetAssignmentsForApplicationResponse
-
-	err = json.Unmarshal(rawData, &payload)
-	if err != nil {
-		return nil, err
+	if len(apps) != 1 {
+		return nil, AdApplicationNotFound.New(fmt.Sprintf("%s: %s", AdApplicationNotFoundMsg, appId))
 	}
 
-	nextLink := payload.OdataNextLink
-
-	for nextLink != "" {
-		req, err := http.NewRequest("GET", nextLink, nil)
-		if err != nil {
-			return nil, err
-		}
-		err = c.prepareHttpRequest(req)
-		if err != nil {
-			return nil, err
-		}
-
-		resp, err := c.httpClient.Do(req)
-		if err != nil {
-			return nil, err
-		}
-
-		rawData, err := io.ReadAll(resp.Body)
-		if err != nil {
-			return nil, err
-		}
-
-		var buffer *GetAssignmentsForApplicationResponse
-
-		err = json.Unmarshal(rawData, &buffer)
-		if err != nil {
-			return nil, err
-		}
+	return &apps[0], nil
+}
 
-		nextLink = buffer.OdataNextLink
+func (c *Client) ListAssignmentsForApplication(appObjectId string, options *QueryOptions) *Pager[*GetAssignmentsForApplicationResponseAssignment] {
+	return newPager[*GetAssignmentsForApplicationResponseAssignment](c, c.graphUrl("/beta/servicePrincipals/%s/appRoleAssignedTo", appObjectId), options)
+}
 
-		payload.Value = append(payload.Value, buffer.Value...)
+func (c *Client) GetAssignmentsForApplication(ctx context.Context, appObjectId string) (*GetAssignmentsForApplicationResponse, error) {
+	assignments, err := c.ListAssignmentsForApplication(appObjectId, nil).All(ctx)
+	if err != nil {
+		return nil, err
 	}
 
-	return payload, nil
+	return &GetAssignmentsForApplicationResponse{Value: assignments}, nil
 }
 
 func (c *Client) AssignGroupToApplication(appObjectId string, groupId string, roleId string) (*AssignGroupToApplicationResponse, error) {
@@ -601,7 +561,7 @@ func (c *Client) AssignGroupToApplication(appObjectId string, groupId string, ro
 		return nil, err
 	}
 
-	req, err := http.NewRequest("POST", fmt.Sprintf("https://graph.microsoft.com/v1.0/groups/%s/appRoleAssignments", groupId), bytes.NewBuffer([]byte(serialised)))
+	req, err := http.NewRequest("POST", c.graphUrl("/v1.0/groups/%s/appRoleAssignments", groupId), bytes.NewBuffer([]byte(serialised)))
 	if err != nil {
 		return nil, err
 	}
@@ -637,9 +597,9 @@ func (c *Client) AssignGroupToApplication(appObjectId string, groupId string, ro
 }
 
 func (c *Client) UnassignGroupFromApplication(groupId string, assignmentId string) error {
-	req, err := http.NewRequest("DELETE", fmt.Sprintf("https://graph.microsoft.com/v1.0/groups/%s/appRoleAssignments/%s", groupId, assignmentId), nil)
+	req, err := http.NewRequest("DELETE", c.graphUrl("/v1.0/groups/%s/appRoleAssignments/%s", groupId, assignmentId), nil)
 	if err != nil {
-		return nil
+		return err
 	}
 	err = c.prepareHttpRequest(req)
 	if err != nil {
@@ -648,7 +608,7 @@ func (c *Client) UnassignGroupFromApplication(groupId string, assignmentId strin
 
 	resp, err := c.httpClient.Do(req)
 	if err != nil {
-		return nil
+		return err
 	}
 
 	defer resp.Body.Close()
@@ -670,14 +630,3 @@ func NewAzureClient(conf Config) *Client {
 
 	return payload
 }
-
-const AZURE_CAPABILITY_GROUP_PREFIX = "CI_SSU_Cap -"
-const AZURE_CAPABILITY_GROUP_MAIL_PREFIX = "ci-ssu_cap_"
-
-func GenerateAzureGroupDisplayName(name string) string {
-	return fmt.Sprintf("%s %s", AZURE_CAPABILITY_GROUP_PREFIX, name)
-}
-
-func GenerateAzureGroupMailPrefix(name string) string {
-	return fmt.Sprintf("%s%s", AZURE_CAPABILITY_GROUP_MAIL_PREFIX, name)
-}
@@ -1,7 +1,11 @@
 package azure
 
 import (
+	"fmt"
 	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
 	"testing"
 	"time"
 
@@ -133,3 +137,30 @@ func TestNewAzureClient(t *testing.T) {
 	az := NewAzureClient(Config{})
 	assert.NotNil(t, az)
 }
+
+func TestClient_getNewToken_Federated(t *testing.T) {
+	tokenFile := filepath.Join(t.TempDir(), "token")
+	assert.NoError(t, os.WriteFile(tokenFile, []byte("federated-token"), 0600))
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "/tenant/oauth2/v2.0/token", r.URL.Path)
+		assert.NoError(t, r.ParseForm())
+		assert.Equal(t, "client", r.PostForm.Get("client_id"))
+		assert.Equal(t, "federated-token", r.PostForm.Get("client_assertion"))
+		assert.Empty(t, r.PostForm.Get("client_secret"))
+		fmt.Fprint(w, `{"token_type":"Bearer","expires_in":3600,"access_token":"token"}`)
+	}))
+	defer server.Close()
+
+	az := NewAzureClient(Config{
+		TenantId:           "tenant",
+		ClientId:           "client",
+		LoginEndpoint:      server.URL,
+		AuthMethod:         util.ClientAuthFederated,
+		FederatedTokenFile: tokenFile,
+	})
+
+	resp, err := az.getNewToken()
+	assert.NoError(t, err)
+	assert.Equal(t, "token", resp.AccessToken)
+}
@@ -0,0 +1,297 @@
+package azure
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"time"
+
+	"go.dfds.cloud/aad-finout-sync/internal/util"
+	"go.uber.org/zap"
+)
+
+// BatchMaxRequests is the maximum amount of requests Microsoft Graph accepts in a single $batch call.
+const BatchMaxRequests = 20
+
+// batchMaxRetries is how many times requests that were throttled (429) within a batch are retried.
+const batchMaxRetries = 3
+
+// batchRetryDelay is used when a throttled request doesn't include a Retry-After header.
+var batchRetryDelay = 5 * time.Second
+
+type batchRequestItem struct {
+	Id      string            `json:"id"`
+	Method  string            `json:"method"`
+	Url     string            `json:"url"`
+	Body    interface{}       `json:"body,omitempty"`
+	Headers map[string]string `json:"headers,omitempty"`
+}
+
+type batchRequestPayload struct {
+	Requests []batchRequestItem `json:"requests"`
+}
+
+type batchResponseItem struct {
+	Id      string            `json:"id"`
+	Status  int               `json:"status"`
+	Headers map[string]string `json:"headers"`
+	Body    json.RawMessage   `json:"body"`
+}
+
+type batchResponsePayload struct {
+	Responses []batchResponseItem `json:"responses"`
+}
+
+type batchEntry struct {
+	item   batchRequestItem
+	result func(statusCode int) error
+}
+
+// BatchResult is the outcome of a single request in a batch. Err is mapped the same way as the corresponding single request method,
+// e.g. AdUserNotFound or HttpError403 for AddGroupMember and AddGroupOwner.
+type BatchResult struct {
+	Id         string
+	StatusCode int
+	Body       json.RawMessage
+	Err        error
+}
+
+// Batch collects requests and sends them to Microsoft Graph using JSON batching, BatchMaxRequests at a time.
+type Batch struct {
+	client  *Client
+	jobName string
+	entries []batchEntry
+}
+
+// NewBatch returns an empty batch. Skipped requests are logged with jobName.
+func (c *Client) NewBatch(jobName string) *Batch {
+	return &Batch{client: c, jobName: jobName}
+}
+
+func (b *Batch) Len() int {
+	return len(b.entries)
+}
+
+func (b *Batch) add(method string, url string, body interface{}, result func(statusCode int) error) string {
+	id := strconv.Itoa(len(b.entries) + 1)
+	item := batchRequestItem{
+		Id:     id,
+		Method: method,
+		Url:    url,
+		Body:   body,
+	}
+	if body != nil {
+		item.Headers = map[string]string{"Content-Type": "application/json"}
+	}
+
+	b.entries = append(b.entries, batchEntry{item: item, result: result})
+	return id
+}
+
+// AddGroupMember queues the equivalent of Client.AddGroupMember for the user with the given object id or user principal name, and returns the id of the request in the batch.
+func (b *Batch) AddGroupMember(groupId string, memberId string) string {
+	return b.add("POST", fmt.Sprintf("/groups/%s/members/$ref", groupId), AddGroupMemberRequest{
+		OdataId: b.client.graphUrl("/v1.0/users/%s", memberId),
+	}, func(statusCode int) error {
+		return addGroupMemberResult(statusCode, memberId)
+	})
+}
+
+// DeleteGroupMember queues the equivalent of Client.DeleteGroupMember and returns the id of the request in the batch.
+func (b *Batch) DeleteGroupMember(groupId string, memberId string) string {
+	return b.add("DELETE", fmt.Sprintf("/groups/%s/members/%s/$ref", groupId, memberId), nil, func(statusCode int) error {
+		return deleteGroupMemberResult(statusCode, memberId, b.jobName)
+	})
+}
+
+// AddGroupOwner queues adding the user with the given object id as owner of a group, and returns the id of the request in the batch.
+func (b *Batch) AddGroupOwner(groupId string, userId string) string {
+	return b.add("POST", fmt.Sprintf("/groups/%s/owners/$ref", groupId), AddGroupMemberRequest{
+		OdataId: b.client.graphUrl("/v1.0/users/%s", userId),
+	}, func(statusCode int) error {
+		return addGroupOwnerResult(statusCode, userId)
+	})
+}
+
+// DeleteGroupOwner queues removing the user with the given object id as owner of a group, and returns the id of the request in the batch.
+func (b *Batch) DeleteGroupOwner(groupId string, userId string) string {
+	return b.add("DELETE", fmt.Sprintf("/groups/%s/owners/%s/$ref", groupId, userId), nil, func(statusCode int) error {
+		return deleteGroupOwnerResult(statusCode, userId, b.jobName)
+	})
+}
+
+func addGroupOwnerResult(statusCode int, userId string) error {
+	if statusCode != 204 {
+		if statusCode == 404 {
+			return AdUserNotFound.New(fmt.Sprintf("User %s not found, unable to add as owner", userId))
+		}
+
+		if statusCode == 403 {
+			return HttpError403.New(fmt.Sprintf("Response returned with unexpected 403 adding owner %s. Skipping entry", userId))
+		}
+
+		// Graph responds with 400 if the user already is an owner.
+		if statusCode == 400 {
+			util.Logger.Info(fmt.Sprintf("Response returned with unexpected 400. User %s might already be an owner.", userId))
+			return nil
+		}
+
+		return HttpError.New(fmt.Sprintf("Unexpected HTTP response adding owner %s. Status code: %d", userId, statusCode))
+	}
+
+	return nil
+}
+
+func deleteGroupOwnerResult(statusCode int, userId string, jobName string) error {
+	if statusCode != 204 {
+		if statusCode == 404 {
+			util.Logger.Info(fmt.Sprintf("Owner %s not found, skipping", userId), zap.String("jobName", jobName))
+			return nil
+		}
+
+		if statusCode == 403 {
+			util.Logger.Info(fmt.Sprintf("Response returned with unexpected 403 removing owner %s. Skipping entry", userId), zap.String("jobName", jobName))
+			return nil
+		}
+
+		return HttpError.New(fmt.Sprintf("Unexpected HTTP response removing owner %s. Status code: %d", userId, statusCode))
+	}
+
+	return nil
+}
+
+// Execute sends all queued requests and returns the result of each, keyed by request id. Throttled requests are retried.
+// An error is only returned if a batch as a whole fails, errors for individual requests are found in BatchResult.Err.
+func (b *Batch) Execute(ctx context.Context) (map[string]*BatchResult, error) {
+	results := make(map[string]*BatchResult)
+
+	for start := 0; start < len(b.entries); start += BatchMaxRequests {
+		end := start + BatchMaxRequests
+		if end > len(b.entries) {
+			end = len(b.entries)
+		}
+
+		err := b.executeChunk(ctx, b.entries[start:end], results)
+		if err != nil {
+			return results, err
+		}
+	}
+
+	return results, nil
+}
+
+func (b *Batch) executeChunk(ctx context.Context, entries []batchEntry, results map[string]*BatchResult) error {
+	pending := entries
+	for attempt := 0; len(pending) > 0; attempt++ {
+		responses, err := b.send(ctx, pending)
+		if err != nil {
+			return err
+		}
+
+		var throttled []batchEntry
+		var retryAfter time.Duration
+		for _, entry := range pending {
+			resp, exists := responses[entry.item.Id]
+			if !exists {
+				results[entry.item.Id] = &BatchResult{
+					Id:  entry.item.Id,
+					Err: HttpError.New(fmt.Sprintf("No response for request %s in batch", entry.item.Id)),
+				}
+				continue
+			}
+
+			if resp.Status == http.StatusTooManyRequests && attempt < batchMaxRetries {
+				throttled = append(throttled, entry)
+				if delay := parseRetryAfter(resp.Headers); delay > retryAfter {
+					retryAfter = delay
+				}
+				continue
+			}
+
+			results[entry.item.Id] = &BatchResult{
+				Id:         entry.item.Id,
+				StatusCode: resp.Status,
+				Body:       resp.Body,
+				Err:        entry.result(resp.Status),
+			}
+		}
+
+		pending = throttled
+		if len(pending) > 0 {
+			select {
+			case <-ctx.Done():
+				return ctx.Err()
+			case <-time.After(retryAfter):
+			}
+		}
+	}
+
+	return nil
+}
+
+func (b *Batch) send(ctx context.Context, entries []batchEntry) (map[string]batchResponseItem, error) {
+	requestPayload := batchRequestPayload{Requests: []batchRequestItem{}}
+	for _, entry := range entries {
+		requestPayload.Requests = append(requestPayload.Requests, entry.item)
+	}
+
+	serialised, err := json.Marshal(requestPayload)
+	if err != nil {
+		return nil, err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, "POST", b.client.graphUrl("/v1.0/$batch"), bytes.NewBuffer(serialised))
+	if err != nil {
+		return nil, err
+	}
+	err = b.client.prepareJsonRequest(req)
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := b.client.httpClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+
+	defer resp.Body.Close()
+
+	rawData, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, HttpError.Wrap(ApiError{resp.StatusCode}, fmt.Sprintf("Unexpected HTTP response for batch. Status code: %d", resp.StatusCode))
+	}
+
+	var payload batchResponsePayload
+	err = json.Unmarshal(rawData, &payload)
+	if err != nil {
+		return nil, err
+	}
+
+	responses := make(map[string]batchResponseItem)
+	for _, item := range payload.Responses {
+		responses[item.Id] = item
+	}
+
+	return responses, nil
+}
+
+func parseRetryAfter(headers map[string]string) time.Duration {
+	for k, v := range headers {
+		if http.CanonicalHeaderKey(k) == "Retry-After" {
+			seconds, err := strconv.Atoi(v)
+			if err == nil {
+				return time.Duration(seconds) * time.Second
+			}
+		}
+	}
+
+	return batchRetryDelay
+}
@@ -0,0 +1,154 @@
+package azure
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	"github.com/joomcode/errorx"
+	"github.com/stretchr/testify/assert"
+	"go.dfds.cloud/aad-finout-sync/internal/util"
+)
+
+// redirectTransport sends every request to target, regardless of the host it was created for.
+type redirectTransport struct {
+	target *url.URL
+}
+
+func (r redirectTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	req.URL.Scheme = r.target.Scheme
+	req.URL.Host = r.target.Host
+	return http.DefaultTransport.RoundTrip(req)
+}
+
+func newBatchTestClient(server *httptest.Server) *Client {
+	az := newPagerTestClient()
+	target, _ := url.Parse(server.URL)
+	az.httpClient = &http.Client{Transport: redirectTransport{target: target}}
+	return az
+}
+
+func TestBatch_Execute(t *testing.T) {
+	util.InitializeLogger()
+	var batchSizes []int
+	attempts := make(map[string]int)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "/v1.0/$batch", r.URL.Path)
+
+		var reqPayload batchRequestPayload
+		err := json.NewDecoder(r.Body).Decode(&reqPayload)
+		assert.NoError(t, err)
+		batchSizes = append(batchSizes, len(reqPayload.Requests))
+
+		respPayload := batchResponsePayload{}
+		for _, item := range reqPayload.Requests {
+			attempts[item.Id] = attempts[item.Id] + 1
+			status := http.StatusNoContent
+			switch item.Id {
+			case "2":
+				status = http.StatusNotFound
+			case "3":
+				status = http.StatusForbidden
+			case "4":
+				status = http.StatusBadRequest
+			case "5":
+				if attempts[item.Id] == 1 {
+					status = http.StatusTooManyRequests
+				}
+			case "6":
+				status = http.StatusInternalServerError
+			}
+			respPayload.Responses = append(respPayload.Responses, batchResponseItem{
+				Id:      item.Id,
+				Status:  status,
+				Headers: map[string]string{"Retry-After": "0"},
+			})
+		}
+
+		err = json.NewEncoder(w).Encode(respPayload)
+		assert.NoError(t, err)
+	}))
+	defer server.Close()
+
+	batch := newBatchTestClient(server).NewBatch("test")
+	for i := 0; i < 25; i++ {
+		batch.AddGroupMember("group", fmt.Sprintf("user%d@example.com", i))
+	}
+	batch.DeleteGroupMember("group", "member")
+	assert.Equal(t, 26, batch.Len())
+
+	results, err := batch.Execute(context.Background())
+	assert.NoError(t, err)
+	assert.Len(t, results, 26)
+	assert.Equal(t, []int{20, 1, 6}, batchSizes)
+
+	assert.NoError(t, results["1"].Err)
+	assert.True(t, errorx.IsOfType(results["2"].Err, AdUserNotFound))
+	assert.True(t, errorx.IsOfType(results["3"].Err, HttpError403))
+	assert.NoError(t, results["4"].Err)
+	assert.NoError(t, results["5"].Err)
+	assert.Equal(t, 2, attempts["5"])
+	assert.True(t, errorx.IsOfType(results["6"].Err, HttpError))
+	assert.Equal(t, http.StatusNoContent, results["26"].StatusCode)
+}
+
+func TestBatch_ExecuteEmpty(t *testing.T) {
+	results, err := NewAzureClient(azureTestConfig).NewBatch("test").Execute(context.Background())
+	assert.NoError(t, err)
+	assert.Empty(t, results)
+}
+
+func TestBatch_OwnerResults(t *testing.T) {
+	util.InitializeLogger()
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var reqPayload batchRequestPayload
+		err := json.NewDecoder(r.Body).Decode(&reqPayload)
+		assert.NoError(t, err)
+
+		statuses := map[string]int{
+			"1": http.StatusNotFound,
+			"2": http.StatusForbidden,
+			"3": http.StatusBadRequest,
+			"4": http.StatusInternalServerError,
+			"5": http.StatusNotFound,
+			"6": http.StatusForbidden,
+			"7": http.StatusInternalServerError,
+		}
+		respPayload := batchResponsePayload{}
+		for _, item := range reqPayload.Requests {
+			respPayload.Responses = append(respPayload.Responses, batchResponseItem{Id: item.Id, Status: statuses[item.Id]})
+		}
+
+		err = json.NewEncoder(w).Encode(respPayload)
+		assert.NoError(t, err)
+	}))
+	defer server.Close()
+
+	batch := newBatchTestClient(server).NewBatch("test")
+	for i := 0; i < 4; i++ {
+		batch.AddGroupOwner("group", "user-1")
+	}
+	for i := 0; i < 3; i++ {
+		batch.DeleteGroupOwner("group", "user-1")
+	}
+
+	results, err := batch.Execute(context.Background())
+	assert.NoError(t, err)
+
+	assert.True(t, errorx.IsOfType(results["1"].Err, AdUserNotFound))
+	assert.Contains(t, results["1"].Err.Error(), "unable to add as owner")
+	assert.True(t, errorx.IsOfType(results["2"].Err, HttpError403))
+	assert.Contains(t, results["2"].Err.Error(), "adding owner user-1")
+	assert.NoError(t, results["3"].Err)
+	assert.True(t, errorx.IsOfType(results["4"].Err, HttpError))
+	assert.Contains(t, results["4"].Err.Error(), "adding owner user-1")
+
+	assert.NoError(t, results["5"].Err)
+	assert.NoError(t, results["6"].Err)
+	assert.True(t, errorx.IsOfType(results["7"].Err, HttpError))
+	assert.Contains(t, results["7"].Err.Error(), "removing owner user-1")
+}
@@ -0,0 +1,38 @@
+package azure
+
+import (
+	"context"
+)
+
+// GroupsDelta is the result of a groups delta query. DeltaLink is used to request the changes made after this query.
+type GroupsDelta struct {
+	Groups    []GroupsDeltaGroup
+	DeltaLink string
+}
+
+// GetGroupsDelta returns the groups, and their member changes, that changed since deltaLink was issued. With an empty deltaLink every group is returned.
+// If the delta token is no longer valid, a DeltaTokenExpired error is returned and a full sync is required.
+func (c *Client) GetGroupsDelta(ctx context.Context, deltaLink string) (*GroupsDelta, error) {
+	pager := newPager[GroupsDeltaGroup](c, deltaLink, nil)
+	if deltaLink == "" {
+		pager = newPager[GroupsDeltaGroup](c, c.graphUrl("/v1.0/groups/delta"), &QueryOptions{Select: []string{"id", "displayName", "description", "members"}})
+	}
+
+	groups, err := pager.All(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	return &GroupsDelta{Groups: groups, DeltaLink: pager.DeltaLink()}, nil
+}
+
+// GetGroupsDeltaLatest returns a delta link for the current state of the directory without listing any groups.
+func (c *Client) GetGroupsDeltaLatest(ctx context.Context) (string, error) {
+	pager := newPager[GroupsDeltaGroup](c, c.graphUrl("/v1.0/groups/delta")+"?$select=id,displayName,description,members&$deltatoken=latest", nil)
+	_, err := pager.All(ctx)
+	if err != nil {
+		return "", err
+	}
+
+	return pager.DeltaLink(), nil
+}
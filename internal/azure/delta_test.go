@@ -0,0 +1,41 @@
+package azure
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/joomcode/errorx"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestClient_GetGroupsDelta(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "/v1.0/groups/delta", r.URL.Path)
+		switch r.URL.Query().Get("$deltatoken") {
+		case "":
+			assert.Equal(t, "id,displayName,description,members", r.URL.Query().Get("$select"))
+			fmt.Fprint(w, `{"@odata.nextLink":"https://graph.microsoft.com/v1.0/groups/delta?$skiptoken=abc&$deltatoken=next","value":[{"id":"1","displayName":"CI_SSU_Cap - a","members@delta":[{"@odata.type":"#microsoft.graph.user","id":"u1"}]}]}`)
+		case "next":
+			fmt.Fprint(w, `{"@odata.deltaLink":"https://graph.microsoft.com/v1.0/groups/delta?$deltatoken=second","value":[{"id":"2","@removed":{"reason":"deleted"}}]}`)
+		case "expired":
+			w.WriteHeader(http.StatusGone)
+		}
+	}))
+	defer server.Close()
+
+	az := newBatchTestClient(server)
+
+	delta, err := az.GetGroupsDelta(context.Background(), "")
+	assert.NoError(t, err)
+	assert.Len(t, delta.Groups, 2)
+	assert.Equal(t, "https://graph.microsoft.com/v1.0/groups/delta?$deltatoken=second", delta.DeltaLink)
+	assert.True(t, delta.Groups[0].MembersDelta[0].IsUser())
+	assert.Nil(t, delta.Groups[0].Removed)
+	assert.Equal(t, "deleted", delta.Groups[1].Removed.Reason)
+
+	_, err = az.GetGroupsDelta(context.Background(), "https://graph.microsoft.com/v1.0/groups/delta?$deltatoken=expired")
+	assert.True(t, errorx.IsOfType(err, DeltaTokenExpired))
+}
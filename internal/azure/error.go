@@ -15,8 +15,12 @@ func (e ApiError) Error() string {
 }
 
 var (
-	AzureError     = errorx.NewNamespace("azure")
-	AdUserNotFound = AzureError.NewType("ad_user_not_found")
-	HttpError403   = AzureError.NewType("http_error_403")
-	HttpError      = AzureError.NewType("http_error")
+	AzureError        = errorx.NewNamespace("azure")
+	AdUserNotFound    = AzureError.NewType("ad_user_not_found")
+	HttpError403      = AzureError.NewType("http_error_403")
+	HttpError         = AzureError.NewType("http_error")
+	DeltaTokenExpired = AzureError.NewType("delta_token_expired")
+
+	AdApplicationNotFound    = AzureError.NewType("ad_application_not_found")
+	AdApplicationNotFoundMsg = "Unable to find application"
 )
@@ -0,0 +1,117 @@
+package azure
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+)
+
+// CapabilityExtensionName is the name of the open extension that identifies the capability a group belongs to.
+const CapabilityExtensionName = "cloud.dfds.capability"
+
+// CapabilityExtension is stored on capability groups, so they can be matched to their capability regardless of their display name.
+type CapabilityExtension struct {
+	CapabilityId string `json:"capabilityId"`
+	RootId       string `json:"rootId"`
+}
+
+type capabilityExtensionPayload struct {
+	OdataType     string `json:"@odata.type,omitempty"`
+	ExtensionName string `json:"extensionName,omitempty"`
+	CapabilityExtension
+}
+
+// GetGroupCapability returns the capability stored on a group, or nil if the group doesn't have one.
+func (c *Client) GetGroupCapability(ctx context.Context, groupId string) (*CapabilityExtension, error) {
+	req, err := http.NewRequestWithContext(ctx, "GET", c.graphUrl("/v1.0/groups/%s/extensions/%s", groupId, CapabilityExtensionName), nil)
+	if err != nil {
+		return nil, err
+	}
+	err = c.prepareHttpRequest(req)
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusNotFound {
+		return nil, nil
+	}
+
+	rawData, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, HttpError.Wrap(ApiError{resp.StatusCode}, fmt.Sprintf("Unexpected HTTP response when getting capability of group %s. Status code: %d", groupId, resp.StatusCode))
+	}
+
+	var payload capabilityExtensionPayload
+	err = json.Unmarshal(rawData, &payload)
+	if err != nil {
+		return nil, err
+	}
+
+	return &payload.CapabilityExtension, nil
+}
+
+// SetGroupCapability stores the capability a group belongs to on the group, replacing the one already stored.
+func (c *Client) SetGroupCapability(ctx context.Context, groupId string, capability CapabilityExtension) error {
+	status, err := c.sendCapabilityExtension(ctx, "POST", c.graphUrl("/v1.0/groups/%s/extensions", groupId), capabilityExtensionPayload{
+		OdataType:           "microsoft.graph.openTypeExtension",
+		ExtensionName:       CapabilityExtensionName,
+		CapabilityExtension: capability,
+	})
+	if err != nil {
+		return err
+	}
+
+	switch status {
+	case http.StatusCreated:
+		return nil
+	case http.StatusConflict:
+		status, err = c.sendCapabilityExtension(ctx, "PATCH", c.graphUrl("/v1.0/groups/%s/extensions/%s", groupId, CapabilityExtensionName), capabilityExtensionPayload{CapabilityExtension: capability})
+		if err != nil {
+			return err
+		}
+		if status == http.StatusNoContent || status == http.StatusOK {
+			return nil
+		}
+	}
+
+	return HttpError.Wrap(ApiError{status}, fmt.Sprintf("Unexpected HTTP response when setting capability of group %s. Status code: %d", groupId, status))
+}
+
+func (c *Client) sendCapabilityExtension(ctx context.Context, method string, url string, payload capabilityExtensionPayload) (int, error) {
+	serialised, err := json.Marshal(payload)
+	if err != nil {
+		return 0, err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, url, bytes.NewBuffer(serialised))
+	if err != nil {
+		return 0, err
+	}
+	err = c.prepareJsonRequest(req)
+	if err != nil {
+		return 0, err
+	}
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return 0, err
+	}
+
+	defer resp.Body.Close()
+
+	return resp.StatusCode, nil
+}
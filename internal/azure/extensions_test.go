@@ -0,0 +1,53 @@
+package azure
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestClient_SetGroupCapability(t *testing.T) {
+	var requests []string
+	var patched map[string]interface{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests = append(requests, r.Method+" "+r.URL.Path)
+		switch r.Method {
+		case "POST":
+			w.WriteHeader(http.StatusConflict)
+		case "PATCH":
+			assert.NoError(t, json.NewDecoder(r.Body).Decode(&patched))
+			w.WriteHeader(http.StatusNoContent)
+		}
+	}))
+	defer server.Close()
+
+	// An existing extension is updated instead.
+	err := newBatchTestClient(server).SetGroupCapability(context.Background(), "group-1", CapabilityExtension{CapabilityId: "cap-id", RootId: "cap-root"})
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"POST /v1.0/groups/group-1/extensions", "PATCH /v1.0/groups/group-1/extensions/cloud.dfds.capability"}, requests)
+	assert.Equal(t, map[string]interface{}{"capabilityId": "cap-id", "rootId": "cap-root"}, patched)
+}
+
+func TestClient_GetGroupCapability(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/v1.0/groups/group-1/extensions/cloud.dfds.capability" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		w.Write([]byte(`{"@odata.type": "#microsoft.graph.openTypeExtension", "extensionName": "cloud.dfds.capability", "id": "cloud.dfds.capability", "capabilityId": "cap-id", "rootId": "cap-root"}`))
+	}))
+	defer server.Close()
+	client := newBatchTestClient(server)
+
+	capability, err := client.GetGroupCapability(context.Background(), "group-1")
+	assert.NoError(t, err)
+	assert.Equal(t, &CapabilityExtension{CapabilityId: "cap-id", RootId: "cap-root"}, capability)
+
+	capability, err = client.GetGroupCapability(context.Background(), "group-2")
+	assert.NoError(t, err)
+	assert.Nil(t, capability)
+}
@@ -0,0 +1,1335 @@
+// Package fakegraph is an in-memory fake of the parts of Microsoft Graph and the Microsoft identity platform used by the azure package,
+// so handlers can be tested end to end without access to a tenant. Point azure.Config.GraphEndpoint and LoginEndpoint at Server.URL.
+package fakegraph
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+const AccessToken = "fake-graph-token"
+
+const DefaultPageSize = 100
+
+type User struct {
+	ID                string
+	DisplayName       string
+	UserPrincipalName string
+	Mail              string
+	ProxyAddresses    []string
+	Disabled          bool
+	Department        string
+	JobTitle          string
+}
+
+type Group struct {
+	ID           string
+	DisplayName  string
+	Description  string
+	MailNickname string
+	Members      []string
+	Owners       []string
+	Extensions   map[string]map[string]interface{} // open extensions, keyed by extension name
+}
+
+type AdministrativeUnit struct {
+	ID          string
+	DisplayName string
+	Members     []string
+}
+
+type AppRole struct {
+	ID          string
+	DisplayName string
+}
+
+type Application struct {
+	AppId              string
+	ServicePrincipalId string
+	DisplayName        string
+	Roles              []AppRole
+	Credentials        []Credential
+}
+
+// Credential is a client secret or certificate of an application registration.
+type Credential struct {
+	KeyId       string
+	DisplayName string
+	Certificate bool
+	EndDateTime time.Time
+}
+
+type AppRoleAssignment struct {
+	ID          string
+	AppRoleId   string
+	PrincipalId string
+	ResourceId  string
+}
+
+// deltaEvent is a change recorded for groups delta queries.
+type deltaEvent struct {
+	version      int
+	groupId      string
+	memberId     string
+	memberAdded  bool
+	groupRemoved bool
+}
+
+type Server struct {
+	*httptest.Server
+
+	// PageSize is the maximum amount of items returned per page by list calls.
+	PageSize int
+
+	mu              sync.Mutex
+	users           map[string]*User
+	groups          map[string]*Group
+	aUnits          map[string]*AdministrativeUnit
+	applications    []*Application
+	assignments     map[string]*AppRoleAssignment
+	version         int
+	events          []deltaEvent
+	minDeltaVersion int
+	requests        []string
+	invitations     []string
+	failures        map[string]int // status codes keyed by method and path
+}
+
+func NewServer() *Server {
+	s := &Server{
+		PageSize:    DefaultPageSize,
+		users:       make(map[string]*User),
+		groups:      make(map[string]*Group),
+		aUnits:      make(map[string]*AdministrativeUnit),
+		assignments: make(map[string]*AppRoleAssignment),
+		failures:    make(map[string]int),
+	}
+	s.Server = httptest.NewServer(http.HandlerFunc(s.serveHTTP))
+
+	return s
+}
+
+func (s *Server) AddUser(upn string, displayName string) string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	id := uuid.NewString()
+	s.users[id] = &User{ID: id, DisplayName: displayName, UserPrincipalName: upn, Mail: upn}
+	return id
+}
+
+// AddUserWithMail adds a user whose mail differs from their user principal name, optionally with proxy addresses such as "smtp:alias@example.com".
+func (s *Server) AddUserWithMail(upn string, mail string, displayName string, proxyAddresses ...string) string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	id := uuid.NewString()
+	s.users[id] = &User{ID: id, DisplayName: displayName, UserPrincipalName: upn, Mail: mail, ProxyAddresses: proxyAddresses}
+	return id
+}
+
+// SetUserAccountEnabled enables or disables the account of a user, as if done outside of the code under test.
+func (s *Server) SetUserAccountEnabled(userId string, enabled bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if user, exists := s.users[userId]; exists {
+		user.Disabled = !enabled
+	}
+}
+
+// SetUserJob sets the department and job title of a user.
+func (s *Server) SetUserJob(userId string, department string, jobTitle string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if user, exists := s.users[userId]; exists {
+		user.Department = department
+		user.JobTitle = jobTitle
+	}
+}
+
+func (s *Server) AddAdministrativeUnit(displayName string) string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	id := uuid.NewString()
+	s.aUnits[id] = &AdministrativeUnit{ID: id, DisplayName: displayName}
+	return id
+}
+
+// AddGroup creates a group with the given members (user ids). If aUnitId is not empty, the group is created in that administrative unit.
+func (s *Server) AddGroup(aUnitId string, displayName string, memberIds ...string) string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.createGroup(aUnitId, &Group{DisplayName: displayName}, memberIds)
+}
+
+func (s *Server) createGroup(aUnitId string, group *Group, memberIds []string) string {
+	group.ID = uuid.NewString()
+	group.Members = []string{}
+	s.groups[group.ID] = group
+	s.recordEvent(deltaEvent{groupId: group.ID})
+
+	if aUnit, exists := s.aUnits[aUnitId]; exists {
+		aUnit.Members = append(aUnit.Members, group.ID)
+	}
+
+	for _, memberId := range memberIds {
+		s.addMember(group, memberId)
+	}
+
+	return group.ID
+}
+
+// AddApplication registers an application and its service principal, and returns the id of the service principal.
+func (s *Server) AddApplication(appId string, displayName string, roles ...AppRole) string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	app := &Application{
+		AppId:              appId,
+		ServicePrincipalId: uuid.NewString(),
+		DisplayName:        displayName,
+		Roles:              roles,
+	}
+	s.applications = append(s.applications, app)
+	return app.ServicePrincipalId
+}
+
+// AddApplicationCredential adds a client secret, or a certificate if certificate is set, expiring at endDateTime to the application with the given appId,
+// and returns its key id.
+func (s *Server) AddApplicationCredential(appId string, displayName string, certificate bool, endDateTime time.Time) string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	keyId := uuid.NewString()
+	for _, app := range s.applications {
+		if app.AppId == appId {
+			app.Credentials = append(app.Credentials, Credential{KeyId: keyId, DisplayName: displayName, Certificate: certificate, EndDateTime: endDateTime})
+		}
+	}
+	return keyId
+}
+
+func (s *Server) AddAppRoleAssignment(servicePrincipalId string, groupId string, appRoleId string) string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	id := uuid.NewString()
+	s.assignments[id] = &AppRoleAssignment{ID: id, AppRoleId: appRoleId, PrincipalId: groupId, ResourceId: servicePrincipalId}
+	return id
+}
+
+// AddGroupMember adds a user to a group, as if done outside of the code under test.
+func (s *Server) AddGroupMember(groupId string, userId string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if group, exists := s.groups[groupId]; exists {
+		s.addMember(group, userId)
+	}
+}
+
+// AddGroupOwner adds an owner to a group, as if done outside of the code under test. Owners that aren't users are listed as service principals.
+func (s *Server) AddGroupOwner(groupId string, principalId string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if group, exists := s.groups[groupId]; exists && !containsString(group.Owners, principalId) {
+		group.Owners = append(group.Owners, principalId)
+	}
+}
+
+// GroupOwners returns the sorted user principal names of the owners of a group. Owners that aren't users are returned by id.
+func (s *Server) GroupOwners(groupId string) []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	payload := []string{}
+	if group, exists := s.groups[groupId]; exists {
+		for _, ownerId := range group.Owners {
+			if user, exists := s.users[ownerId]; exists {
+				payload = append(payload, user.UserPrincipalName)
+			} else {
+				payload = append(payload, ownerId)
+			}
+		}
+	}
+	sort.Strings(payload)
+
+	return payload
+}
+
+// SetGroupDescription changes the description of a group without recording a delta event, e.g. to set up state left by an earlier run.
+func (s *Server) SetGroupDescription(groupId string, description string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if group, exists := s.groups[groupId]; exists {
+		group.Description = description
+	}
+}
+
+// RenameGroup changes the display name of a group, as if done outside of the code under test.
+func (s *Server) RenameGroup(groupId string, displayName string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if group, exists := s.groups[groupId]; exists {
+		group.DisplayName = displayName
+		s.recordEvent(deltaEvent{groupId: groupId})
+	}
+}
+
+// GroupExtension returns the properties of an open extension of a group, or nil if the group doesn't have it.
+func (s *Server) GroupExtension(groupId string, name string) map[string]interface{} {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	group, exists := s.groups[groupId]
+	if !exists || group.Extensions[name] == nil {
+		return nil
+	}
+
+	properties := make(map[string]interface{})
+	for k, v := range group.Extensions[name] {
+		properties[k] = v
+	}
+	return properties
+}
+
+// Invitations returns the email addresses invitations were sent to, in order.
+func (s *Server) Invitations() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return append([]string{}, s.invitations...)
+}
+
+// GroupByName returns a copy of the group with the given display name, or nil.
+func (s *Server) GroupByName(displayName string) *Group {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, group := range s.groups {
+		if group.DisplayName == displayName {
+			payload := *group
+			payload.Members = append([]string{}, group.Members...)
+			return &payload
+		}
+	}
+
+	return nil
+}
+
+// GroupMemberUpns returns the sorted user principal names of the members of a group.
+func (s *Server) GroupMemberUpns(groupId string) []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	payload := []string{}
+	if group, exists := s.groups[groupId]; exists {
+		for _, memberId := range group.Members {
+			if user, exists := s.users[memberId]; exists {
+				payload = append(payload, user.UserPrincipalName)
+			}
+		}
+	}
+	sort.Strings(payload)
+
+	return payload
+}
+
+// AppRoleAssignments returns the assignments for the service principal, sorted by principal display name.
+func (s *Server) AppRoleAssignments(servicePrincipalId string) []AppRoleAssignment {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	payload := []AppRoleAssignment{}
+	for _, assignment := range s.assignments {
+		if assignment.ResourceId == servicePrincipalId {
+			payload = append(payload, *assignment)
+		}
+	}
+	sort.Slice(payload, func(i, j int) bool {
+		return s.principalName(payload[i].PrincipalId) < s.principalName(payload[j].PrincipalId)
+	})
+
+	return payload
+}
+
+// ExpireDeltaTokens makes every delta token issued so far invalid, requests using them fail with 410 Gone.
+func (s *Server) ExpireDeltaTokens() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.minDeltaVersion = s.version + 1
+}
+
+// FailRequests makes requests with method to path, e.g. "/v1.0/users/<id>", fail with status.
+func (s *Server) FailRequests(method string, path string, status int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.failures[fmt.Sprintf("%s %s", method, path)] = status
+}
+
+// Requests returns the method and path of every request received, e.g. "GET /v1.0/groups".
+func (s *Server) Requests() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return append([]string{}, s.requests...)
+}
+
+func (s *Server) ResetRequests() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.requests = nil
+}
+
+func (s *Server) recordEvent(event deltaEvent) {
+	s.version = s.version + 1
+	event.version = s.version
+	s.events = append(s.events, event)
+}
+
+func (s *Server) addMember(group *Group, userId string) bool {
+	for _, memberId := range group.Members {
+		if memberId == userId {
+			return false
+		}
+	}
+	group.Members = append(group.Members, userId)
+	s.recordEvent(deltaEvent{groupId: group.ID, memberId: userId, memberAdded: true})
+	return true
+}
+
+func (s *Server) removeMember(group *Group, userId string) bool {
+	for i, memberId := range group.Members {
+		if memberId == userId {
+			group.Members = append(group.Members[:i], group.Members[i+1:]...)
+			s.recordEvent(deltaEvent{groupId: group.ID, memberId: userId})
+			return true
+		}
+	}
+	return false
+}
+
+func (s *Server) removeGroup(groupId string) {
+	delete(s.groups, groupId)
+	for _, aUnit := range s.aUnits {
+		aUnit.Members = removeString(aUnit.Members, groupId)
+	}
+	for id, assignment := range s.assignments {
+		if assignment.PrincipalId == groupId {
+			delete(s.assignments, id)
+		}
+	}
+	s.recordEvent(deltaEvent{groupId: groupId, groupRemoved: true})
+}
+
+func (s *Server) findUser(idOrUpn string) *User {
+	if user, exists := s.users[idOrUpn]; exists {
+		return user
+	}
+	for _, user := range s.users {
+		if strings.EqualFold(user.UserPrincipalName, idOrUpn) {
+			return user
+		}
+	}
+	return nil
+}
+
+func (s *Server) principalName(id string) string {
+	if group, exists := s.groups[id]; exists {
+		return group.DisplayName
+	}
+	return ""
+}
+
+func (s *Server) serveHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.requests = append(s.requests, fmt.Sprintf("%s %s", r.Method, r.URL.Path))
+
+	if strings.HasSuffix(r.URL.Path, "/oauth2/v2.0/token") && r.Method == http.MethodPost {
+		writeJson(w, http.StatusOK, map[string]interface{}{
+			"token_type":     "Bearer",
+			"expires_in":     3600,
+			"ext_expires_in": 3600,
+			"access_token":   AccessToken,
+		})
+		return
+	}
+
+	if r.Header.Get("Authorization") != "Bearer "+AccessToken {
+		writeError(w, http.StatusUnauthorized, "InvalidAuthenticationToken")
+		return
+	}
+
+	if status, exists := s.failures[fmt.Sprintf("%s %s", r.Method, r.URL.Path)]; exists {
+		writeError(w, status, http.StatusText(status))
+		return
+	}
+
+	s.route(w, r)
+}
+
+var (
+	startsWithFilter  = regexp.MustCompile(`^startswith\(displayName,\s*'(.*)'\)$`)
+	appIdFilter       = regexp.MustCompile(`^appId eq '(.*)'$`)
+	displayNameFilter = regexp.MustCompile(`^displayName eq '((?:[^']|'')*)'$`)
+	userFilter        = regexp.MustCompile(`^mail eq '((?:[^']|'')*)' or userPrincipalName eq '(?:[^']|'')*' or proxyAddresses/any\(p:p eq 'smtp:(?:[^']|'')*'\)$`)
+)
+
+// route dispatches a Graph request. It expects s.mu to be held, so it can be called for the requests within a $batch.
+func (s *Server) route(w http.ResponseWriter, r *http.Request) {
+	segments := strings.Split(strings.Trim(r.URL.Path, "/"), "/")
+	if len(segments) < 2 {
+		writeError(w, http.StatusNotFound, "Request_ResourceNotFound")
+		return
+	}
+	version := segments[0]
+	segments = segments[1:]
+
+	match := func(method string, pattern ...string) bool {
+		if r.Method != method || len(pattern) != len(segments) {
+			return false
+		}
+		for i, p := range pattern {
+			if p != "*" && p != segments[i] {
+				return false
+			}
+		}
+		return true
+	}
+
+	switch {
+	case version == "v1.0" && match("POST", "$batch"):
+		s.batch(w, r)
+	case match("GET", "groups"):
+		s.listGroups(w, r)
+	case match("PATCH", "groups", "*"):
+		s.updateGroup(w, r, segments[1])
+	case match("GET", "groups", "delta"):
+		s.groupsDelta(w, r)
+	case match("GET", "groups", "*", "members"):
+		s.listGroupMembers(w, r, segments[1])
+	case match("POST", "groups", "*", "members", "$ref"):
+		s.addGroupMemberRef(w, r, segments[1])
+	case match("DELETE", "groups", "*", "members", "*", "$ref"):
+		s.deleteGroupMemberRef(w, segments[1], segments[3])
+	case match("POST", "groups", "*", "extensions"):
+		s.createGroupExtension(w, r, segments[1])
+	case match("GET", "groups", "*", "extensions", "*"):
+		s.getGroupExtension(w, segments[1], segments[3])
+	case match("PATCH", "groups", "*", "extensions", "*"):
+		s.updateGroupExtension(w, r, segments[1], segments[3])
+	case match("GET", "groups", "*", "owners"):
+		s.listGroupOwners(w, r, segments[1])
+	case match("POST", "groups", "*", "owners", "$ref"):
+		s.addGroupOwnerRef(w, r, segments[1])
+	case match("DELETE", "groups", "*", "owners", "*", "$ref"):
+		s.deleteGroupOwnerRef(w, segments[1], segments[3])
+	case match("POST", "groups", "*", "appRoleAssignments"):
+		s.assignGroup(w, r, segments[1])
+	case match("DELETE", "groups", "*", "appRoleAssignments", "*"):
+		s.unassignGroup(w, segments[1], segments[3])
+	case match("GET", "directory", "administrativeUnits"):
+		s.listAdministrativeUnits(w, r)
+	case match("GET", "directory", "administrativeUnits", "*", "members"):
+		s.listAdministrativeUnitMembers(w, r, segments[2])
+	case match("GET", "directory", "administrativeUnits", "*", "members", "*"):
+		s.getAdministrativeUnitMember(w, segments[2], segments[4])
+	case match("POST", "directory", "administrativeUnits", "*", "members"):
+		s.createAdministrativeUnitGroup(w, r, segments[2])
+	case match("DELETE", "directory", "administrativeUnits", "*", "members", "*"):
+		s.deleteAdministrativeUnitGroup(w, segments[2], segments[4])
+	case match("POST", "invitations"):
+		s.createInvitation(w, r)
+	case match("GET", "users"):
+		s.listUsers(w, r)
+	case match("GET", "users", "*"):
+		s.getUser(w, segments[1])
+	case match("GET", "applications"):
+		s.listApplications(w, r)
+	case match("GET", "servicePrincipals", "*", "appRoleAssignedTo"):
+		s.listAppRoleAssignedTo(w, r, segments[1])
+	default:
+		writeError(w, http.StatusNotFound, "Request_ResourceNotFound")
+	}
+}
+
+func (s *Server) batch(w http.ResponseWriter, r *http.Request) {
+	var reqPayload struct {
+		Requests []struct {
+			Id      string            `json:"id"`
+			Method  string            `json:"method"`
+			Url     string            `json:"url"`
+			Body    json.RawMessage   `json:"body"`
+			Headers map[string]string `json:"headers"`
+		} `json:"requests"`
+	}
+	err := json.NewDecoder(r.Body).Decode(&reqPayload)
+	if err != nil || len(reqPayload.Requests) > 20 {
+		writeError(w, http.StatusBadRequest, "BadRequest")
+		return
+	}
+
+	responses := []map[string]interface{}{}
+	for _, item := range reqPayload.Requests {
+		var body io.Reader
+		if len(item.Body) > 0 {
+			body = bytes.NewReader(item.Body)
+		}
+		itemReq := httptest.NewRequest(item.Method, "/v1.0"+item.Url, body)
+		for k, v := range item.Headers {
+			itemReq.Header.Set(k, v)
+		}
+
+		recorder := httptest.NewRecorder()
+		s.route(recorder, itemReq)
+
+		var respBody interface{}
+		if recorder.Body.Len() > 0 {
+			_ = json.Unmarshal(recorder.Body.Bytes(), &respBody)
+		}
+		responses = append(responses, map[string]interface{}{
+			"id":      item.Id,
+			"status":  recorder.Code,
+			"headers": map[string]string{"Content-Type": "application/json"},
+			"body":    respBody,
+		})
+	}
+
+	writeJson(w, http.StatusOK, map[string]interface{}{"responses": responses})
+}
+
+func (s *Server) listGroups(w http.ResponseWriter, r *http.Request) {
+	prefix, ok := parseStartsWith(r)
+	if !ok {
+		writeError(w, http.StatusBadRequest, "Request_UnsupportedQuery")
+		return
+	}
+
+	var items []interface{}
+	for _, group := range sortedGroups(s.groups) {
+		if strings.HasPrefix(group.DisplayName, prefix) {
+			items = append(items, groupJson(group))
+		}
+	}
+	s.writePage(w, r, items)
+}
+
+func (s *Server) createGroupExtension(w http.ResponseWriter, r *http.Request, groupId string) {
+	group, exists := s.groups[groupId]
+	if !exists {
+		writeError(w, http.StatusNotFound, "Request_ResourceNotFound")
+		return
+	}
+
+	var properties map[string]interface{}
+	err := json.NewDecoder(r.Body).Decode(&properties)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "BadRequest")
+		return
+	}
+	name, _ := properties["extensionName"].(string)
+	if name == "" {
+		writeError(w, http.StatusBadRequest, "BadRequest")
+		return
+	}
+	if group.Extensions[name] != nil {
+		writeError(w, http.StatusConflict, "NameAlreadyExists")
+		return
+	}
+
+	if group.Extensions == nil {
+		group.Extensions = make(map[string]map[string]interface{})
+	}
+	properties["id"] = name
+	group.Extensions[name] = properties
+
+	writeJson(w, http.StatusCreated, properties)
+}
+
+func (s *Server) getGroupExtension(w http.ResponseWriter, groupId string, name string) {
+	group, exists := s.groups[groupId]
+	if !exists || group.Extensions[name] == nil {
+		writeError(w, http.StatusNotFound, "Request_ResourceNotFound")
+		return
+	}
+
+	writeJson(w, http.StatusOK, group.Extensions[name])
+}
+
+func (s *Server) updateGroupExtension(w http.ResponseWriter, r *http.Request, groupId string, name string) {
+	group, exists := s.groups[groupId]
+	if !exists || group.Extensions[name] == nil {
+		writeError(w, http.StatusNotFound, "Request_ResourceNotFound")
+		return
+	}
+
+	var properties map[string]interface{}
+	err := json.NewDecoder(r.Body).Decode(&properties)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "BadRequest")
+		return
+	}
+	for k, v := range properties {
+		group.Extensions[name][k] = v
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (s *Server) updateGroup(w http.ResponseWriter, r *http.Request, groupId string) {
+	group, exists := s.groups[groupId]
+	if !exists {
+		writeError(w, http.StatusNotFound, "Request_ResourceNotFound")
+		return
+	}
+
+	var reqPayload struct {
+		Description  *string `json:"description"`
+		DisplayName  *string `json:"displayName"`
+		MailNickname *string `json:"mailNickname"`
+	}
+	err := json.NewDecoder(r.Body).Decode(&reqPayload)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "BadRequest")
+		return
+	}
+
+	if reqPayload.Description != nil {
+		group.Description = *reqPayload.Description
+	}
+	if reqPayload.DisplayName != nil {
+		group.DisplayName = *reqPayload.DisplayName
+	}
+	if reqPayload.MailNickname != nil {
+		group.MailNickname = *reqPayload.MailNickname
+	}
+	s.recordEvent(deltaEvent{groupId: groupId})
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (s *Server) listGroupMembers(w http.ResponseWriter, r *http.Request, groupId string) {
+	group, exists := s.groups[groupId]
+	if !exists {
+		writeError(w, http.StatusNotFound, "Request_ResourceNotFound")
+		return
+	}
+
+	var items []interface{}
+	for _, memberId := range group.Members {
+		if user, exists := s.users[memberId]; exists {
+			items = append(items, userJson(user))
+		}
+	}
+	s.writePage(w, r, items)
+}
+
+func (s *Server) addGroupMemberRef(w http.ResponseWriter, r *http.Request, groupId string) {
+	group, exists := s.groups[groupId]
+	if !exists {
+		writeError(w, http.StatusNotFound, "Request_ResourceNotFound")
+		return
+	}
+
+	var reqPayload struct {
+		OdataId string `json:"@odata.id"`
+	}
+	err := json.NewDecoder(r.Body).Decode(&reqPayload)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "BadRequest")
+		return
+	}
+
+	ref := reqPayload.OdataId[strings.LastIndex(reqPayload.OdataId, "/")+1:]
+	ref, _ = url.PathUnescape(ref)
+	user := s.findUser(ref)
+	if user == nil {
+		writeError(w, http.StatusNotFound, "Request_ResourceNotFound")
+		return
+	}
+
+	if !s.addMember(group, user.ID) {
+		writeError(w, http.StatusBadRequest, "One or more added object references already exist for the following modified properties: 'members'.")
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (s *Server) deleteGroupMemberRef(w http.ResponseWriter, groupId string, memberId string) {
+	group, exists := s.groups[groupId]
+	if !exists || !s.removeMember(group, memberId) {
+		writeError(w, http.StatusNotFound, "Request_ResourceNotFound")
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (s *Server) listGroupOwners(w http.ResponseWriter, r *http.Request, groupId string) {
+	group, exists := s.groups[groupId]
+	if !exists {
+		writeError(w, http.StatusNotFound, "Request_ResourceNotFound")
+		return
+	}
+
+	var items []interface{}
+	for _, ownerId := range group.Owners {
+		if user, exists := s.users[ownerId]; exists {
+			items = append(items, userJson(user))
+		} else {
+			items = append(items, map[string]interface{}{"@odata.type": "#microsoft.graph.servicePrincipal", "id": ownerId})
+		}
+	}
+	s.writePage(w, r, items)
+}
+
+func (s *Server) addGroupOwnerRef(w http.ResponseWriter, r *http.Request, groupId string) {
+	group, exists := s.groups[groupId]
+	if !exists {
+		writeError(w, http.StatusNotFound, "Request_ResourceNotFound")
+		return
+	}
+
+	var reqPayload struct {
+		OdataId string `json:"@odata.id"`
+	}
+	err := json.NewDecoder(r.Body).Decode(&reqPayload)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "BadRequest")
+		return
+	}
+
+	ref := reqPayload.OdataId[strings.LastIndex(reqPayload.OdataId, "/")+1:]
+	ref, _ = url.PathUnescape(ref)
+	user := s.findUser(ref)
+	if user == nil {
+		writeError(w, http.StatusNotFound, "Request_ResourceNotFound")
+		return
+	}
+
+	if containsString(group.Owners, user.ID) {
+		writeError(w, http.StatusBadRequest, "One or more added object references already exist for the following modified properties: 'owners'.")
+		return
+	}
+	group.Owners = append(group.Owners, user.ID)
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (s *Server) deleteGroupOwnerRef(w http.ResponseWriter, groupId string, ownerId string) {
+	group, exists := s.groups[groupId]
+	if !exists || !containsString(group.Owners, ownerId) {
+		writeError(w, http.StatusNotFound, "Request_ResourceNotFound")
+		return
+	}
+	group.Owners = removeString(group.Owners, ownerId)
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (s *Server) assignGroup(w http.ResponseWriter, r *http.Request, groupId string) {
+	group, exists := s.groups[groupId]
+	if !exists {
+		writeError(w, http.StatusNotFound, "Request_ResourceNotFound")
+		return
+	}
+
+	var reqPayload struct {
+		PrincipalId string `json:"principalId"`
+		ResourceId  string `json:"resourceId"`
+		AppRoleId   string `json:"appRoleId"`
+	}
+	err := json.NewDecoder(r.Body).Decode(&reqPayload)
+	if err != nil || reqPayload.PrincipalId != groupId {
+		writeError(w, http.StatusBadRequest, "BadRequest")
+		return
+	}
+
+	for _, assignment := range s.assignments {
+		if assignment.PrincipalId == groupId && assignment.ResourceId == reqPayload.ResourceId && assignment.AppRoleId == reqPayload.AppRoleId {
+			writeError(w, http.StatusBadRequest, "Permission being assigned already exists on the object")
+			return
+		}
+	}
+
+	assignment := &AppRoleAssignment{ID: uuid.NewString(), AppRoleId: reqPayload.AppRoleId, PrincipalId: groupId, ResourceId: reqPayload.ResourceId}
+	s.assignments[assignment.ID] = assignment
+	payload := s.assignmentJson(assignment)
+	payload["principalDisplayName"] = group.DisplayName
+	writeJson(w, http.StatusCreated, payload)
+}
+
+func (s *Server) unassignGroup(w http.ResponseWriter, groupId string, assignmentId string) {
+	assignment, exists := s.assignments[assignmentId]
+	if !exists || assignment.PrincipalId != groupId {
+		writeError(w, http.StatusNotFound, "Request_ResourceNotFound")
+		return
+	}
+
+	delete(s.assignments, assignmentId)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (s *Server) listAdministrativeUnits(w http.ResponseWriter, r *http.Request) {
+	matches := func(aUnit *AdministrativeUnit) bool { return true }
+	if match := displayNameFilter.FindStringSubmatch(r.URL.Query().Get("$filter")); match != nil {
+		name := strings.ReplaceAll(match[1], "''", "'")
+		matches = func(aUnit *AdministrativeUnit) bool { return aUnit.DisplayName == name }
+	} else {
+		prefix, ok := parseStartsWith(r)
+		if !ok {
+			writeError(w, http.StatusBadRequest, "Request_UnsupportedQuery")
+			return
+		}
+		matches = func(aUnit *AdministrativeUnit) bool { return strings.HasPrefix(aUnit.DisplayName, prefix) }
+	}
+
+	var aUnits []*AdministrativeUnit
+	for _, aUnit := range s.aUnits {
+		if matches(aUnit) {
+			aUnits = append(aUnits, aUnit)
+		}
+	}
+	sort.Slice(aUnits, func(i, j int) bool {
+		return aUnits[i].DisplayName < aUnits[j].DisplayName
+	})
+
+	var items []interface{}
+	for _, aUnit := range aUnits {
+		items = append(items, map[string]interface{}{
+			"id":          aUnit.ID,
+			"displayName": aUnit.DisplayName,
+		})
+	}
+	s.writePage(w, r, items)
+}
+
+func (s *Server) listAdministrativeUnitMembers(w http.ResponseWriter, r *http.Request, aUnitId string) {
+	aUnit, exists := s.aUnits[aUnitId]
+	if !exists {
+		writeError(w, http.StatusNotFound, "Request_ResourceNotFound")
+		return
+	}
+
+	var items []interface{}
+	for _, groupId := range aUnit.Members {
+		if group, exists := s.groups[groupId]; exists {
+			items = append(items, groupJson(group))
+		}
+	}
+	s.writePage(w, r, items)
+}
+
+func (s *Server) createAdministrativeUnitGroup(w http.ResponseWriter, r *http.Request, aUnitId string) {
+	if _, exists := s.aUnits[aUnitId]; !exists {
+		writeError(w, http.StatusNotFound, "Request_ResourceNotFound")
+		return
+	}
+
+	var reqPayload struct {
+		DisplayName  string `json:"displayName"`
+		Description  string `json:"description"`
+		MailNickname string `json:"mailNickname"`
+	}
+	err := json.NewDecoder(r.Body).Decode(&reqPayload)
+	if err != nil || reqPayload.DisplayName == "" {
+		writeError(w, http.StatusBadRequest, "BadRequest")
+		return
+	}
+
+	group := &Group{
+		DisplayName:  reqPayload.DisplayName,
+		Description:  reqPayload.Description,
+		MailNickname: reqPayload.MailNickname,
+	}
+	s.createGroup(aUnitId, group, nil)
+	writeJson(w, http.StatusCreated, groupJson(group))
+}
+
+func (s *Server) getAdministrativeUnitMember(w http.ResponseWriter, aUnitId string, groupId string) {
+	aUnit, exists := s.aUnits[aUnitId]
+	if !exists || !containsString(aUnit.Members, groupId) {
+		writeError(w, http.StatusNotFound, "Request_ResourceNotFound")
+		return
+	}
+
+	writeJson(w, http.StatusOK, map[string]interface{}{
+		"@odata.type": "#microsoft.graph.group",
+		"id":          groupId,
+	})
+}
+
+func (s *Server) deleteAdministrativeUnitGroup(w http.ResponseWriter, aUnitId string, groupId string) {
+	aUnit, exists := s.aUnits[aUnitId]
+	if !exists || !containsString(aUnit.Members, groupId) {
+		writeError(w, http.StatusNotFound, "Request_ResourceNotFound")
+		return
+	}
+
+	s.removeGroup(groupId)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// createInvitation creates a guest user for the invited address, with a user principal name in the format used for B2B guests.
+func (s *Server) createInvitation(w http.ResponseWriter, r *http.Request) {
+	var reqPayload struct {
+		InvitedUserEmailAddress string `json:"invitedUserEmailAddress"`
+		InvitedUserDisplayName  string `json:"invitedUserDisplayName"`
+		InviteRedirectUrl       string `json:"inviteRedirectUrl"`
+	}
+	err := json.NewDecoder(r.Body).Decode(&reqPayload)
+	if err != nil || reqPayload.InvitedUserEmailAddress == "" || reqPayload.InviteRedirectUrl == "" {
+		writeError(w, http.StatusBadRequest, "BadRequest")
+		return
+	}
+
+	displayName := reqPayload.InvitedUserDisplayName
+	if displayName == "" {
+		displayName = reqPayload.InvitedUserEmailAddress
+	}
+	user := &User{
+		ID:                uuid.NewString(),
+		DisplayName:       displayName,
+		UserPrincipalName: strings.ReplaceAll(reqPayload.InvitedUserEmailAddress, "@", "_") + "#EXT#@fake.onmicrosoft.com",
+		Mail:              reqPayload.InvitedUserEmailAddress,
+	}
+	s.users[user.ID] = user
+	s.invitations = append(s.invitations, reqPayload.InvitedUserEmailAddress)
+
+	writeJson(w, http.StatusCreated, map[string]interface{}{
+		"id":                      uuid.NewString(),
+		"invitedUserEmailAddress": reqPayload.InvitedUserEmailAddress,
+		"inviteRedeemUrl":         fmt.Sprintf("%s/redeem/%s", s.URL, user.ID),
+		"status":                  "PendingAcceptance",
+		"invitedUser":             map[string]interface{}{"id": user.ID},
+	})
+}
+
+// listUsers supports the filter used to resolve users by mail, user principal name and proxy addresses, which is an advanced query.
+func (s *Server) listUsers(w http.ResponseWriter, r *http.Request) {
+	match := userFilter.FindStringSubmatch(r.URL.Query().Get("$filter"))
+	if match == nil {
+		writeError(w, http.StatusBadRequest, "Request_UnsupportedQuery")
+		return
+	}
+	if r.Header.Get("ConsistencyLevel") != "eventual" || r.URL.Query().Get("$count") != "true" {
+		writeError(w, http.StatusBadRequest, "Request_UnsupportedQuery")
+		return
+	}
+	email := strings.ReplaceAll(match[1], "''", "'")
+
+	var users []*User
+	for _, user := range s.users {
+		if strings.EqualFold(user.Mail, email) || strings.EqualFold(user.UserPrincipalName, email) || containsStringFold(user.ProxyAddresses, "smtp:"+email) {
+			users = append(users, user)
+		}
+	}
+	sort.Slice(users, func(i, j int) bool {
+		return users[i].ID < users[j].ID
+	})
+
+	var items []interface{}
+	for _, user := range users {
+		items = append(items, userJson(user))
+	}
+	s.writePage(w, r, items)
+}
+
+func (s *Server) getUser(w http.ResponseWriter, idOrUpn string) {
+	user := s.findUser(idOrUpn)
+	if user == nil {
+		writeError(w, http.StatusNotFound, "Request_ResourceNotFound")
+		return
+	}
+
+	writeJson(w, http.StatusOK, userJson(user))
+}
+
+func (s *Server) listApplications(w http.ResponseWriter, r *http.Request) {
+	filter := appIdFilter.FindStringSubmatch(r.URL.Query().Get("$filter"))
+
+	var items []interface{}
+	for _, app := range s.applications {
+		if filter != nil && app.AppId != filter[1] {
+			continue
+		}
+
+		roles := []interface{}{}
+		for _, role := range app.Roles {
+			roles = append(roles, map[string]interface{}{
+				"id":                 role.ID,
+				"displayName":        role.DisplayName,
+				"isEnabled":          true,
+				"allowedMemberTypes": []string{"User"},
+			})
+		}
+		passwordCredentials := []interface{}{}
+		keyCredentials := []interface{}{}
+		for _, credential := range app.Credentials {
+			item := map[string]interface{}{
+				"keyId":         credential.KeyId,
+				"displayName":   credential.DisplayName,
+				"startDateTime": credential.EndDateTime.AddDate(-1, 0, 0).Format(time.RFC3339),
+				"endDateTime":   credential.EndDateTime.Format(time.RFC3339),
+			}
+			if credential.Certificate {
+				keyCredentials = append(keyCredentials, item)
+			} else {
+				passwordCredentials = append(passwordCredentials, item)
+			}
+		}
+		items = append(items, map[string]interface{}{
+			"appId":               app.AppId,
+			"displayName":         app.DisplayName,
+			"appRoles":            roles,
+			"passwordCredentials": passwordCredentials,
+			"keyCredentials":      keyCredentials,
+		})
+	}
+	s.writePage(w, r, items)
+}
+
+func (s *Server) listAppRoleAssignedTo(w http.ResponseWriter, r *http.Request, servicePrincipalId string) {
+	var assignments []*AppRoleAssignment
+	for _, assignment := range s.assignments {
+		if assignment.ResourceId == servicePrincipalId {
+			assignments = append(assignments, assignment)
+		}
+	}
+	sort.Slice(assignments, func(i, j int) bool {
+		return assignments[i].ID < assignments[j].ID
+	})
+
+	var items []interface{}
+	for _, assignment := range assignments {
+		items = append(items, s.assignmentJson(assignment))
+	}
+	s.writePage(w, r, items)
+}
+
+// groupsDelta supports the initial query, $deltatoken=latest and delta links issued by earlier queries.
+// Member changes are only reported as members@delta, other properties are always returned in full.
+func (s *Server) groupsDelta(w http.ResponseWriter, r *http.Request) {
+	deltaLink := fmt.Sprintf("%s/v1.0/groups/delta?$deltatoken=%d", s.URL, s.version)
+	token := r.URL.Query().Get("$deltatoken")
+
+	if token == "latest" {
+		writeJson(w, http.StatusOK, map[string]interface{}{"value": []interface{}{}, "@odata.deltaLink": deltaLink})
+		return
+	}
+
+	items := []interface{}{}
+	if token == "" {
+		for _, group := range sortedGroups(s.groups) {
+			members := []interface{}{}
+			for _, memberId := range group.Members {
+				members = append(members, map[string]interface{}{"@odata.type": "#microsoft.graph.user", "id": memberId})
+			}
+			item := groupJson(group)
+			item["members@delta"] = members
+			items = append(items, item)
+		}
+		writeJson(w, http.StatusOK, map[string]interface{}{"value": items, "@odata.deltaLink": deltaLink})
+		return
+	}
+
+	since, err := strconv.Atoi(token)
+	if err != nil || since < s.minDeltaVersion-1 {
+		writeError(w, http.StatusGone, "SyncStateNotFound")
+		return
+	}
+
+	changed := make(map[string][]interface{})
+	removed := make(map[string]bool)
+	var order []string
+	for _, event := range s.events {
+		if event.version <= since {
+			continue
+		}
+		if _, seen := changed[event.groupId]; !seen {
+			changed[event.groupId] = []interface{}{}
+			order = append(order, event.groupId)
+		}
+		if event.groupRemoved {
+			removed[event.groupId] = true
+			continue
+		}
+		if event.memberId != "" {
+			member := map[string]interface{}{"@odata.type": "#microsoft.graph.user", "id": event.memberId}
+			if !event.memberAdded {
+				member["@removed"] = map[string]string{"reason": "deleted"}
+			}
+			changed[event.groupId] = append(changed[event.groupId], member)
+		}
+	}
+
+	for _, groupId := range order {
+		group, exists := s.groups[groupId]
+		if removed[groupId] || !exists {
+			items = append(items, map[string]interface{}{"id": groupId, "@removed": map[string]string{"reason": "deleted"}})
+			continue
+		}
+		item := groupJson(group)
+		item["members@delta"] = changed[groupId]
+		items = append(items, item)
+	}
+
+	writeJson(w, http.StatusOK, map[string]interface{}{"value": items, "@odata.deltaLink": deltaLink})
+}
+
+// writePage writes items as a Graph collection, paginated using $top (capped at PageSize) and $skiptoken.
+func (s *Server) writePage(w http.ResponseWriter, r *http.Request, items []interface{}) {
+	pageSize := s.PageSize
+	if top, err := strconv.Atoi(r.URL.Query().Get("$top")); err == nil && top > 0 && top < pageSize {
+		pageSize = top
+	}
+
+	offset, _ := strconv.Atoi(r.URL.Query().Get("$skiptoken"))
+	if offset > len(items) {
+		offset = len(items)
+	}
+	end := offset + pageSize
+	if end > len(items) {
+		end = len(items)
+	}
+
+	payload := map[string]interface{}{"value": append([]interface{}{}, items[offset:end]...)}
+	if end < len(items) {
+		query := r.URL.Query()
+		query.Set("$skiptoken", strconv.Itoa(end))
+		payload["@odata.nextLink"] = fmt.Sprintf("%s%s?%s", s.URL, r.URL.Path, query.Encode())
+	}
+
+	writeJson(w, http.StatusOK, payload)
+}
+
+func (s *Server) assignmentJson(assignment *AppRoleAssignment) map[string]interface{} {
+	return map[string]interface{}{
+		"id":                   assignment.ID,
+		"appRoleId":            assignment.AppRoleId,
+		"principalId":          assignment.PrincipalId,
+		"principalDisplayName": s.principalName(assignment.PrincipalId),
+		"principalType":        "Group",
+		"resourceId":           assignment.ResourceId,
+	}
+}
+
+func groupJson(group *Group) map[string]interface{} {
+	return map[string]interface{}{
+		"@odata.type":     "#microsoft.graph.group",
+		"id":              group.ID,
+		"displayName":     group.DisplayName,
+		"description":     group.Description,
+		"mailNickname":    group.MailNickname,
+		"securityEnabled": true,
+	}
+}
+
+func userJson(user *User) map[string]interface{} {
+	return map[string]interface{}{
+		"@odata.type":       "#microsoft.graph.user",
+		"id":                user.ID,
+		"displayName":       user.DisplayName,
+		"userPrincipalName": user.UserPrincipalName,
+		"mail":              user.Mail,
+		"proxyAddresses":    append([]string{}, user.ProxyAddresses...),
+		"accountEnabled":    !user.Disabled,
+		"department":        user.Department,
+		"jobTitle":          user.JobTitle,
+	}
+}
+
+func sortedGroups(groups map[string]*Group) []*Group {
+	payload := make([]*Group, 0, len(groups))
+	for _, group := range groups {
+		payload = append(payload, group)
+	}
+	sort.Slice(payload, func(i, j int) bool {
+		return payload[i].DisplayName < payload[j].DisplayName
+	})
+
+	return payload
+}
+
+func parseStartsWith(r *http.Request) (string, bool) {
+	filter := r.URL.Query().Get("$filter")
+	if filter == "" {
+		return "", true
+	}
+
+	match := startsWithFilter.FindStringSubmatch(filter)
+	if match == nil {
+		return "", false
+	}
+
+	return match[1], true
+}
+
+func containsStringFold(values []string, val string) bool {
+	for _, v := range values {
+		if strings.EqualFold(v, val) {
+			return true
+		}
+	}
+	return false
+}
+
+func containsString(values []string, val string) bool {
+	for _, v := range values {
+		if v == val {
+			return true
+		}
+	}
+	return false
+}
+
+func removeString(values []string, val string) []string {
+	payload := []string{}
+	for _, v := range values {
+		if v != val {
+			payload = append(payload, v)
+		}
+	}
+	return payload
+}
+
+func writeJson(w http.ResponseWriter, statusCode int, payload interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(statusCode)
+	_ = json.NewEncoder(w).Encode(payload)
+}
+
+func writeError(w http.ResponseWriter, statusCode int, message string) {
+	writeJson(w, statusCode, map[string]interface{}{
+		"error": map[string]string{
+			"code":    http.StatusText(statusCode),
+			"message": message,
+		},
+	})
+}
@@ -0,0 +1,53 @@
+package azure
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+)
+
+// CreateInvitation invites an external user to the tenant as a B2B guest. The guest user object is created right away,
+// so it can be added to groups before the invitation has been redeemed.
+func (c *Client) CreateInvitation(ctx context.Context, requestPayload CreateInvitationRequest) (*CreateInvitationResponse, error) {
+	serialised, err := json.Marshal(requestPayload)
+	if err != nil {
+		return nil, err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, "POST", c.graphUrl("/v1.0/invitations"), bytes.NewBuffer(serialised))
+	if err != nil {
+		return nil, err
+	}
+	err = c.prepareJsonRequest(req)
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+
+	defer resp.Body.Close()
+
+	rawData, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+
+	if resp.StatusCode != http.StatusCreated {
+		return nil, HttpError.Wrap(ApiError{resp.StatusCode}, fmt.Sprintf("Unable to invite %s. Status code: %d", requestPayload.InvitedUserEmailAddress, resp.StatusCode))
+	}
+
+	var payload *CreateInvitationResponse
+
+	err = json.Unmarshal(rawData, &payload)
+	if err != nil {
+		return nil, err
+	}
+
+	return payload, nil
+}
@@ -7,61 +7,66 @@ import (
 )
 
 type GroupsListResponse struct {
-	OdataContext  string `json:"@odata.context"`
-	OdataNextLink string `json:"@odata.nextLink"`
-	Value         []struct {
-		ID                            string        `json:"id"`
-		DeletedDateTime               interface{}   `json:"deletedDateTime"`
-		Classification                interface{}   `json:"classification"`
-		CreatedDateTime               time.Time     `json:"createdDateTime"`
-		CreationOptions               []interface{} `json:"creationOptions"`
-		Description                   string        `json:"description"`
-		DisplayName                   string        `json:"displayName"`
-		ExpirationDateTime            interface{}   `json:"expirationDateTime"`
-		GroupTypes                    []interface{} `json:"groupTypes"`
-		IsAssignableToRole            interface{}   `json:"isAssignableToRole"`
-		Mail                          interface{}   `json:"mail"`
-		MailEnabled                   bool          `json:"mailEnabled"`
-		MailNickname                  string        `json:"mailNickname"`
-		MembershipRule                interface{}   `json:"membershipRule"`
-		MembershipRuleProcessingState interface{}   `json:"membershipRuleProcessingState"`
-		OnPremisesDomainName          string        `json:"onPremisesDomainName"`
-		OnPremisesLastSyncDateTime    time.Time     `json:"onPremisesLastSyncDateTime"`
-		OnPremisesNetBiosName         string        `json:"onPremisesNetBiosName"`
-		OnPremisesSamAccountName      string        `json:"onPremisesSamAccountName"`
-		OnPremisesSecurityIdentifier  string        `json:"onPremisesSecurityIdentifier"`
-		OnPremisesSyncEnabled         bool          `json:"onPremisesSyncEnabled"`
-		PreferredDataLocation         interface{}   `json:"preferredDataLocation"`
-		PreferredLanguage             interface{}   `json:"preferredLanguage"`
-		ProxyAddresses                []interface{} `json:"proxyAddresses"`
-		RenewedDateTime               time.Time     `json:"renewedDateTime"`
-		ResourceBehaviorOptions       []interface{} `json:"resourceBehaviorOptions"`
-		ResourceProvisioningOptions   []interface{} `json:"resourceProvisioningOptions"`
-		SecurityEnabled               bool          `json:"securityEnabled"`
-		SecurityIdentifier            string        `json:"securityIdentifier"`
-		Theme                         interface{}   `json:"theme"`
-		Visibility                    interface{}   `json:"visibility"`
-		OnPremisesProvisioningErrors  []interface{} `json:"onPremisesProvisioningErrors"`
-	} `json:"value"`
+	OdataContext  string                    `json:"@odata.context"`
+	OdataNextLink string                    `json:"@odata.nextLink"`
+	Value         []GroupsListResponseGroup `json:"value"`
+}
+
+type GroupsListResponseGroup struct {
+	ID                            string        `json:"id"`
+	DeletedDateTime               interface{}   `json:"deletedDateTime"`
+	Classification                interface{}   `json:"classification"`
+	CreatedDateTime               time.Time     `json:"createdDateTime"`
+	CreationOptions               []interface{} `json:"creationOptions"`
+	Description                   string        `json:"description"`
+	DisplayName                   string        `json:"displayName"`
+	ExpirationDateTime            interface{}   `json:"expirationDateTime"`
+	GroupTypes                    []interface{} `json:"groupTypes"`
+	IsAssignableToRole            interface{}   `json:"isAssignableToRole"`
+	Mail                          interface{}   `json:"mail"`
+	MailEnabled                   bool          `json:"mailEnabled"`
+	MailNickname                  string        `json:"mailNickname"`
+	MembershipRule                interface{}   `json:"membershipRule"`
+	MembershipRuleProcessingState interface{}   `json:"membershipRuleProcessingState"`
+	OnPremisesDomainName          string        `json:"onPremisesDomainName"`
+	OnPremisesLastSyncDateTime    time.Time     `json:"onPremisesLastSyncDateTime"`
+	OnPremisesNetBiosName         string        `json:"onPremisesNetBiosName"`
+	OnPremisesSamAccountName      string        `json:"onPremisesSamAccountName"`
+	OnPremisesSecurityIdentifier  string        `json:"onPremisesSecurityIdentifier"`
+	OnPremisesSyncEnabled         bool          `json:"onPremisesSyncEnabled"`
+	PreferredDataLocation         interface{}   `json:"preferredDataLocation"`
+	PreferredLanguage             interface{}   `json:"preferredLanguage"`
+	ProxyAddresses                []interface{} `json:"proxyAddresses"`
+	RenewedDateTime               time.Time     `json:"renewedDateTime"`
+	ResourceBehaviorOptions       []interface{} `json:"resourceBehaviorOptions"`
+	ResourceProvisioningOptions   []interface{} `json:"resourceProvisioningOptions"`
+	SecurityEnabled               bool          `json:"securityEnabled"`
+	SecurityIdentifier            string        `json:"securityIdentifier"`
+	Theme                         interface{}   `json:"theme"`
+	Visibility                    interface{}   `json:"visibility"`
+	OnPremisesProvisioningErrors  []interface{} `json:"onPremisesProvisioningErrors"`
 }
 
 type GroupMembers struct {
-	OdataContext string `json:"@odata.context"`
-	Value        []struct {
-		OdataType         string        `json:"@odata.type"`
-		ID                string        `json:"id"`
-		BusinessPhones    []interface{} `json:"businessPhones"`
-		DisplayName       string        `json:"displayName"`
-		GivenName         string        `json:"givenName"`
-		JobTitle          string        `json:"jobTitle"`
-		Mail              string        `json:"mail"`
-		MobilePhone       string        `json:"mobilePhone"`
-		OfficeLocation    interface{}   `json:"officeLocation"`
-		PreferredLanguage interface{}   `json:"preferredLanguage"`
-		Surname           string        `json:"surname"`
-		UserPrincipalName string        `json:"userPrincipalName"`
-		Department        string        `json:"department"`
-	} `json:"value"`
+	OdataContext string               `json:"@odata.context"`
+	Value        []GroupMembersMember `json:"value"`
+}
+
+type GroupMembersMember struct {
+	OdataType         string        `json:"@odata.type"`
+	ID                string        `json:"id"`
+	BusinessPhones    []interface{} `json:"businessPhones"`
+	DisplayName       string        `json:"displayName"`
+	GivenName         string        `json:"givenName"`
+	JobTitle          string        `json:"jobTitle"`
+	Mail              string        `json:"mail"`
+	MobilePhone       string        `json:"mobilePhone"`
+	OfficeLocation    interface{}   `json:"officeLocation"`
+	PreferredLanguage interface{}   `json:"preferredLanguage"`
+	Surname           string        `json:"surname"`
+	UserPrincipalName string        `json:"userPrincipalName"`
+	Department        string        `json:"department"`
+	AccountEnabled    *bool         `json:"accountEnabled"`
 }
 
 type GetAdministrativeUnitsResponse struct {
@@ -81,6 +86,12 @@ type CreateAdministrativeUnitGroupRequest struct {
 	ParentAdministrativeUnitId string `json:"-"`
 }
 
+type UpdateGroupRequest struct {
+	Description  *string `json:"description,omitempty"`
+	DisplayName  *string `json:"displayName,omitempty"`
+	MailNickname *string `json:"mailNickname,omitempty"`
+}
+
 type AddGroupMemberRequest struct {
 	OdataId string `json:"@odata.id"`
 }
@@ -100,6 +111,31 @@ type GetUserViaUPNResponse struct {
 	ID                string        `json:"id"`
 }
 
+type UsersListResponseUser struct {
+	ID                string   `json:"id"`
+	DisplayName       string   `json:"displayName"`
+	UserPrincipalName string   `json:"userPrincipalName"`
+	Mail              string   `json:"mail"`
+	ProxyAddresses    []string `json:"proxyAddresses"`
+	AccountEnabled    *bool    `json:"accountEnabled"`
+}
+
+// IsDisabled returns true if the user's account is known to be disabled. Users loaded without accountEnabled are assumed to be enabled.
+func (u *UsersListResponseUser) IsDisabled() bool {
+	return u.AccountEnabled != nil && !*u.AccountEnabled
+}
+
+// HasProxyAddress returns true if email is one of the user's SMTP addresses, primary (SMTP:) or alias (smtp:).
+func (u *UsersListResponseUser) HasProxyAddress(email string) bool {
+	for _, address := range u.ProxyAddresses {
+		if strings.EqualFold(address, "smtp:"+email) {
+			return true
+		}
+	}
+
+	return false
+}
+
 type CreateAdministrativeUnitGroupResponse struct {
 	OdataContext                  string        `json:"@odata.context"`
 	OdataType                     string        `json:"@odata.type"`
@@ -201,20 +237,22 @@ type GetAdministrativeUnitMembersResponseUnit struct {
 }
 
 type GetApplicationRolesResponse struct {
-	OdataContext string `json:"@odata.context"`
-	Value        []struct {
-		DisplayName string `json:"displayName"`
-		AppID       string `json:"appId"`
-		AppRoles    []struct {
-			AllowedMemberTypes []string    `json:"allowedMemberTypes"`
-			Description        string      `json:"description"`
-			DisplayName        string      `json:"displayName"`
-			ID                 string      `json:"id"`
-			IsEnabled          bool        `json:"isEnabled"`
-			Origin             string      `json:"origin"`
-			Value              interface{} `json:"value"`
-		} `json:"appRoles"`
-	} `json:"value"`
+	OdataContext string                                   `json:"@odata.context"`
+	Value        []GetApplicationRolesResponseApplication `json:"value"`
+}
+
+type GetApplicationRolesResponseApplication struct {
+	DisplayName string `json:"displayName"`
+	AppID       string `json:"appId"`
+	AppRoles    []struct {
+		AllowedMemberTypes []string    `json:"allowedMemberTypes"`
+		Description        string      `json:"description"`
+		DisplayName        string      `json:"displayName"`
+		ID                 string      `json:"id"`
+		IsEnabled          bool        `json:"isEnabled"`
+		Origin             string      `json:"origin"`
+		Value              interface{} `json:"value"`
+	} `json:"appRoles"`
 }
 
 func (g *GetApplicationRolesResponse) GetRoleId(name string) (string, error) {
@@ -231,6 +269,22 @@ func (g *GetApplicationRolesResponse) GetRoleId(name string) (string, error) {
 	return "", errors.New("application role not found")
 }
 
+// ApplicationCredentials is an application registration with its client secrets (passwordCredentials) and certificates (keyCredentials).
+type ApplicationCredentials struct {
+	ID                  string                  `json:"id"`
+	DisplayName         string                  `json:"displayName"`
+	AppID               string                  `json:"appId"`
+	PasswordCredentials []ApplicationCredential `json:"passwordCredentials"`
+	KeyCredentials      []ApplicationCredential `json:"keyCredentials"`
+}
+
+type ApplicationCredential struct {
+	KeyID         string    `json:"keyId"`
+	DisplayName   string    `json:"displayName"`
+	StartDateTime time.Time `json:"startDateTime"`
+	EndDateTime   time.Time `json:"endDateTime"`
+}
+
 type AssignGroupToApplicationRequest struct {
 	PrincipalID string `json:"principalId"`
 	ResourceID  string `json:"resourceId"`
@@ -288,9 +342,11 @@ func (g *GetAssignmentsForApplicationResponse) GetAssignmentByGroupName(name str
 }
 
 type Group struct {
-	ID          string    `json:"id"`
-	DisplayName string    `json:"displayName"`
-	Members     []*Member `json:"members"`
+	ID          string               `json:"id"`
+	DisplayName string               `json:"displayName"`
+	Description string               `json:"description"`
+	Capability  *CapabilityExtension `json:"capability,omitempty"`
+	Members     []*Member            `json:"members"`
 }
 
 func (g *Group) HasMember(email string) bool {
@@ -303,8 +359,89 @@ func (g *Group) HasMember(email string) bool {
 	return false
 }
 
+// GetMemberByUpn returns the member with the given user principal name, or nil.
+func (g *Group) GetMemberByUpn(upn string) *Member {
+	for _, member := range g.Members {
+		if strings.EqualFold(member.UserPrincipalName, upn) {
+			return member
+		}
+	}
+
+	return nil
+}
+
+// HasMemberId returns true if the user with the given object id is a member of the group.
+func (g *Group) HasMemberId(id string) bool {
+	for _, member := range g.Members {
+		if member.ID == id {
+			return true
+		}
+	}
+
+	return false
+}
+
 type Member struct {
 	ID                string `json:"id"`
 	DisplayName       string `json:"displayName"`
 	UserPrincipalName string `json:"userPrincipalName"`
+	AccountEnabled    *bool  `json:"accountEnabled,omitempty"`
+	Department        string `json:"department,omitempty"`
+	JobTitle          string `json:"jobTitle,omitempty"`
+}
+
+// IsDisabled returns true if the member's account is known to be disabled. Members loaded without accountEnabled are assumed to be enabled.
+func (m *Member) IsDisabled() bool {
+	return m.AccountEnabled != nil && !*m.AccountEnabled
+}
+
+type GroupOwnersOwner struct {
+	OdataType         string `json:"@odata.type"`
+	ID                string `json:"id"`
+	DisplayName       string `json:"displayName"`
+	UserPrincipalName string `json:"userPrincipalName"`
+}
+
+// IsUser returns false for owners that are service principals.
+func (o GroupOwnersOwner) IsUser() bool {
+	return o.OdataType == "#microsoft.graph.user"
+}
+
+type GroupsDeltaGroup struct {
+	ID           string              `json:"id"`
+	DisplayName  string              `json:"displayName"`
+	Description  *string             `json:"description"`
+	MembersDelta []GroupsDeltaMember `json:"members@delta"`
+	Removed      *DeltaRemoved       `json:"@removed,omitempty"`
+}
+
+type GroupsDeltaMember struct {
+	OdataType string        `json:"@odata.type"`
+	ID        string        `json:"id"`
+	Removed   *DeltaRemoved `json:"@removed,omitempty"`
+}
+
+func (m GroupsDeltaMember) IsUser() bool {
+	return m.OdataType == "#microsoft.graph.user"
+}
+
+type DeltaRemoved struct {
+	Reason string `json:"reason"`
+}
+
+type CreateInvitationRequest struct {
+	InvitedUserEmailAddress string `json:"invitedUserEmailAddress"`
+	InvitedUserDisplayName  string `json:"invitedUserDisplayName,omitempty"`
+	InviteRedirectUrl       string `json:"inviteRedirectUrl"`
+	SendInvitationMessage   bool   `json:"sendInvitationMessage"`
+}
+
+type CreateInvitationResponse struct {
+	ID                      string `json:"id"`
+	InvitedUserEmailAddress string `json:"invitedUserEmailAddress"`
+	InviteRedeemUrl         string `json:"inviteRedeemUrl"`
+	Status                  string `json:"status"`
+	InvitedUser             struct {
+		ID string `json:"id"`
+	} `json:"invitedUser"`
 }
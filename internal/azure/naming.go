@@ -0,0 +1,102 @@
+package azure
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// GroupNamingRootIdPlaceholder is replaced by the capability root id in group naming templates.
+const GroupNamingRootIdPlaceholder = "{rootId}"
+
+const (
+	DefaultAdministrativeUnit        = "Team - Cloud Engineering - Self service"
+	DefaultGroupDisplayNameTemplate  = "CI_SSU_Cap - {rootId}"
+	DefaultGroupMailNicknameTemplate = "ci-ssu_cap_{rootId}"
+	DefaultGroupDescription          = "[Automated] - aad-finout-sync"
+)
+
+// GroupNaming derives the display name, mail nickname and description of capability groups from templates,
+// and recognises capability groups by their display name.
+type GroupNaming struct {
+	displayNameTemplate  string
+	mailNicknameTemplate string
+	description          string
+}
+
+// NewGroupNaming validates the templates, which must contain GroupNamingRootIdPlaceholder exactly once.
+func NewGroupNaming(displayNameTemplate string, mailNicknameTemplate string, description string) (*GroupNaming, error) {
+	if strings.Count(displayNameTemplate, GroupNamingRootIdPlaceholder) != 1 {
+		return nil, fmt.Errorf("group display name template %q must contain %s exactly once", displayNameTemplate, GroupNamingRootIdPlaceholder)
+	}
+	if strings.Count(mailNicknameTemplate, GroupNamingRootIdPlaceholder) != 1 {
+		return nil, fmt.Errorf("group mail nickname template %q must contain %s exactly once", mailNicknameTemplate, GroupNamingRootIdPlaceholder)
+	}
+	if strings.TrimSpace(strings.Split(displayNameTemplate, GroupNamingRootIdPlaceholder)[0]) == "" {
+		return nil, errors.New("group display name template must start with a prefix, so capability groups can be recognised")
+	}
+
+	return &GroupNaming{
+		displayNameTemplate:  displayNameTemplate,
+		mailNicknameTemplate: mailNicknameTemplate,
+		description:          description,
+	}, nil
+}
+
+// DefaultGroupNaming is the naming used by Cloud Engineering, e.g. "CI_SSU_Cap - <root id>".
+func DefaultGroupNaming() *GroupNaming {
+	naming, _ := NewGroupNaming(DefaultGroupDisplayNameTemplate, DefaultGroupMailNicknameTemplate, DefaultGroupDescription)
+	return naming
+}
+
+func (n *GroupNaming) DisplayName(rootId string) string {
+	return strings.Replace(n.displayNameTemplate, GroupNamingRootIdPlaceholder, rootId, 1)
+}
+
+func (n *GroupNaming) MailNickname(rootId string) string {
+	return strings.Replace(n.mailNicknameTemplate, GroupNamingRootIdPlaceholder, rootId, 1)
+}
+
+func (n *GroupNaming) Description() string {
+	return n.description
+}
+
+// Prefix is the part of the display name before the root id, without trailing whitespace, e.g. "CI_SSU_Cap -".
+func (n *GroupNaming) Prefix() string {
+	return strings.TrimSpace(strings.Split(n.displayNameTemplate, GroupNamingRootIdPlaceholder)[0])
+}
+
+// IsCapabilityGroup returns true if displayName is the full display name template rendered with a root id, e.g. not just starting with the prefix.
+func (n *GroupNaming) IsCapabilityGroup(displayName string) bool {
+	_, ok := n.RootId(displayName)
+	return ok
+}
+
+// rootIdPattern is what a root id can look like. Capability root ids are a single token, so names with spaces or other punctuation aren't capability groups.
+var rootIdPattern = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9_-]*$`)
+
+// RootId returns the capability root id a display name was generated from.
+func (n *GroupNaming) RootId(displayName string) (string, bool) {
+	parts := strings.Split(n.displayNameTemplate, GroupNamingRootIdPlaceholder)
+	if !strings.HasPrefix(displayName, parts[0]) || !strings.HasSuffix(displayName, parts[1]) || len(displayName) <= len(parts[0])+len(parts[1]) {
+		return "", false
+	}
+
+	rootId := displayName[len(parts[0]) : len(displayName)-len(parts[1])]
+	if !rootIdPattern.MatchString(rootId) {
+		return "", false
+	}
+
+	return rootId, true
+}
+
+// GenerateAzureGroupDisplayName returns the display name of a capability group using the default naming.
+func GenerateAzureGroupDisplayName(name string) string {
+	return DefaultGroupNaming().DisplayName(name)
+}
+
+// GenerateAzureGroupMailPrefix returns the mail nickname of a capability group using the default naming.
+func GenerateAzureGroupMailPrefix(name string) string {
+	return DefaultGroupNaming().MailNickname(name)
+}
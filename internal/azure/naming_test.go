@@ -0,0 +1,45 @@
+package azure
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestGroupNaming(t *testing.T) {
+	naming := DefaultGroupNaming()
+	assert.Equal(t, "CI_SSU_Cap - cap-a", naming.DisplayName("cap-a"))
+	assert.Equal(t, "ci-ssu_cap_cap-a", naming.MailNickname("cap-a"))
+	assert.Equal(t, "CI_SSU_Cap -", naming.Prefix())
+	assert.True(t, naming.IsCapabilityGroup("CI_SSU_Cap - cap-a"))
+	assert.False(t, naming.IsCapabilityGroup("Some other group"))
+	// Only the full template with a root id is a capability group, not anything starting with the prefix.
+	assert.False(t, naming.IsCapabilityGroup("CI_SSU_Cap - "))
+	assert.False(t, naming.IsCapabilityGroup("CI_SSU_Cap -cap-a"))
+	assert.False(t, naming.IsCapabilityGroup("CI_SSU_Cap - cap-a admins"))
+	assert.False(t, naming.IsCapabilityGroup("CI_SSU_Cap - cap-a (owners)"))
+
+	rootId, ok := naming.RootId("CI_SSU_Cap - cap-a")
+	assert.True(t, ok)
+	assert.Equal(t, "cap-a", rootId)
+
+	_, ok = naming.RootId("CI_SSU_Cap - ")
+	assert.False(t, ok)
+
+	naming, err := NewGroupNaming("Sandbox [{rootId}]", "sandbox-{rootId}", "Sandbox capability group")
+	assert.NoError(t, err)
+	assert.Equal(t, "Sandbox [cap-a]", naming.DisplayName("cap-a"))
+	assert.Equal(t, "Sandbox [", naming.Prefix())
+	rootId, ok = naming.RootId("Sandbox [cap-a]")
+	assert.True(t, ok)
+	assert.Equal(t, "cap-a", rootId)
+	_, ok = naming.RootId("Sandbox [cap-a")
+	assert.False(t, ok)
+
+	_, err = NewGroupNaming("CI_SSU_Cap", "ci-ssu_cap_{rootId}", "")
+	assert.Error(t, err)
+	_, err = NewGroupNaming("{rootId}", "ci-ssu_cap_{rootId}", "")
+	assert.Error(t, err)
+	_, err = NewGroupNaming("CI_SSU_Cap - {rootId}", "ci-ssu_cap_{rootId}_{rootId}", "")
+	assert.Error(t, err)
+}
@@ -0,0 +1,161 @@
+package azure
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// QueryOptions are the OData query parameters supported by list calls. Zero values are omitted from the request.
+type QueryOptions struct {
+	Top    int
+	Select []string
+	Filter string
+	Count  bool // adds $count=true and ConsistencyLevel: eventual, which Graph requires for advanced queries
+}
+
+func (o *QueryOptions) apply(req *http.Request) {
+	if o == nil {
+		return
+	}
+
+	urlQueryValues := req.URL.Query()
+	if o.Top > 0 {
+		urlQueryValues.Set("$top", strconv.Itoa(o.Top))
+	}
+	if len(o.Select) > 0 {
+		urlQueryValues.Set("$select", strings.Join(o.Select, ","))
+	}
+	if o.Filter != "" {
+		urlQueryValues.Set("$filter", o.Filter)
+	}
+	if o.Count {
+		urlQueryValues.Set("$count", "true")
+		req.Header.Set("ConsistencyLevel", "eventual")
+	}
+	req.URL.RawQuery = urlQueryValues.Encode()
+}
+
+type pageResponse[T any] struct {
+	OdataContext   string `json:"@odata.context"`
+	OdataNextLink  string `json:"@odata.nextLink,omitempty"`
+	OdataDeltaLink string `json:"@odata.deltaLink,omitempty"`
+	Value          []T    `json:"value"`
+}
+
+// Pager iterates over the pages of a Microsoft Graph collection by following @odata.nextLink.
+// Pages are only requested when asked for, so large collections can be streamed with ForEach.
+type Pager[T any] struct {
+	client    *Client
+	options   *QueryOptions
+	nextLink  string
+	deltaLink string
+	started   bool
+}
+
+func newPager[T any](client *Client, url string, options *QueryOptions) *Pager[T] {
+	return &Pager[T]{
+		client:   client,
+		options:  options,
+		nextLink: url,
+	}
+}
+
+func (p *Pager[T]) HasMorePages() bool {
+	return p.nextLink != ""
+}
+
+// DeltaLink is the @odata.deltaLink returned on the last page of a delta query. It is empty until all pages have been retrieved.
+func (p *Pager[T]) DeltaLink() string {
+	return p.deltaLink
+}
+
+// NextPage retrieves the next page. The query options are only applied to the first request, Graph carries them over in nextLink.
+func (p *Pager[T]) NextPage(ctx context.Context) ([]T, error) {
+	if !p.HasMorePages() {
+		return nil, nil
+	}
+
+	req, err := http.NewRequestWithContext(ctx, "GET", p.nextLink, nil)
+	if err != nil {
+		return nil, err
+	}
+	err = p.client.prepareHttpRequest(req)
+	if err != nil {
+		return nil, err
+	}
+
+	if !p.started {
+		p.options.apply(req)
+		p.started = true
+	}
+
+	resp, err := p.client.httpClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+
+	defer resp.Body.Close()
+
+	rawData, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+
+	if resp.StatusCode == http.StatusGone {
+		return nil, DeltaTokenExpired.New("Delta token has expired, a full sync is required")
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, HttpError.Wrap(ApiError{resp.StatusCode}, fmt.Sprintf("Unexpected HTTP response when listing %s. Status code: %d", req.URL.Path, resp.StatusCode))
+	}
+
+	var payload pageResponse[T]
+
+	err = json.Unmarshal(rawData, &payload)
+	if err != nil {
+		return nil, err
+	}
+
+	p.nextLink = payload.OdataNextLink
+	p.deltaLink = payload.OdataDeltaLink
+
+	return payload.Value, nil
+}
+
+// ForEach calls fn for every item in the collection, requesting pages as needed. Iteration stops at the first error returned by fn.
+func (p *Pager[T]) ForEach(ctx context.Context, fn func(item T) error) error {
+	for p.HasMorePages() {
+		page, err := p.NextPage(ctx)
+		if err != nil {
+			return err
+		}
+
+		for _, item := range page {
+			err = fn(item)
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+// All retrieves every remaining page and returns the combined items.
+func (p *Pager[T]) All(ctx context.Context) ([]T, error) {
+	payload := []T{}
+	for p.HasMorePages() {
+		page, err := p.NextPage(ctx)
+		if err != nil {
+			return nil, err
+		}
+		payload = append(payload, page...)
+	}
+
+	return payload, nil
+}
@@ -0,0 +1,116 @@
+package azure
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/joomcode/errorx"
+	"github.com/stretchr/testify/assert"
+	"go.dfds.cloud/aad-finout-sync/internal/util"
+)
+
+func newPagerTestClient() *Client {
+	az := NewAzureClient(azureTestConfig)
+	az.tokenClient = util.NewTokenClient(func() (*util.RefreshAuthResponse, error) {
+		return &util.RefreshAuthResponse{
+			ExpiresIn:   time.Now().Add(time.Minute * 100).Unix(),
+			AccessToken: "dummy",
+		}, nil
+	})
+
+	return az
+}
+
+func newPagerTestServer(t *testing.T, pages [][]GroupMembersMember) (*httptest.Server, *[]*http.Request) {
+	var requests []*http.Request
+	var server *httptest.Server
+	server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests = append(requests, r)
+
+		page := 0
+		if val := r.URL.Query().Get("page"); val != "" {
+			fmt.Sscanf(val, "%d", &page)
+		}
+
+		payload := pageResponse[GroupMembersMember]{Value: pages[page]}
+		if page+1 < len(pages) {
+			payload.OdataNextLink = fmt.Sprintf("%s/members?page=%d", server.URL, page+1)
+		}
+
+		err := json.NewEncoder(w).Encode(payload)
+		assert.NoError(t, err)
+	}))
+
+	return server, &requests
+}
+
+func TestPager_All(t *testing.T) {
+	server, requests := newPagerTestServer(t, [][]GroupMembersMember{
+		{{ID: "1"}, {ID: "2"}},
+		{{ID: "3"}},
+		{{ID: "4"}},
+	})
+	defer server.Close()
+
+	pager := newPager[GroupMembersMember](newPagerTestClient(), server.URL+"/members", &QueryOptions{Top: 2, Select: []string{"id", "mail"}})
+	members, err := pager.All(context.Background())
+	assert.NoError(t, err)
+	assert.Len(t, members, 4)
+	assert.Equal(t, "4", members[3].ID)
+	assert.False(t, pager.HasMorePages())
+
+	assert.Len(t, *requests, 3)
+	assert.Equal(t, "2", (*requests)[0].URL.Query().Get("$top"))
+	assert.Equal(t, "id,mail", (*requests)[0].URL.Query().Get("$select"))
+	assert.Equal(t, "Bearer dummy", (*requests)[0].Header.Get("Authorization"))
+	assert.Equal(t, "", (*requests)[1].URL.Query().Get("$top"))
+}
+
+func TestPager_ForEachStopsOnError(t *testing.T) {
+	server, requests := newPagerTestServer(t, [][]GroupMembersMember{
+		{{ID: "1"}},
+		{{ID: "2"}},
+		{{ID: "3"}},
+	})
+	defer server.Close()
+
+	stop := fmt.Errorf("stop")
+	var seen []string
+	err := newPager[GroupMembersMember](newPagerTestClient(), server.URL+"/members", nil).ForEach(context.Background(), func(item GroupMembersMember) error {
+		seen = append(seen, item.ID)
+		if item.ID == "2" {
+			return stop
+		}
+		return nil
+	})
+	assert.ErrorIs(t, err, stop)
+	assert.Equal(t, []string{"1", "2"}, seen)
+	assert.Len(t, *requests, 2)
+}
+
+func TestPager_UnexpectedStatusCode(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusForbidden)
+	}))
+	defer server.Close()
+
+	_, err := newPager[GroupMembersMember](newPagerTestClient(), server.URL, nil).All(context.Background())
+	assert.Error(t, err)
+	assert.True(t, errorx.IsOfType(err, HttpError))
+}
+
+func TestPager_Cancelled(t *testing.T) {
+	server, _ := newPagerTestServer(t, [][]GroupMembersMember{{{ID: "1"}}})
+	defer server.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	_, err := newPager[GroupMembersMember](newPagerTestClient(), server.URL+"/members", nil).All(ctx)
+	assert.ErrorIs(t, err, context.Canceled)
+}
@@ -0,0 +1,83 @@
+package azure
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+)
+
+// UserResolverSelect is the set of properties requested when resolving users.
+var UserResolverSelect = []string{"id", "displayName", "userPrincipalName", "mail", "proxyAddresses", "accountEnabled"}
+
+// UserResolver finds the user an email address belongs to, by mail, user principal name or proxy addresses.
+// Results, including users that weren't found, are cached for the lifetime of the resolver, so a resolver should be created per run.
+type UserResolver struct {
+	client *Client
+	mu     sync.Mutex
+	cache  map[string]*UsersListResponseUser
+}
+
+func NewUserResolver(client *Client) *UserResolver {
+	return &UserResolver{
+		client: client,
+		cache:  make(map[string]*UsersListResponseUser),
+	}
+}
+
+// Resolve returns the user for email. AdUserNotFound is returned if there is no such user.
+// If several users match, a match on mail is preferred over user principal name, which is preferred over proxy addresses.
+func (r *UserResolver) Resolve(ctx context.Context, email string) (*UsersListResponseUser, error) {
+	key := strings.ToLower(strings.TrimSpace(email))
+
+	r.mu.Lock()
+	user, cached := r.cache[key]
+	r.mu.Unlock()
+
+	if !cached {
+		var err error
+		user, err = r.lookup(ctx, key)
+		if err != nil {
+			return nil, err
+		}
+
+		r.mu.Lock()
+		r.cache[key] = user
+		r.mu.Unlock()
+	}
+
+	if user == nil {
+		return nil, AdUserNotFound.New(fmt.Sprintf("User %s not found", email))
+	}
+
+	return user, nil
+}
+
+func (r *UserResolver) lookup(ctx context.Context, email string) (*UsersListResponseUser, error) {
+	escaped := strings.ReplaceAll(email, "'", "''")
+	filter := fmt.Sprintf("mail eq '%s' or userPrincipalName eq '%s' or proxyAddresses/any(p:p eq 'smtp:%s')", escaped, escaped, escaped)
+
+	users, err := r.client.ListUsers(&QueryOptions{Filter: filter, Select: UserResolverSelect, Count: true}).All(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	var byUpn, byProxy *UsersListResponseUser
+	for _, user := range users {
+		if strings.EqualFold(user.Mail, email) {
+			return user, nil
+		}
+		if byUpn == nil && strings.EqualFold(user.UserPrincipalName, email) {
+			byUpn = user
+		}
+		if byProxy == nil && user.HasProxyAddress(email) {
+			byProxy = user
+		}
+	}
+
+	if byUpn != nil {
+		return byUpn, nil
+	}
+
+	return byProxy, nil
+}
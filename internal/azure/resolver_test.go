@@ -0,0 +1,56 @@
+package azure
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/joomcode/errorx"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestUserResolver_Resolve(t *testing.T) {
+	requests := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests = requests + 1
+		assert.Equal(t, "/v1.0/users", r.URL.Path)
+		assert.Equal(t, "eventual", r.Header.Get("ConsistencyLevel"))
+		assert.Equal(t, "true", r.URL.Query().Get("$count"))
+
+		switch r.URL.Query().Get("$filter") {
+		case "mail eq 'alice@example.com' or userPrincipalName eq 'alice@example.com' or proxyAddresses/any(p:p eq 'smtp:alice@example.com')":
+			// The alias of another user is returned as well, the mail match wins.
+			fmt.Fprint(w, `{"value":[{"id":"other","userPrincipalName":"other@example.com","proxyAddresses":["smtp:alice@example.com"]},{"id":"alice","userPrincipalName":"alice.a@example.onmicrosoft.com","mail":"Alice@example.com"}]}`)
+		case "mail eq 'bob.alias@example.com' or userPrincipalName eq 'bob.alias@example.com' or proxyAddresses/any(p:p eq 'smtp:bob.alias@example.com')":
+			fmt.Fprint(w, `{"value":[{"id":"bob","userPrincipalName":"bob@example.com","mail":"bob@example.com","proxyAddresses":["SMTP:bob@example.com","smtp:bob.alias@example.com"]}]}`)
+		case "mail eq 'o''brien@example.com' or userPrincipalName eq 'o''brien@example.com' or proxyAddresses/any(p:p eq 'smtp:o''brien@example.com')":
+			fmt.Fprint(w, `{"value":[]}`)
+		default:
+			t.Errorf("unexpected filter %s", r.URL.Query().Get("$filter"))
+			w.WriteHeader(http.StatusBadRequest)
+		}
+	}))
+	defer server.Close()
+
+	resolver := NewUserResolver(newBatchTestClient(server))
+
+	user, err := resolver.Resolve(context.Background(), "Alice@example.com")
+	assert.NoError(t, err)
+	assert.Equal(t, "alice", user.ID)
+
+	user, err = resolver.Resolve(context.Background(), "bob.alias@example.com")
+	assert.NoError(t, err)
+	assert.Equal(t, "bob", user.ID)
+
+	_, err = resolver.Resolve(context.Background(), "o'brien@example.com")
+	assert.True(t, errorx.IsOfType(err, AdUserNotFound))
+
+	// Results are cached, including users that weren't found.
+	_, err = resolver.Resolve(context.Background(), "alice@example.com")
+	assert.NoError(t, err)
+	_, err = resolver.Resolve(context.Background(), "o'brien@example.com")
+	assert.True(t, errorx.IsOfType(err, AdUserNotFound))
+	assert.Equal(t, 3, requests)
+}
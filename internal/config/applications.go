@@ -0,0 +1,60 @@
+package config
+
+import (
+	"encoding/json"
+	"fmt"
+)
+
+// DefaultApplicationRoleName is the app role assigned to groups when no role name is configured.
+const DefaultApplicationRoleName = "User"
+
+// TargetApplication is an enterprise application that capability groups are assigned to.
+type TargetApplication struct {
+	AppId       string `json:"appId"`
+	ObjectId    string `json:"objectId"`    // object id of the service principal
+	RoleName    string `json:"roleName"`    // display name of the app role to assign
+	GroupFilter string `json:"groupFilter"` // display name prefix of the groups to assign, all capability groups if empty
+	// ExcludedAssignments are ids or display names of capability groups assigned to this application by hand, in addition to Azure.ExcludedAssignments
+	ExcludedAssignments []string `json:"excludedAssignments"`
+}
+
+// TargetApplications is decoded from a JSON array, e.g. AFS_AZURE_APPLICATIONS='[{"appId": "...", "objectId": "...", "roleName": "User"}]'.
+type TargetApplications []TargetApplication
+
+func (a *TargetApplications) Decode(value string) error {
+	var apps []TargetApplication
+	err := json.Unmarshal([]byte(value), &apps)
+	if err != nil {
+		return fmt.Errorf("unable to parse target applications: %w", err)
+	}
+
+	for i, app := range apps {
+		if app.AppId == "" || app.ObjectId == "" {
+			return fmt.Errorf("target application %d is missing appId or objectId", i)
+		}
+		if app.RoleName == "" {
+			apps[i].RoleName = DefaultApplicationRoleName
+		}
+	}
+
+	*a = apps
+	return nil
+}
+
+// TargetApplications returns the applications capability groups are assigned to. If none are configured,
+// the application set by ApplicationId and ApplicationObjectId is used, as it was before multiple applications were supported.
+func (c Config) TargetApplications() []TargetApplication {
+	if len(c.Azure.Applications) > 0 {
+		return c.Azure.Applications
+	}
+
+	if c.Azure.ApplicationId == "" && c.Azure.ApplicationObjectId == "" {
+		return nil
+	}
+
+	return []TargetApplication{{
+		AppId:    c.Azure.ApplicationId,
+		ObjectId: c.Azure.ApplicationObjectId,
+		RoleName: DefaultApplicationRoleName,
+	}}
+}
@@ -1,6 +1,8 @@
 package config
 
 import (
+	"time"
+
 	"github.com/kelseyhightower/envconfig"
 )
 
@@ -27,17 +29,68 @@ type Config struct {
 		RootOrganizationsParentId string `json:"rootOrganizationsParentId"`
 	} `json:"aws"`
 	Azure struct {
-		TenantId            string `json:"tenantId"`
-		ClientId            string `json:"clientId"`
-		ClientSecret        string `json:"clientSecret"`
-		ApplicationId       string `json:"applicationId"`
-		ApplicationObjectId string `json:"applicationObjectId"`
+		TenantId            string             `json:"tenantId"`
+		ClientId            string             `json:"clientId"`
+		ClientSecret        string             `json:"clientSecret"`
+		ApplicationId       string             `json:"applicationId"`
+		ApplicationObjectId string             `json:"applicationObjectId"`
+		Applications        TargetApplications `json:"applications"`
+		Auth                ClientAuth         `json:"auth"`
+		GraphEndpoint       string             `json:"graphEndpoint" default:"https://graph.microsoft.com"`
+		LoginEndpoint       string             `json:"loginEndpoint" default:"https://login.microsoftonline.com"`
+		Delta               struct {
+			Enabled            bool          `json:"enabled"`
+			StateFile          string        `json:"stateFile"`
+			FullResyncInterval time.Duration `json:"fullResyncInterval" default:"24h"`
+		} `json:"delta"`
+		Groups struct {
+			// Empty values fall back to the Default* constants of the azure package
+			AdministrativeUnit   string `json:"administrativeUnit"`
+			DisplayNameTemplate  string `json:"displayNameTemplate"`
+			MailNicknameTemplate string `json:"mailNicknameTemplate"`
+			Description          string `json:"description"`
+		} `json:"groups"`
+		Invitations struct {
+			Enabled        bool     `json:"enabled"`
+			AllowedDomains []string `json:"allowedDomains"`
+			RedirectUrl    string   `json:"redirectUrl" default:"https://myapplications.microsoft.com"`
+			SendMessage    bool     `json:"sendMessage" default:"true"`
+			StateFile      string   `json:"stateFile"`
+		} `json:"invitations"`
+		ExcludedAssignments []string `json:"excludedAssignments"` // ids or display names of groups assigned to every application by hand
+		AllowEmptyGroups    bool     `json:"allowEmptyGroups"`    // remove all capability group assignments of an application if no groups match its filter
+		SyncOwners          bool     `json:"syncOwners"`          // make capability owners owners of their group
+		OrphanGroups        struct {
+			Enabled     bool          `json:"enabled"`
+			EmptyAfter  time.Duration `json:"emptyAfter" default:"168h"`
+			GracePeriod time.Duration `json:"gracePeriod" default:"720h"`
+			MaxShare    float64       `json:"maxShare" default:"0.5"` // share of the groups that may be newly orphaned in one run
+			AllowEmpty  bool          `json:"allowEmpty"`             // retire groups even if no capabilities are returned or more than MaxShare would be orphaned
+		} `json:"orphanGroups"`
+		CredentialExpiry struct {
+			Enabled    bool     `json:"enabled"`
+			Thresholds []int    `json:"thresholds" default:"30,14,7,1"` // days before expiry at which to notify
+			AppIds     []string `json:"appIds"`                         // defaults to the client and the target applications
+			StateFile  string   `json:"stateFile"`                      // thresholds notified about per credential, kept in memory if empty
+		} `json:"credentialExpiry"`
 	} `json:"azure"`
 	CapSvc struct { // Capability-Service
-		Host         string `json:"host"`
-		TokenScope   string `json:"tokenScope"`
-		ClientId     string `json:"clientId"`
-		ClientSecret string `json:"clientSecret"`
+		Host         string     `json:"host"`
+		TokenScope   string     `json:"tokenScope"`
+		ClientId     string     `json:"clientId"`
+		ClientSecret string     `json:"clientSecret"`
+		Auth         ClientAuth `json:"auth"`
+		Paths        struct {
+			Layout       string `json:"layout" default:"legacy"` // "legacy" or "rest"; the paths below override the layout's
+			Capabilities string `json:"capabilities"`
+			Members      string `json:"members"`
+			AwsAccount   string `json:"awsAccount"`
+			Metadata     string `json:"metadata"`
+		} `json:"paths"`
+		Metadata struct {
+			Concurrency int           `json:"concurrency" default:"8"`
+			CacheTtl    time.Duration `json:"cacheTtl" default:"5m"` // metadata fetched by any handler within this time isn't requested again
+		} `json:"metadata"`
 	} `json:"capSvc"`
 	Finout struct {
 		Username     string `json:"username"`
@@ -45,7 +98,41 @@ type Config struct {
 		MfaUrl       string `json:"mfaUrl"`
 		ClientId     string `json:"clientId"`
 		ClientSecret string `json:"clientSecret"`
+		Views        struct {
+			UntaggedByAccount string `json:"untaggedByAccount"`
+			CostByCostCentre  string `json:"costByCostCentre"`
+			CostByCapability  string `json:"costByCapability"`
+		} `json:"views"`
+		Metrics struct {
+			MaxSeries int `json:"maxSeries" default:"50"`
+		} `json:"metrics"`
 	}
+	Smtp struct {
+		Host     string `json:"host"`
+		Port     int    `json:"port" default:"25"`
+		Username string `json:"username"`
+		Password string `json:"password"`
+		From     string `json:"from"`
+		StartTls bool   `json:"startTls"`
+	} `json:"smtp"`
+	Notify struct {
+		WebhookUrl string   `json:"webhookUrl"`
+		Recipients []string `json:"recipients"` // sent using the Smtp settings
+	} `json:"notify"`
+	Digest struct {
+		Enabled           bool   `json:"enabled"`
+		DayOfMonth        int    `json:"dayOfMonth" default:"1"`
+		ViewId            string `json:"viewId"`
+		GroupSeparator    string `json:"groupSeparator" default:" / "`
+		TopDrivers        int    `json:"topDrivers" default:"5"`
+		Currency          string `json:"currency" default:"USD"`
+		TemplateDir       string `json:"templateDir"`
+		FinoutUrlTemplate string `json:"finoutUrlTemplate"`
+		StateFile         string `json:"stateFile"` // capabilities sent a digest, kept in memory if empty
+	} `json:"digest"`
+	Attribution struct {
+		MajorityThreshold float64 `json:"majorityThreshold" default:"0.5"` // share of members a department needs to exceed to be considered the capability's department
+	} `json:"attribution"`
 	Log struct {
 		Level string `json:"level"`
 		Debug bool   `json:"debug"`
@@ -55,6 +142,14 @@ type Config struct {
 	}
 }
 
+// ClientAuth selects how a client authenticates when requesting tokens. Method is "secret", "certificate" or "federated".
+type ClientAuth struct {
+	Method             string `json:"method" default:"secret"`
+	CertificatePath    string `json:"certificatePath"`
+	PrivateKeyPath     string `json:"privateKeyPath"`
+	FederatedTokenFile string `json:"federatedTokenFile"`
+}
+
 const APP_CONF_PREFIX = "AFS"
 
 func LoadConfig() (Config, error) {
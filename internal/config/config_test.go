@@ -18,3 +18,35 @@ func TestLoadConfig(t *testing.T) {
 
 	t.Log(string(serialised))
 }
+
+func TestTargetApplications(t *testing.T) {
+	var conf Config
+	conf.Azure.ApplicationId = "legacy-app"
+	conf.Azure.ApplicationObjectId = "legacy-object"
+
+	apps := conf.TargetApplications()
+	if len(apps) != 1 || apps[0].AppId != "legacy-app" || apps[0].RoleName != DefaultApplicationRoleName || apps[0].GroupFilter != "" {
+		t.Fatalf("unexpected legacy fallback: %+v", apps)
+	}
+
+	err := conf.Azure.Applications.Decode(`[{"appId": "aws", "objectId": "aws-sp"}, {"appId": "finout", "objectId": "finout-sp", "roleName": "msiam_access", "groupFilter": "CI_SSU_Cap - finance"}]`)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	apps = conf.TargetApplications()
+	if len(apps) != 2 {
+		t.Fatalf("expected 2 applications, got %d", len(apps))
+	}
+	if apps[0].RoleName != DefaultApplicationRoleName || apps[0].GroupFilter != "" {
+		t.Errorf("defaults not applied: %+v", apps[0])
+	}
+	if apps[1].RoleName != "msiam_access" || apps[1].GroupFilter != "CI_SSU_Cap - finance" {
+		t.Errorf("unexpected application: %+v", apps[1])
+	}
+
+	err = conf.Azure.Applications.Decode(`[{"appId": "aws"}]`)
+	if err == nil {
+		t.Error("expected an error for an application without objectId")
+	}
+}
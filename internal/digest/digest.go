@@ -0,0 +1,173 @@
+package digest
+
+import (
+	"bytes"
+	"embed"
+	"errors"
+	"fmt"
+	htmlTemplate "html/template"
+	"math"
+	"os"
+	"path/filepath"
+	"strings"
+	textTemplate "text/template"
+	"time"
+)
+
+//go:embed templates/*.tmpl
+var defaultTemplates embed.FS
+
+const (
+	SubjectTemplateName = "subject.tmpl"
+	TextTemplateName    = "body.txt.tmpl"
+	HtmlTemplateName    = "body.html.tmpl"
+)
+
+type Digest struct {
+	Capability     Capability
+	Period         time.Time
+	PreviousPeriod time.Time
+	Spend          float64
+	PreviousSpend  float64
+	HasPrevious    bool
+	Drivers        []Driver
+	FinoutUrl      string
+}
+
+type Capability struct {
+	Id     string
+	RootId string
+	Name   string
+}
+
+type Driver struct {
+	Name string
+	Cost float64
+}
+
+// Trend returns the change in spend compared to the previous period, in percent.
+func (d Digest) Trend() float64 {
+	if !d.HasPrevious || d.PreviousSpend == 0 {
+		return 0
+	}
+
+	return (d.Spend - d.PreviousSpend) / d.PreviousSpend * 100
+}
+
+type Rendered struct {
+	Subject string
+	Text    string
+	Html    string
+}
+
+type Renderer struct {
+	subject *textTemplate.Template
+	text    *textTemplate.Template
+	html    *htmlTemplate.Template
+}
+
+func (r *Renderer) Render(d Digest) (*Rendered, error) {
+	var subject, text, html bytes.Buffer
+
+	err := r.subject.Execute(&subject, d)
+	if err != nil {
+		return nil, err
+	}
+
+	err = r.text.Execute(&text, d)
+	if err != nil {
+		return nil, err
+	}
+
+	err = r.html.Execute(&html, d)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Rendered{
+		Subject: strings.TrimSpace(subject.String()),
+		Text:    text.String(),
+		Html:    html.String(),
+	}, nil
+}
+
+func formatMoney(currency string) func(float64) string {
+	return func(val float64) string {
+		return strings.TrimSpace(fmt.Sprintf("%.2f %s", val, currency))
+	}
+}
+
+func formatTrend(d Digest) string {
+	if d.PreviousSpend == 0 {
+		return "no spend in the previous month"
+	}
+
+	trend := d.Trend()
+	switch {
+	case math.Abs(trend) < 0.5:
+		return "flat compared to the previous month"
+	case trend > 0:
+		return fmt.Sprintf("up %.0f%% compared to the previous month", trend)
+	default:
+		return fmt.Sprintf("down %.0f%% compared to the previous month", math.Abs(trend))
+	}
+}
+
+// loadTemplate returns the template with the given name from templateDir, falling back to the embedded default if templateDir is empty or doesn't contain it.
+func loadTemplate(templateDir string, name string) (string, error) {
+	if templateDir != "" {
+		data, err := os.ReadFile(filepath.Join(templateDir, name))
+		if err == nil {
+			return string(data), nil
+		}
+		if !errors.Is(err, os.ErrNotExist) {
+			return "", err
+		}
+	}
+
+	data, err := defaultTemplates.ReadFile(fmt.Sprintf("templates/%s", name))
+	if err != nil {
+		return "", err
+	}
+
+	return string(data), nil
+}
+
+// NewRenderer parses the digest templates. Templates found in templateDir override the embedded defaults.
+func NewRenderer(templateDir string, currency string) (*Renderer, error) {
+	textFuncs := textTemplate.FuncMap{"money": formatMoney(currency), "trend": formatTrend}
+	htmlFuncs := htmlTemplate.FuncMap{"money": formatMoney(currency), "trend": formatTrend}
+
+	subjectRaw, err := loadTemplate(templateDir, SubjectTemplateName)
+	if err != nil {
+		return nil, err
+	}
+	subject, err := textTemplate.New(SubjectTemplateName).Funcs(textFuncs).Parse(subjectRaw)
+	if err != nil {
+		return nil, err
+	}
+
+	textRaw, err := loadTemplate(templateDir, TextTemplateName)
+	if err != nil {
+		return nil, err
+	}
+	text, err := textTemplate.New(TextTemplateName).Funcs(textFuncs).Parse(textRaw)
+	if err != nil {
+		return nil, err
+	}
+
+	htmlRaw, err := loadTemplate(templateDir, HtmlTemplateName)
+	if err != nil {
+		return nil, err
+	}
+	html, err := htmlTemplate.New(HtmlTemplateName).Funcs(htmlFuncs).Parse(htmlRaw)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Renderer{
+		subject: subject,
+		text:    text,
+		html:    html,
+	}, nil
+}
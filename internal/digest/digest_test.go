@@ -0,0 +1,73 @@
+package digest
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"go.dfds.cloud/aad-finout-sync/internal/finout"
+)
+
+var testDigest = Digest{
+	Capability:     Capability{Id: "dummy-abcde", RootId: "dummy-abcde", Name: "Dummy"},
+	Period:         time.Date(2026, time.September, 1, 0, 0, 0, 0, time.UTC),
+	PreviousPeriod: time.Date(2026, time.August, 1, 0, 0, 0, 0, time.UTC),
+	Spend:          150,
+	PreviousSpend:  100,
+	HasPrevious:    true,
+	Drivers:        []Driver{{Name: "AmazonEC2", Cost: 100}, {Name: "AmazonS3", Cost: 50}},
+	FinoutUrl:      "https://app.finout.io/app/total-cost?capability=dummy-abcde",
+}
+
+func TestDigest_Trend(t *testing.T) {
+	assert.Equal(t, float64(50), testDigest.Trend())
+
+	d := testDigest
+	d.PreviousSpend = 0
+	assert.Equal(t, float64(0), d.Trend())
+}
+
+func TestRenderer_RenderDefaults(t *testing.T) {
+	r, err := NewRenderer("", "USD")
+	assert.NoError(t, err)
+
+	rendered, err := r.Render(testDigest)
+	assert.NoError(t, err)
+	assert.Equal(t, "Dummy - cloud spend for September 2026", rendered.Subject)
+	assert.Contains(t, rendered.Text, "150.00 USD")
+	assert.Contains(t, rendered.Text, "up 50% compared to the previous month")
+	assert.Contains(t, rendered.Text, "AmazonEC2: 100.00 USD")
+	assert.Contains(t, rendered.Html, `<a href="https://app.finout.io/app/total-cost?capability=dummy-abcde">`)
+}
+
+func TestRenderer_RenderOverride(t *testing.T) {
+	dir := t.TempDir()
+	err := os.WriteFile(filepath.Join(dir, SubjectTemplateName), []byte("Overridden {{.Capability.RootId}}"), 0644)
+	assert.NoError(t, err)
+
+	r, err := NewRenderer(dir, "EUR")
+	assert.NoError(t, err)
+
+	rendered, err := r.Render(testDigest)
+	assert.NoError(t, err)
+	assert.Equal(t, "Overridden dummy-abcde", rendered.Subject)
+	assert.Contains(t, rendered.Text, "150.00 EUR")
+}
+
+func TestSummariseByCapability(t *testing.T) {
+	data := []finout.QueryByViewResponseData{
+		{Name: "cap-a / AmazonEC2", Data: []finout.QueryByViewResponseDataData{{Cost: 10}, {Cost: 20}}},
+		{Name: "cap-a / AmazonS3", Data: []finout.QueryByViewResponseDataData{{Cost: 5}}},
+		{Name: "cap-a / AmazonRDS", Data: []finout.QueryByViewResponseDataData{{Cost: 7}}},
+		{Name: "cap-b", Data: []finout.QueryByViewResponseDataData{{Cost: 3}}},
+	}
+
+	summaries := SummariseByCapability(data, " / ", 2)
+	assert.Len(t, summaries, 2)
+	assert.Equal(t, float64(42), summaries["cap-a"].Spend)
+	assert.Equal(t, []Driver{{Name: "AmazonEC2", Cost: 30}, {Name: "AmazonRDS", Cost: 7}}, summaries["cap-a"].Drivers)
+	assert.Equal(t, float64(3), summaries["cap-b"].Spend)
+	assert.Empty(t, summaries["cap-b"].Drivers)
+}
@@ -0,0 +1,58 @@
+package digest
+
+import (
+	"sort"
+	"strings"
+
+	"go.dfds.cloud/aad-finout-sync/internal/finout"
+)
+
+type Summary struct {
+	Spend   float64
+	Drivers []Driver
+}
+
+// SummariseByCapability aggregates Finout series named "<capability><separator><cost driver>" into a Summary per capability.
+// Series without the separator are attributed to the capability as a whole.
+func SummariseByCapability(data []finout.QueryByViewResponseData, separator string, topDrivers int) map[string]*Summary {
+	driversByCapability := make(map[string]map[string]float64)
+	payload := make(map[string]*Summary)
+
+	for _, series := range data {
+		capability := strings.TrimSpace(series.Name)
+		driver := ""
+		if separator != "" {
+			if parts := strings.SplitN(series.Name, separator, 2); len(parts) == 2 {
+				capability = strings.TrimSpace(parts[0])
+				driver = strings.TrimSpace(parts[1])
+			}
+		}
+
+		if _, exists := payload[capability]; !exists {
+			payload[capability] = &Summary{Drivers: []Driver{}}
+			driversByCapability[capability] = make(map[string]float64)
+		}
+
+		cost := series.TotalCost()
+		payload[capability].Spend = payload[capability].Spend + cost
+		if driver != "" {
+			driversByCapability[capability][driver] = driversByCapability[capability][driver] + cost
+		}
+	}
+
+	for capability, drivers := range driversByCapability {
+		for name, cost := range drivers {
+			payload[capability].Drivers = append(payload[capability].Drivers, Driver{Name: name, Cost: cost})
+		}
+
+		sort.Slice(payload[capability].Drivers, func(i, j int) bool {
+			return payload[capability].Drivers[i].Cost > payload[capability].Drivers[j].Cost
+		})
+
+		if topDrivers > 0 && len(payload[capability].Drivers) > topDrivers {
+			payload[capability].Drivers = payload[capability].Drivers[:topDrivers]
+		}
+	}
+
+	return payload
+}
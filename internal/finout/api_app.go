@@ -108,6 +108,35 @@ func (a *ApiApp) ListVirtualTags(ctx context.Context) (map[string]*ListVirtualTa
 	return tags, nil
 }
 
+func (a *ApiApp) GetVirtualTag(ctx context.Context, id string) (*GetVirtualTagResponse, error) {
+	req, err := http.NewRequestWithContext(ctx, "GET", fmt.Sprintf("%s/virtual-tags-service/virtual-tag/%s", APP_API_ENDPOINT, id), nil)
+	if err != nil {
+		return nil, err
+	}
+	err = a.client.prepareHttpRequest(req)
+	if err != nil {
+		return nil, err
+	}
+
+	query := req.URL.Query()
+	query.Set("dataFormat", "UI")
+	req.URL.RawQuery = query.Encode()
+
+	rf := NewRequestFuncs()
+	rf.PostResponse = func(req *http.Request, resp *http.Response) error {
+		if resp.StatusCode != 200 {
+			return fmt.Errorf("response returned unexpected status code: %d", resp.StatusCode)
+		}
+		return nil
+	}
+	payload, err := DoRequest[GetVirtualTagResponse](a.client, req, rf)
+	if err != nil {
+		return nil, err
+	}
+
+	return payload, nil
+}
+
 func (a *ApiApp) CreateVirtualTag(ctx context.Context, requestPayload CreateVirtualTagRequest) (*CreateVirtualTagResponse, error) {
 	serialised, err := json.Marshal(requestPayload)
 	if err != nil {
@@ -159,6 +159,28 @@ type QueryByViewResponseData struct {
 	Data []QueryByViewResponseDataData `json:"data"`
 }
 
+func (q *QueryByViewResponseData) TotalCost() float64 {
+	var total float64
+	for _, entry := range q.Data {
+		total = total + entry.Cost
+	}
+
+	return total
+}
+
+// CostBetween returns the cost of the data points in the half-open interval [from, to).
+func (q *QueryByViewResponseData) CostBetween(from time.Time, to time.Time) float64 {
+	var total float64
+	for _, entry := range q.Data {
+		t := time.UnixMilli(entry.Time)
+		if !t.Before(from) && t.Before(to) {
+			total = total + entry.Cost
+		}
+	}
+
+	return total
+}
+
 type QueryByViewResponseDataData struct {
 	Time int64   `json:"time"`
 	Cost float64 `json:"cost"`
@@ -173,7 +195,20 @@ type QueryByViewResponseRequest struct {
 }
 
 type QueryByViewRequest struct {
-	ViewId string `json:"viewId"`
+	ViewId string                  `json:"viewId"`
+	Date   *QueryByViewRequestDate `json:"date,omitempty"`
+}
+
+type QueryByViewRequestDate struct {
+	UnixTimeMillSecondsStart int64 `json:"unixTimeMillSecondsStart"`
+	UnixTimeMillSecondsEnd   int64 `json:"unixTimeMillSecondsEnd"`
+}
+
+func NewQueryByViewRequestDate(from time.Time, to time.Time) *QueryByViewRequestDate {
+	return &QueryByViewRequestDate{
+		UnixTimeMillSecondsStart: from.UnixMilli(),
+		UnixTimeMillSecondsEnd:   to.UnixMilli(),
+	}
 }
 
 type ListGroupsResponse struct {
@@ -318,3 +353,54 @@ type UserLoginRequest struct {
 	Password        string `json:"password"`
 	InvitationToken string `json:"invitationToken"`
 }
+
+type GetVirtualTagResponse struct {
+	AccountID string                      `json:"accountId"`
+	Name      string                      `json:"name"`
+	Rules     []GetVirtualTagResponseRule `json:"rules"`
+	Category  string                      `json:"category"`
+	CreatedBy string                      `json:"createdBy"`
+	UpdatedBy string                      `json:"updatedBy"`
+	Default   struct {
+		Type  string `json:"type"`
+		Value string `json:"value"`
+	} `json:"default"`
+	CreatedAt string `json:"createdAt"`
+	UpdatedAt string `json:"updatedAt"`
+	ID        string `json:"id"`
+}
+
+type GetVirtualTagResponseRule struct {
+	To      string                          `json:"to"`
+	Filters GetVirtualTagResponseRuleFilter `json:"filters"`
+}
+
+// GetVirtualTagResponseRuleFilter is a single filter, or a combination of filters when And/Or is set.
+type GetVirtualTagResponseRuleFilter struct {
+	CostCenter string                            `json:"costCenter,omitempty"`
+	Key        string                            `json:"key,omitempty"`
+	Type       string                            `json:"type,omitempty"`
+	Operator   string                            `json:"operator,omitempty"`
+	Value      interface{}                       `json:"value,omitempty"`
+	Path       string                            `json:"path,omitempty"`
+	Name       string                            `json:"name,omitempty"`
+	And        []GetVirtualTagResponseRuleFilter `json:"and,omitempty"`
+	Or         []GetVirtualTagResponseRuleFilter `json:"or,omitempty"`
+}
+
+// Values returns the filter value as a list of strings. Finout returns a single string for operators like "is", and a list for "oneOf".
+func (f GetVirtualTagResponseRuleFilter) Values() []string {
+	switch v := f.Value.(type) {
+	case string:
+		return []string{v}
+	case []interface{}:
+		var payload []string
+		for _, val := range v {
+			if s, ok := val.(string); ok {
+				payload = append(payload, s)
+			}
+		}
+		return payload
+	}
+	return nil
+}
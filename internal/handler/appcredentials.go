@@ -0,0 +1,199 @@
+package handler
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"go.dfds.cloud/aad-finout-sync/internal/azure"
+	"go.dfds.cloud/aad-finout-sync/internal/config"
+	"go.dfds.cloud/aad-finout-sync/internal/notify"
+	"go.dfds.cloud/aad-finout-sync/internal/util"
+	"go.uber.org/zap"
+)
+
+const AppCredentialExpiryName = "appCredentialExpiry"
+
+const (
+	CredentialTypePassword    = "password"
+	CredentialTypeCertificate = "certificate"
+)
+
+// credentialExpired is the notification level of credentials that have already expired, below any threshold.
+const credentialExpired = -1
+
+var appCredentialExpiryDays *prometheus.GaugeVec = promauto.NewGaugeVec(prometheus.GaugeOpts{
+	Name:      "app_credential_expiry_days",
+	Help:      "Days until a client secret or certificate of an Azure app registration expires, negative once expired.",
+	Namespace: "aad_finout_sync",
+}, []string{"app_id", "app", "type", "key_id", "name"})
+
+// appCredentialMu keeps runs of the job from notifying about the same credential at the same time.
+var appCredentialMu sync.Mutex
+
+// appCredentialState keeps track of the lowest threshold notified about per credential, so every threshold is only notified once, also after a restart.
+type appCredentialState struct {
+	Notified map[string]int `json:"notified"` // keyed by app id and credential key id
+}
+
+func loadAppCredentialState(file *util.JsonStateFile) (*appCredentialState, error) {
+	state := &appCredentialState{}
+	_, err := file.Load(state)
+	if err != nil {
+		return nil, err
+	}
+	if state.Notified == nil {
+		state.Notified = make(map[string]int)
+	}
+
+	return state, nil
+}
+
+func AppCredentialExpiryHandler(ctx context.Context) error {
+	conf, err := config.LoadConfig()
+	if err != nil {
+		return err
+	}
+
+	if !conf.Azure.CredentialExpiry.Enabled {
+		util.Logger.Debug("App credential expiry check is not enabled, skipping", zap.String("jobName", AppCredentialExpiryName))
+		return nil
+	}
+
+	err = CheckAppCredentialExpiry(ctx, conf, newAzureClient(conf), newNotifier(conf), time.Now().UTC())
+	if errors.Is(err, context.Canceled) {
+		util.Logger.Info("Job cancelled", zap.String("jobName", AppCredentialExpiryName))
+		return nil
+	}
+
+	return err
+}
+
+// monitoredAppIds returns the app registrations to check, which unless configured are the one used by the service and the ones groups are assigned to.
+func monitoredAppIds(conf config.Config) []string {
+	if len(conf.Azure.CredentialExpiry.AppIds) > 0 {
+		return conf.Azure.CredentialExpiry.AppIds
+	}
+
+	var appIds []string
+	seen := make(map[string]bool)
+	add := func(appId string) {
+		if appId != "" && !seen[appId] {
+			seen[appId] = true
+			appIds = append(appIds, appId)
+		}
+	}
+	add(conf.Azure.ClientId)
+	for _, app := range conf.TargetApplications() {
+		add(app.AppId)
+	}
+
+	return appIds
+}
+
+// credentialLevel returns the lowest threshold, in days, that a credential expiring in daysLeft days has reached, or false if it hasn't reached any.
+func credentialLevel(thresholds []int, daysLeft int) (int, bool) {
+	if daysLeft < 0 {
+		return credentialExpired, true
+	}
+
+	sorted := append([]int(nil), thresholds...)
+	sort.Ints(sorted)
+	for _, threshold := range sorted {
+		if daysLeft <= threshold {
+			return threshold, true
+		}
+	}
+
+	return 0, false
+}
+
+// CheckAppCredentialExpiry exports the days until expiry of the client secrets and certificates of the monitored app registrations,
+// and notifies when a credential reaches one of the configured thresholds or expires.
+func CheckAppCredentialExpiry(ctx context.Context, conf config.Config, azureClient *azure.Client, notifier notify.Notifier, now time.Time) error {
+	appCredentialMu.Lock()
+	defer appCredentialMu.Unlock()
+
+	stateFile := jobStateFile("appCredentialExpiry", conf.Azure.CredentialExpiry.StateFile)
+	state, err := loadAppCredentialState(stateFile)
+	if err != nil {
+		return err
+	}
+
+	appCredentialExpiryDays.Reset()
+	failed := 0
+
+	for _, appId := range monitoredAppIds(conf) {
+		app, err := azureClient.GetApplicationCredentials(ctx, appId)
+		if err != nil {
+			if errors.Is(err, context.Canceled) {
+				return err
+			}
+			failed = failed + 1
+			util.Logger.Error(fmt.Sprintf("Unable to get credentials of application %s", appId), zap.String("jobName", AppCredentialExpiryName), zap.Error(err))
+			continue
+		}
+
+		credentials := make(map[string][]azure.ApplicationCredential)
+		credentials[CredentialTypePassword] = app.PasswordCredentials
+		credentials[CredentialTypeCertificate] = app.KeyCredentials
+
+		for credentialType, creds := range credentials {
+			for _, cred := range creds {
+				left := cred.EndDateTime.Sub(now)
+				appCredentialExpiryDays.WithLabelValues(app.AppID, app.DisplayName, credentialType, cred.KeyID, cred.DisplayName).Set(left.Hours() / 24)
+
+				key := fmt.Sprintf("%s:%s", app.AppID, cred.KeyID)
+				daysLeft := int(math.Floor(left.Hours() / 24))
+				level, reached := credentialLevel(conf.Azure.CredentialExpiry.Thresholds, daysLeft)
+				if !reached {
+					delete(state.Notified, key)
+					continue
+				}
+				if notified, ok := state.Notified[key]; ok && notified <= level {
+					continue
+				}
+
+				n := notify.Notification{
+					Severity: notify.SeverityWarning,
+					Subject:  fmt.Sprintf("The %s %q of %s expires in %d days", credentialType, cred.DisplayName, app.DisplayName, daysLeft),
+					Text:     fmt.Sprintf("The %s %q (%s) of app registration %s (%s) expires at %s. Add a new one and update the service configuration before then.", credentialType, cred.DisplayName, cred.KeyID, app.DisplayName, app.AppID, cred.EndDateTime.Format(time.RFC3339)),
+				}
+				if level == credentialExpired {
+					n.Severity = notify.SeverityError
+					n.Subject = fmt.Sprintf("The %s %q of %s has expired", credentialType, cred.DisplayName, app.DisplayName)
+				}
+
+				err = notifier.Notify(ctx, n)
+				if err != nil {
+					util.Logger.Error("Unable to send credential expiry notification", zap.String("jobName", AppCredentialExpiryName), zap.Error(err))
+					continue
+				}
+				state.Notified[key] = level
+
+				// Saved right away, so a failing run doesn't notify again next time.
+				err = stateFile.Save(state)
+				if err != nil {
+					return err
+				}
+			}
+		}
+	}
+
+	err = stateFile.Save(state)
+	if err != nil {
+		return err
+	}
+
+	if failed > 0 {
+		return fmt.Errorf("unable to check credentials of %d applications", failed)
+	}
+
+	return nil
+}
@@ -0,0 +1,132 @@
+package handler
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"go.dfds.cloud/aad-finout-sync/internal/config"
+	"go.dfds.cloud/aad-finout-sync/internal/notify"
+	"go.dfds.cloud/aad-finout-sync/internal/ssu"
+	"go.dfds.cloud/aad-finout-sync/internal/util"
+)
+
+type recordingNotifier struct {
+	notifications []notify.Notification
+}
+
+func (r *recordingNotifier) Notify(ctx context.Context, n notify.Notification) error {
+	r.notifications = append(r.notifications, n)
+	return nil
+}
+
+func TestCheckAppCredentialExpiry(t *testing.T) {
+	graph := setupFakes(t, func() []*ssu.GetCapabilitiesResponseContextCapability { return nil })
+	t.Setenv("AFS_AZURE_CLIENTID", "sync-app")
+	t.Setenv("AFS_AZURE_APPLICATIONID", "aws-app")
+	t.Setenv("AFS_AZURE_CREDENTIALEXPIRY_THRESHOLDS", "30,7")
+
+	now := time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)
+	graph.AddApplication("sync-app", "aad-finout-sync")
+	graph.AddApplication("aws-app", "AWS")
+	graph.AddApplicationCredential("sync-app", "expiring secret", false, now.AddDate(0, 0, 20))
+	graph.AddApplicationCredential("sync-app", "fresh secret", false, now.AddDate(0, 0, 200))
+	graph.AddApplicationCredential("aws-app", "saml signing", true, now.AddDate(0, 0, -1))
+
+	conf, err := config.LoadConfig()
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"sync-app", "aws-app"}, monitoredAppIds(conf))
+
+	notifier := &recordingNotifier{}
+	err = CheckAppCredentialExpiry(context.Background(), conf, newAzureClient(conf), notifier, now)
+	assert.NoError(t, err)
+	if assert.Len(t, notifier.notifications, 2) {
+		subjects := []string{notifier.notifications[0].Subject, notifier.notifications[1].Subject}
+		assert.ElementsMatch(t, []string{
+			`The password "expiring secret" of aad-finout-sync expires in 20 days`,
+			`The certificate "saml signing" of AWS has expired`,
+		}, subjects)
+	}
+
+	// Thresholds already notified about aren't repeated
+	notifier.notifications = nil
+	err = CheckAppCredentialExpiry(context.Background(), conf, newAzureClient(conf), notifier, now.AddDate(0, 0, 1))
+	assert.NoError(t, err)
+	assert.Empty(t, notifier.notifications)
+
+	err = CheckAppCredentialExpiry(context.Background(), conf, newAzureClient(conf), notifier, now.AddDate(0, 0, 14))
+	assert.NoError(t, err)
+	if assert.Len(t, notifier.notifications, 1) {
+		assert.Equal(t, notify.SeverityWarning, notifier.notifications[0].Severity)
+		assert.Equal(t, `The password "expiring secret" of aad-finout-sync expires in 6 days`, notifier.notifications[0].Subject)
+	}
+}
+
+func TestCheckAppCredentialExpiry_StateFile(t *testing.T) {
+	graph := setupFakes(t, func() []*ssu.GetCapabilitiesResponseContextCapability { return nil })
+	path := filepath.Join(t.TempDir(), "credentials.json")
+	t.Setenv("AFS_AZURE_CREDENTIALEXPIRY_APPIDS", "state-app")
+	t.Setenv("AFS_AZURE_CREDENTIALEXPIRY_THRESHOLDS", "30")
+	t.Setenv("AFS_AZURE_CREDENTIALEXPIRY_STATEFILE", path)
+
+	now := time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)
+	graph.AddApplication("state-app", "State")
+	graph.AddApplicationCredential("state-app", "expiring secret", false, now.AddDate(0, 0, 20))
+
+	conf, err := config.LoadConfig()
+	assert.NoError(t, err)
+
+	notifier := &recordingNotifier{}
+	err = CheckAppCredentialExpiry(context.Background(), conf, newAzureClient(conf), notifier, now)
+	assert.NoError(t, err)
+	assert.Len(t, notifier.notifications, 1)
+
+	state, err := loadAppCredentialState(util.NewJsonStateFile(path))
+	assert.NoError(t, err)
+	assert.Len(t, state.Notified, 1)
+
+	notifier.notifications = nil
+	err = CheckAppCredentialExpiry(context.Background(), conf, newAzureClient(conf), notifier, now)
+	assert.NoError(t, err)
+	assert.Empty(t, notifier.notifications)
+
+	// The notified thresholds are only known from the file.
+	assert.NoError(t, os.Remove(path))
+	err = CheckAppCredentialExpiry(context.Background(), conf, newAzureClient(conf), notifier, now)
+	assert.NoError(t, err)
+	assert.Len(t, notifier.notifications, 1)
+}
+
+func TestCheckAppCredentialExpiry_UnknownApplication(t *testing.T) {
+	setupFakes(t, func() []*ssu.GetCapabilitiesResponseContextCapability { return nil })
+	t.Setenv("AFS_AZURE_CREDENTIALEXPIRY_APPIDS", "missing-app")
+
+	conf, err := config.LoadConfig()
+	assert.NoError(t, err)
+
+	err = CheckAppCredentialExpiry(context.Background(), conf, newAzureClient(conf), &recordingNotifier{}, time.Now())
+	assert.Error(t, err)
+}
+
+func TestCredentialLevel(t *testing.T) {
+	thresholds := []int{1, 30, 7}
+
+	_, reached := credentialLevel(thresholds, 31)
+	assert.False(t, reached)
+
+	level, reached := credentialLevel(thresholds, 30)
+	assert.True(t, reached)
+	assert.Equal(t, 30, level)
+
+	level, _ = credentialLevel(thresholds, 5)
+	assert.Equal(t, 7, level)
+
+	level, _ = credentialLevel(thresholds, 0)
+	assert.Equal(t, 1, level)
+
+	level, _ = credentialLevel(thresholds, -2)
+	assert.Equal(t, credentialExpired, level)
+}
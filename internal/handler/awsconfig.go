@@ -0,0 +1,42 @@
+package handler
+
+import (
+	"context"
+	"fmt"
+
+	daws "github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/credentials"
+	"github.com/aws/aws-sdk-go-v2/service/sts"
+	"go.dfds.cloud/aad-finout-sync/internal/aws"
+	dconfig "go.dfds.cloud/aad-finout-sync/internal/config"
+	"go.dfds.cloud/aad-finout-sync/internal/util"
+)
+
+// loadAwsConfig returns an AWS SDK config for the SSO management account, assuming the configured SSO management role if one is set.
+func loadAwsConfig(ctx context.Context, conf dconfig.Config, jobName string) (daws.Config, error) {
+	cfg, err := config.LoadDefaultConfig(ctx, config.WithRegion(conf.Aws.SsoRegion), config.WithHTTPClient(aws.CreateHttpClientWithoutKeepAlive()))
+	if err != nil {
+		return cfg, fmt.Errorf("unable to load SDK config, %v", err)
+	}
+
+	if conf.Aws.AssumableRoles.SsoManagementArn == "" {
+		return cfg, nil
+	}
+
+	stsClient := sts.NewFromConfig(cfg)
+	roleSessionName := fmt.Sprintf("aad-finout-sync-%s", jobName)
+
+	assumedRole, err := stsClient.AssumeRole(ctx, &sts.AssumeRoleInput{RoleArn: &conf.Aws.AssumableRoles.SsoManagementArn, RoleSessionName: &roleSessionName})
+	if err != nil {
+		util.Logger.Debug(fmt.Sprintf("unable to assume role %s, %v", conf.Aws.AssumableRoles.SsoManagementArn, err))
+		return cfg, err
+	}
+
+	cfg, err = config.LoadDefaultConfig(ctx, config.WithCredentialsProvider(credentials.NewStaticCredentialsProvider(*assumedRole.Credentials.AccessKeyId, *assumedRole.Credentials.SecretAccessKey, *assumedRole.Credentials.SessionToken)), config.WithRegion(conf.Aws.SsoRegion))
+	if err != nil {
+		return cfg, fmt.Errorf("unable to load SDK config, %v", err)
+	}
+
+	return cfg, nil
+}
@@ -49,6 +49,11 @@ func AwsMappingHandler(ctx context.Context) error {
 		}
 	}
 
+	naming, err := newGroupNaming(conf)
+	if err != nil {
+		return err
+	}
+
 	ssoClient := ssoadmin.NewFromConfig(cfg)
 
 	manageSso, err := aws.InitManageSso(cfg, conf.Aws.IdentityStoreArn)
@@ -57,7 +62,7 @@ func AwsMappingHandler(ctx context.Context) error {
 	}
 
 	// Capability PermissionSet
-	accountsWithMissingPermissionSet, err := manageSso.GetAccountsMissingCapabilityPermissionSet(ssoClient, conf.Aws.SsoInstanceArn, conf.Aws.CapabilityPermissionSetArn, CAPABILITY_GROUP_PREFIX, conf.Aws.AccountNamePrefix)
+	accountsWithMissingPermissionSet, err := manageSso.GetAccountsMissingCapabilityPermissionSet(ssoClient, conf.Aws.SsoInstanceArn, conf.Aws.CapabilityPermissionSetArn, naming.Prefix(), conf.Aws.AccountNamePrefix)
 	if err != nil {
 		return err
 	}
@@ -95,6 +100,7 @@ func AwsMappingHandler(ctx context.Context) error {
 		AwsAccountNameAlias: conf.Aws.CapabilityLogsAwsAccountAlias,
 		PermissionSetArn:    conf.Aws.CapabilityLogsPermissionSetArn,
 		SsoInstanceArn:      conf.Aws.SsoInstanceArn,
+		GroupPrefix:         naming.Prefix(),
 		ctx:                 ctx,
 	})
 	if err != nil {
@@ -107,6 +113,7 @@ func AwsMappingHandler(ctx context.Context) error {
 		AwsAccountNameAlias: conf.Aws.SharedEcrPullAwsAccountAlias,
 		PermissionSetArn:    conf.Aws.SharedEcrPullPermissionSetArn,
 		SsoInstanceArn:      conf.Aws.SsoInstanceArn,
+		GroupPrefix:         naming.Prefix(),
 		ctx:                 ctx,
 	})
 	if err != nil {
@@ -122,7 +129,7 @@ func addToSharedRole(manageSso *aws.ManageSso, ssoClient *ssoadmin.Client, req a
 		return errors.New(fmt.Sprintf("Unable to find AWS account by alias %s", req.AwsAccountNameAlias))
 	}
 
-	resp, err := manageSso.GetGroupsNotAssignedToAccountWithPermissionSet(ssoClient, req.SsoInstanceArn, req.PermissionSetArn, *acc.Id, CAPABILITY_GROUP_PREFIX)
+	resp, err := manageSso.GetGroupsNotAssignedToAccountWithPermissionSet(ssoClient, req.SsoInstanceArn, req.PermissionSetArn, *acc.Id, req.GroupPrefix)
 	if err != nil {
 		return err
 	}
@@ -168,5 +175,6 @@ type addToSharedRoleRequest struct {
 	AwsAccountNameAlias string
 	PermissionSetArn    string
 	SsoInstanceArn      string
+	GroupPrefix         string
 	ctx                 context.Context
 }
@@ -2,10 +2,12 @@ package handler
 
 import (
 	"context"
+	"errors"
 	"fmt"
 
 	"go.dfds.cloud/aad-finout-sync/internal/azure"
 	"go.dfds.cloud/aad-finout-sync/internal/config"
+	"go.dfds.cloud/aad-finout-sync/internal/ssu"
 	"go.dfds.cloud/aad-finout-sync/internal/util"
 	"go.uber.org/zap"
 )
@@ -18,51 +20,173 @@ func Azure2AwsHandler(ctx context.Context) error {
 		return err
 	}
 
-	azClient := azure.NewAzureClient(azure.Config{
-		TenantId:     conf.Azure.TenantId,
-		ClientId:     conf.Azure.ClientId,
-		ClientSecret: conf.Azure.ClientSecret,
-	})
+	azClient := newAzureClient(conf)
 
-	appRoles, err := azClient.GetApplicationRoles(conf.Azure.ApplicationId)
+	naming, err := newGroupNaming(conf)
 	if err != nil {
 		return err
 	}
 
-	appRoleId, err := appRoles.GetRoleId("User")
+	excluded := make(map[string]bool)
+	for _, entry := range conf.Azure.ExcludedAssignments {
+		excluded[entry] = true
+	}
+
+	ssuClient, err := newSsuClient(conf)
 	if err != nil {
 		return err
 	}
+	capabilities, err := ssuClient.GetCapabilities(ctx)
+	if err != nil {
+		if errors.Is(err, context.Canceled) {
+			util.Logger.Info("Job cancelled", zap.String("jobName", AzureAdToAwsName))
+			return nil
+		}
+		return err
+	}
+	lifecycles := make(map[string]ssu.LifecyclePolicy) // keyed by group display name
+	for _, capability := range capabilities {
+		lifecycles[naming.DisplayName(capability.RootID)] = capability.Lifecycle()
+	}
+
+	groupsByFilter := make(map[string]*azure.GroupsListResponse)
+
+	for _, app := range conf.TargetApplications() {
+		select {
+		case <-ctx.Done():
+			util.Logger.Info("Job cancelled", zap.String("jobName", AzureAdToAwsName))
+			return nil
+		default:
+		}
 
-	appAssignments, err := azClient.GetAssignmentsForApplication(conf.Azure.ApplicationObjectId)
+		groupFilter := app.GroupFilter
+		if groupFilter == "" {
+			groupFilter = naming.Prefix()
+		}
+
+		groups, exists := groupsByFilter[groupFilter]
+		if !exists {
+			groups, err = azClient.GetGroups(ctx, groupFilter)
+			if err != nil {
+				return err
+			}
+			groupsByFilter[groupFilter] = groups
+		}
+
+		appExcluded := make(map[string]bool)
+		for entry := range excluded {
+			appExcluded[entry] = true
+		}
+		for _, entry := range app.ExcludedAssignments {
+			appExcluded[entry] = true
+		}
+
+		err = reconcileApplicationAssignments(ctx, azClient, naming, app, groups, appExcluded, lifecycles, conf.Azure.AllowEmptyGroups)
+		if err != nil {
+			if errors.Is(err, context.Canceled) {
+				util.Logger.Info("Job cancelled", zap.String("jobName", AzureAdToAwsName))
+				return nil
+			}
+			return err
+		}
+	}
+
+	return nil
+}
+
+// reconcileApplicationAssignments assigns groups to app, and removes assignments of capability groups that no longer exist, don't match the app's group filter
+// or are retired. Groups that naming doesn't recognise as capability groups, and groups in excluded, by id or display name, are left alone. lifecycles holds the lifecycle policy of capability groups, keyed by display name,
+// groups of capabilities that don't allow new resources aren't assigned and those that don't keep their access are unassigned.
+// If groups is empty, which usually means a wrong group filter or naming, no assignments are removed unless allowEmptyGroups is set.
+func reconcileApplicationAssignments(ctx context.Context, azClient *azure.Client, naming *azure.GroupNaming, app config.TargetApplication, groups *azure.GroupsListResponse, excluded map[string]bool, lifecycles map[string]ssu.LifecyclePolicy, allowEmptyGroups bool) error {
+	util.Logger.Info(fmt.Sprintf("Reconciling assignments for application %s", app.AppId), zap.String("jobName", AzureAdToAwsName))
+
+	appRoles, err := azClient.GetApplicationRoles(ctx, app.AppId)
+	if err != nil {
+		return err
+	}
+
+	appRoleId, err := appRoles.GetRoleId(app.RoleName)
 	if err != nil {
 		return err
 	}
 
-	groups, err := azClient.GetGroups(azure.AZURE_CAPABILITY_GROUP_PREFIX)
+	appAssignments, err := azClient.GetAssignmentsForApplication(ctx, app.ObjectId)
 	if err != nil {
 		return err
 	}
 
+	groupsById := make(map[string]azure.GroupsListResponseGroup)
+	for _, group := range groups.Value {
+		groupsById[group.ID] = group
+	}
+
 	for _, group := range groups.Value {
 		select {
 		case <-ctx.Done():
-			util.Logger.Info("Job cancelled", zap.String("jobName", AzureAdToAwsName))
-			return nil
+			return ctx.Err()
 		default:
 		}
 
 		util.Logger.Debug(group.DisplayName, zap.String("jobName", AzureAdToAwsName))
 
+		// Groups of capabilities that no longer exist are on their way out, so they don't get access anymore.
+		if _, retired := orphanedSince(group.Description); retired {
+			continue
+		}
+		if lifecycle, exists := lifecycles[group.DisplayName]; exists && !lifecycle.AllowNewResources {
+			continue
+		}
+
 		// If group is not already assigned to enterprise application, assign them.
 		if !appAssignments.ContainsGroup(group.DisplayName) {
-			util.Logger.Info(fmt.Sprintf("Group %s has not been assigned to application yet, assigning", group.DisplayName), zap.String("jobName", AzureAdToAwsName))
-			_, err := azClient.AssignGroupToApplication(conf.Azure.ApplicationObjectId, group.ID, appRoleId)
+			util.Logger.Info(fmt.Sprintf("Group %s has not been assigned to application %s yet, assigning", group.DisplayName, app.AppId), zap.String("jobName", AzureAdToAwsName))
+			_, err := azClient.AssignGroupToApplication(app.ObjectId, group.ID, appRoleId)
 			if err != nil {
 				return err
 			}
 		}
 	}
 
+	if len(groups.Value) == 0 && !allowEmptyGroups {
+		util.Logger.Warn(fmt.Sprintf("No groups found for application %s, not removing any of its assignments. Set allowEmptyGroups to remove them", app.AppId), zap.String("jobName", AzureAdToAwsName))
+		return nil
+	}
+
+	// Remove assignments for capability groups that no longer exist, don't match the filter or are retired.
+	for _, assignment := range appAssignments.Value {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		default:
+		}
+
+		// Only capability groups are managed, other groups may have been assigned to the application by hand.
+		if assignment.PrincipalType != "Group" || !naming.IsCapabilityGroup(assignment.PrincipalDisplayName) {
+			continue
+		}
+
+		if excluded[assignment.PrincipalID] || excluded[assignment.PrincipalDisplayName] {
+			util.Logger.Debug(fmt.Sprintf("Group %s is excluded, keeping its assignment", assignment.PrincipalDisplayName), zap.String("jobName", AzureAdToAwsName))
+			continue
+		}
+
+		if group, exists := groupsById[assignment.PrincipalID]; exists {
+			_, retired := orphanedSince(group.Description)
+			if lifecycle, exists := lifecycles[group.DisplayName]; exists && !lifecycle.KeepExistingAccess {
+				retired = true
+			}
+			if !retired {
+				continue
+			}
+		}
+
+		util.Logger.Info(fmt.Sprintf("Group %s (%s) is no longer an active capability group, removing its assignment to application %s", assignment.PrincipalDisplayName, assignment.PrincipalID, app.AppId), zap.String("jobName", AzureAdToAwsName))
+		err := azClient.UnassignGroupFromApplication(assignment.PrincipalID, assignment.ID)
+		if err != nil {
+			return err
+		}
+	}
+
 	return nil
 }
@@ -0,0 +1,159 @@
+package handler
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"go.dfds.cloud/aad-finout-sync/internal/azure"
+	"go.dfds.cloud/aad-finout-sync/internal/azure/fakegraph"
+	"go.dfds.cloud/aad-finout-sync/internal/ssu"
+)
+
+func TestAzure2AwsHandler(t *testing.T) {
+	graph := setupFakes(t, func() []*ssu.GetCapabilitiesResponseContextCapability { return nil })
+	graph.PageSize = 1
+
+	servicePrincipalId := graph.AddApplication("aws-app", "AWS", fakegraph.AppRole{ID: "role-user", DisplayName: "User"})
+	t.Setenv("AFS_AZURE_APPLICATIONID", "aws-app")
+	t.Setenv("AFS_AZURE_APPLICATIONOBJECTID", servicePrincipalId)
+
+	capA := graph.AddGroup("", "CI_SSU_Cap - cap-a")
+	capB := graph.AddGroup("", "CI_SSU_Cap - cap-b")
+	graph.AddGroup("", "Unrelated group")
+	graph.AddAppRoleAssignment(servicePrincipalId, capA, "role-user")
+
+	err := Azure2AwsHandler(context.Background())
+	assert.NoError(t, err)
+
+	assignments := graph.AppRoleAssignments(servicePrincipalId)
+	if assert.Len(t, assignments, 2) {
+		assert.Equal(t, capA, assignments[0].PrincipalId)
+		assert.Equal(t, capB, assignments[1].PrincipalId)
+		assert.Equal(t, "role-user", assignments[1].AppRoleId)
+	}
+}
+
+func TestAzure2AwsHandler_RemovesStaleAssignments(t *testing.T) {
+	graph := setupFakes(t, func() []*ssu.GetCapabilitiesResponseContextCapability { return nil })
+
+	servicePrincipalId := graph.AddApplication("aws-app", "AWS", fakegraph.AppRole{ID: "role-user", DisplayName: "User"})
+	t.Setenv("AFS_AZURE_APPLICATIONID", "aws-app")
+	t.Setenv("AFS_AZURE_APPLICATIONOBJECTID", servicePrincipalId)
+	t.Setenv("AFS_AZURE_EXCLUDEDASSIGNMENTS", "CI_SSU_Cap - platform-admins")
+
+	capA := graph.AddGroup("", "CI_SSU_Cap - cap-a")
+	capRetired := graph.AddGroup("", "CI_SSU_Cap - cap-retired")
+	graph.SetGroupDescription(capRetired, azure.DefaultGroupDescription+orphanedGroupMarker+"2024-03-01T10:00:00Z")
+	unrelated := graph.AddGroup("", "Unrelated group")
+	manual := graph.AddGroup("", "CI_SSU_Cap - platform-admins")
+
+	graph.AddAppRoleAssignment(servicePrincipalId, capA, "role-user")
+	graph.AddAppRoleAssignment(servicePrincipalId, capRetired, "role-user")
+	graph.AddAppRoleAssignment(servicePrincipalId, unrelated, "role-user")
+	graph.AddAppRoleAssignment(servicePrincipalId, manual, "role-user")
+	graph.AddAppRoleAssignment(servicePrincipalId, "deleted-group", "role-user")
+
+	err := Azure2AwsHandler(context.Background())
+	assert.NoError(t, err)
+
+	var principalIds []string
+	for _, assignment := range graph.AppRoleAssignments(servicePrincipalId) {
+		principalIds = append(principalIds, assignment.PrincipalId)
+	}
+	// Groups that aren't capability groups are never removed.
+	assert.ElementsMatch(t, []string{capA, manual, unrelated, "deleted-group"}, principalIds)
+}
+
+func TestAzure2AwsHandler_EmptyGroups(t *testing.T) {
+	graph := setupFakes(t, func() []*ssu.GetCapabilitiesResponseContextCapability { return nil })
+
+	servicePrincipalId := graph.AddApplication("finout-app", "Finout", fakegraph.AppRole{ID: "role-user", DisplayName: "User"})
+	t.Setenv("AFS_AZURE_APPLICATIONS", `[{"appId": "finout-app", "objectId": "`+servicePrincipalId+`", "groupFilter": "CI_SSU_Cap - finance"}]`)
+
+	capA := graph.AddGroup("", "CI_SSU_Cap - cap-a")
+	unrelated := graph.AddGroup("", "Unrelated group")
+	graph.AddAppRoleAssignment(servicePrincipalId, capA, "role-user")
+	graph.AddAppRoleAssignment(servicePrincipalId, unrelated, "role-user")
+
+	// No groups matching the filter usually means a broken filter, so nothing is removed.
+	err := Azure2AwsHandler(context.Background())
+	assert.NoError(t, err)
+	assert.Len(t, graph.AppRoleAssignments(servicePrincipalId), 2)
+
+	t.Setenv("AFS_AZURE_ALLOWEMPTYGROUPS", "true")
+	err = Azure2AwsHandler(context.Background())
+	assert.NoError(t, err)
+	assignments := graph.AppRoleAssignments(servicePrincipalId)
+	if assert.Len(t, assignments, 1) {
+		assert.Equal(t, unrelated, assignments[0].PrincipalId)
+	}
+}
+
+func TestAzure2AwsHandler_MultipleApplications(t *testing.T) {
+	graph := setupFakes(t, func() []*ssu.GetCapabilitiesResponseContextCapability { return nil })
+
+	awsId := graph.AddApplication("aws-app", "AWS", fakegraph.AppRole{ID: "aws-user", DisplayName: "User"})
+	finoutId := graph.AddApplication("finout-app", "Finout", fakegraph.AppRole{ID: "finout-user", DisplayName: "User"}, fakegraph.AppRole{ID: "finout-viewer", DisplayName: "Viewer"})
+	t.Setenv("AFS_AZURE_APPLICATIONS", `[
+		{"appId": "aws-app", "objectId": "`+awsId+`"},
+		{"appId": "finout-app", "objectId": "`+finoutId+`", "roleName": "Viewer", "groupFilter": "CI_SSU_Cap - finance", "excludedAssignments": ["CI_SSU_Cap - cap-b"]}
+	]`)
+
+	capA := graph.AddGroup("", "CI_SSU_Cap - cap-a")
+	capB := graph.AddGroup("", "CI_SSU_Cap - cap-b")
+	finance := graph.AddGroup("", "CI_SSU_Cap - finance-reporting")
+	graph.AddAppRoleAssignment(finoutId, capA, "finout-viewer")
+	graph.AddAppRoleAssignment(finoutId, capB, "finout-viewer")
+
+	err := Azure2AwsHandler(context.Background())
+	assert.NoError(t, err)
+
+	var awsPrincipalIds []string
+	for _, assignment := range graph.AppRoleAssignments(awsId) {
+		awsPrincipalIds = append(awsPrincipalIds, assignment.PrincipalId)
+		assert.Equal(t, "aws-user", assignment.AppRoleId)
+	}
+	assert.ElementsMatch(t, []string{capA, capB, finance}, awsPrincipalIds)
+
+	// cap-b is only excluded for the Finout application.
+	var finoutPrincipalIds []string
+	for _, assignment := range graph.AppRoleAssignments(finoutId) {
+		finoutPrincipalIds = append(finoutPrincipalIds, assignment.PrincipalId)
+		assert.Equal(t, "finout-viewer", assignment.AppRoleId)
+	}
+	assert.ElementsMatch(t, []string{capB, finance}, finoutPrincipalIds)
+}
+
+func TestAzure2AwsHandler_LifecycleStatus(t *testing.T) {
+	pending := newTestCapability("cap-pending")
+	pending.Status = ssu.CapabilityStatusPendingDeletion
+	pendingNew := newTestCapability("cap-pending-new")
+	pendingNew.Status = ssu.CapabilityStatusPendingDeletion
+	deleted := newTestCapability("cap-deleted")
+	deleted.Status = ssu.CapabilityStatusDeleted
+	graph := setupFakes(t, func() []*ssu.GetCapabilitiesResponseContextCapability {
+		return []*ssu.GetCapabilitiesResponseContextCapability{newTestCapability("cap-a"), pending, pendingNew, deleted}
+	})
+
+	servicePrincipalId := graph.AddApplication("aws-app", "AWS", fakegraph.AppRole{ID: "role-user", DisplayName: "User"})
+	t.Setenv("AFS_AZURE_APPLICATIONID", "aws-app")
+	t.Setenv("AFS_AZURE_APPLICATIONOBJECTID", servicePrincipalId)
+
+	capA := graph.AddGroup("", "CI_SSU_Cap - cap-a")
+	capPending := graph.AddGroup("", "CI_SSU_Cap - cap-pending")
+	graph.AddGroup("", "CI_SSU_Cap - cap-pending-new")
+	capDeleted := graph.AddGroup("", "CI_SSU_Cap - cap-deleted")
+	graph.AddAppRoleAssignment(servicePrincipalId, capPending, "role-user")
+	graph.AddAppRoleAssignment(servicePrincipalId, capDeleted, "role-user")
+
+	err := Azure2AwsHandler(context.Background())
+	assert.NoError(t, err)
+
+	// Groups of capabilities pending deletion keep their assignment but aren't assigned anew, those of deleted capabilities lose it.
+	var principalIds []string
+	for _, assignment := range graph.AppRoleAssignments(servicePrincipalId) {
+		principalIds = append(principalIds, assignment.PrincipalId)
+	}
+	assert.ElementsMatch(t, []string{capA, capPending}, principalIds)
+}
@@ -2,66 +2,273 @@ package handler
 
 import (
 	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
 	"go.dfds.cloud/aad-finout-sync/internal/config"
-	"go.dfds.cloud/aad-finout-sync/internal/finout"
+	"go.dfds.cloud/aad-finout-sync/internal/ssu"
+	"go.dfds.cloud/aad-finout-sync/internal/util"
+	"go.uber.org/zap"
 )
 
 const AzureAdToFinoutName = "aadToFinout"
 
+// departmentUnknown is used for members without a department in Azure AD.
+const departmentUnknown = "(none)"
+
+var capabilitiesDepartmentMismatch prometheus.Gauge = promauto.NewGauge(prometheus.GaugeOpts{
+	Name:      "capabilities_department_mismatch",
+	Help:      "Amount of capabilities whose members mostly belong to a department with a different cost centre than the capability.",
+	Namespace: "aad_finout_sync",
+})
+
+// DepartmentAttributionReport aggregates the members of each capability by their Azure AD department and job title,
+// and flags capabilities whose members mostly belong to a department with a different cost centre than the capability's.
+type DepartmentAttributionReport struct {
+	GeneratedAt       time.Time                                `json:"generatedAt"`
+	MajorityThreshold float64                                  `json:"majorityThreshold"`
+	Mismatches        int                                      `json:"mismatches"`
+	Capabilities      []*DepartmentAttributionReportCapability `json:"capabilities"`
+}
+
+type DepartmentAttributionReportCapability struct {
+	CapabilityId       string                       `json:"capabilityId"`
+	CapabilityRootId   string                       `json:"capabilityRootId"`
+	CapabilityName     string                       `json:"capabilityName"`
+	CostCentre         string                       `json:"costCentre"`
+	Members            int                          `json:"members"`
+	Departments        []DepartmentAttributionCount `json:"departments"`
+	JobTitles          []DepartmentAttributionCount `json:"jobTitles"`
+	MajorityDepartment string                       `json:"majorityDepartment,omitempty"`
+	MajorityShare      float64                      `json:"majorityShare,omitempty"`
+	ExpectedCostCentre string                       `json:"expectedCostCentre,omitempty"`
+	Mismatch           bool                         `json:"mismatch"`
+	Note               string                       `json:"note,omitempty"`
+	MetadataIssues     []ssu.MetadataIssue          `json:"metadataIssues,omitempty"`
+}
+
+type DepartmentAttributionCount struct {
+	Name    string `json:"name"`
+	Members int    `json:"members"`
+}
+
 func Azure2FinoutHandler(ctx context.Context) error {
-	conf, err := config.LoadConfig()
+	report, err := BuildDepartmentAttributionReport(ctx)
 	if err != nil {
+		if errors.Is(err, context.Canceled) {
+			util.Logger.Info("Job cancelled", zap.String("jobName", AzureAdToFinoutName))
+			return nil
+		}
 		return err
 	}
 
-	//finoutClientAuth := finout.NewFinoutClient()
-	finoutClientApp := finout.NewFinoutClient()
-	//finoutClientAuth.SetAuthMethod(finout.AuthUserMethod(conf.Finout.Username, conf.Finout.Password, &conf.Finout.MfaUrl))
-	finoutClientApp.SetAuthMethod(finout.AuthClientSecretMethod(finout.Config{ClientId: conf.Finout.ClientId, ClientSecret: conf.Finout.ClientSecret}))
+	util.Logger.Info(fmt.Sprintf("%d of %d capabilities have members mostly from a department with a different cost centre", report.Mismatches, len(report.Capabilities)), zap.String("jobName", AzureAdToFinoutName))
+	for _, capability := range report.Capabilities {
+		if !capability.Mismatch {
+			continue
+		}
+		util.Logger.Info(capability.Note,
+			zap.String("jobName", AzureAdToFinoutName),
+			zap.String("capabilityId", capability.CapabilityId),
+			zap.String("costCentre", capability.CostCentre),
+			zap.String("majorityDepartment", capability.MajorityDepartment),
+			zap.Float64("majorityShare", capability.MajorityShare))
+	}
+
+	return nil
+}
 
-	tags, err := finoutClientApp.ApiApp().ListViews(ctx)
+// BuildDepartmentAttributionReport compares the cost centre of every capability with the departments of the members of its Azure AD group.
+// Departments are mapped to cost centres using department2CostCentre in mapping.json, departments that aren't mapped are expected to be named like their cost centre.
+func BuildDepartmentAttributionReport(ctx context.Context) (*DepartmentAttributionReport, error) {
+	conf, err := config.LoadConfig()
 	if err != nil {
-		return err
+		return nil, err
+	}
+
+	naming, err := newGroupNaming(conf)
+	if err != nil {
+		return nil, err
 	}
 
-	tags.GetByName("dfds.cost.centre")
+	ssuClient, err := newSsuClient(conf)
+	if err != nil {
+		return nil, err
+	}
+	capabilities, err := ssuClient.GetCapabilities(ctx)
+	if err != nil {
+		return nil, err
+	}
+	capabilities = costRuleCapabilities(capabilities)
 
-	return nil
+	azureClient := newAzureClient(conf)
+	aUnitName := administrativeUnitName(conf)
+	aUnits, err := azureClient.GetAdministrativeUnits(ctx, aUnitName)
+	if err != nil {
+		return nil, err
+	}
+	aUnit := aUnits.GetUnit(aUnitName)
+	if aUnit == nil {
+		return nil, fmt.Errorf("unable to find administrative unit %s", aUnitName)
+	}
 
-	//azClient := azure.NewAzureClient(azure.Config{
-	//	TenantId:     conf.Azure.TenantId,
-	//	ClientId:     conf.Azure.ClientId,
-	//	ClientSecret: conf.Azure.ClientSecret,
-	//})
-	//
-	//groups, err := azClient.GetGroups(azure.AZURE_CAPABILITY_GROUP_PREFIX)
-	//if err != nil {
-	//	return err
-	//}
-	//
-	//departments := make(map[string]int)
-	//
-	//for _, group := range groups.Value {
-	//	select {
-	//	case <-ctx.Done():
-	//		util.Logger.Info("Job cancelled", zap.String("jobName", AzureAdToFinoutName))
-	//		return nil
-	//	default:
-	//	}
-	//
-	//	util.Logger.Debug(group.DisplayName, zap.String("jobName", AzureAdToFinoutName))
-	//	members, err := azClient.GetGroupMembers(group.ID)
-	//	if err != nil {
-	//		return err
-	//	}
-	//
-	//	for _, member := range members.Value {
-	//		util.Logger.Debug(member.UserPrincipalName, zap.String("jobName", AzureAdToFinoutName))
-	//		if _, ok := departments[member.Department]; !ok {
-	//			departments[member.Department] = 0
-	//		}
-	//	}
-	//}
+	// Always a full load, as department and job title aren't kept in the delta state.
+	groups, err := loadAzureGroupsFull(ctx, azureClient, aUnit.ID)
+	if err != nil {
+		return nil, err
+	}
+	groupsInAzure := groupsByRootId(naming, groups)
 
-	return nil
+	mappings, err := getMappings()
+	if err != nil {
+		util.Logger.Warn("No manual mappings found, expecting departments to be named like their cost centre", zap.Error(err), zap.String("jobName", AzureAdToFinoutName))
+		mappings = &dataMappings{}
+	}
+	department2CostCentre := make(map[string]string)
+	for _, mapping := range mappings.Department2CostCentre {
+		department2CostCentre[strings.ToLower(mapping.Department)] = mapping.CostCentre
+	}
+
+	report := &DepartmentAttributionReport{
+		GeneratedAt:       time.Now().UTC(),
+		MajorityThreshold: conf.Attribution.MajorityThreshold,
+		Capabilities:      []*DepartmentAttributionReportCapability{},
+	}
+
+	var capabilityIds []string
+	for _, capability := range capabilities {
+		if _, exists := groupsInAzure[capability.RootID]; exists {
+			capabilityIds = append(capabilityIds, capability.ID)
+		}
+	}
+	capsMetadata, err := getCapabilitiesMetadata(ctx, conf, ssuClient, AzureAdToFinoutName, capabilityIds)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, capability := range capabilities {
+		group, exists := groupsInAzure[capability.RootID]
+		if !exists {
+			continue
+		}
+
+		metadata, ok := capsMetadata[capability.ID]
+		if !ok {
+			continue
+		}
+
+		entry := &DepartmentAttributionReportCapability{
+			CapabilityId:     capability.ID,
+			CapabilityRootId: capability.RootID,
+			CapabilityName:   capability.Name,
+			CostCentre:       metadata.CostCentre,
+			MetadataIssues:   metadata.Issues,
+		}
+
+		departments := make(map[string]int)
+		jobTitles := make(map[string]int)
+		for _, member := range group.Members {
+			if member.IsDisabled() {
+				continue
+			}
+			entry.Members = entry.Members + 1
+
+			department := strings.TrimSpace(member.Department)
+			if department == "" {
+				department = departmentUnknown
+			}
+			departments[department] = departments[department] + 1
+
+			if jobTitle := strings.TrimSpace(member.JobTitle); jobTitle != "" {
+				jobTitles[jobTitle] = jobTitles[jobTitle] + 1
+			}
+		}
+		entry.Departments = sortedAttributionCounts(departments)
+		entry.JobTitles = sortedAttributionCounts(jobTitles)
+
+		attributeDepartment(entry, department2CostCentre, conf.Attribution.MajorityThreshold)
+		if entry.Mismatch {
+			report.Mismatches = report.Mismatches + 1
+		}
+		report.Capabilities = append(report.Capabilities, entry)
+	}
+
+	sort.Slice(report.Capabilities, func(i, j int) bool {
+		return report.Capabilities[i].CapabilityRootId < report.Capabilities[j].CapabilityRootId
+	})
+	capabilitiesDepartmentMismatch.Set(float64(report.Mismatches))
+
+	return report, nil
+}
+
+// attributeDepartment sets the majority department of a capability and flags it as a mismatch if the department's cost centre differs from the capability's.
+// The majority department is the largest known department, if its share of the members is above threshold and no other department is as large.
+func attributeDepartment(entry *DepartmentAttributionReportCapability, department2CostCentre map[string]string, threshold float64) {
+	if entry.Members == 0 {
+		entry.Note = "Capability has no enabled members in Azure AD"
+		return
+	}
+
+	var known []DepartmentAttributionCount
+	for _, department := range entry.Departments {
+		if department.Name != departmentUnknown {
+			known = append(known, department)
+		}
+	}
+
+	if len(known) > 0 {
+		share := float64(known[0].Members) / float64(entry.Members)
+		if share <= threshold {
+			entry.Note = fmt.Sprintf("No department has more than %.0f%% of the members", threshold*100)
+			return
+		}
+		if len(known) > 1 && known[1].Members == known[0].Members {
+			entry.Note = fmt.Sprintf("Departments '%s' and '%s' have the same number of members", known[0].Name, known[1].Name)
+			return
+		}
+		entry.MajorityDepartment = known[0].Name
+		entry.MajorityShare = share
+	}
+
+	if entry.MajorityDepartment == "" {
+		entry.Note = "None of the members have a department in Azure AD"
+		return
+	}
+
+	entry.ExpectedCostCentre = entry.MajorityDepartment
+	if costCentre, exists := department2CostCentre[strings.ToLower(entry.MajorityDepartment)]; exists {
+		entry.ExpectedCostCentre = costCentre
+	}
+
+	if entry.CostCentre == "" {
+		entry.Note = fmt.Sprintf("Capability has no '%s' metadata, members suggest '%s'", tagKey, entry.ExpectedCostCentre)
+		return
+	}
+
+	if !strings.EqualFold(entry.CostCentre, entry.ExpectedCostCentre) {
+		entry.Mismatch = true
+		entry.Note = fmt.Sprintf("Capability %s has cost centre '%s', but %.0f%% of its members belong to department '%s' with cost centre '%s'",
+			entry.CapabilityRootId, entry.CostCentre, entry.MajorityShare*100, entry.MajorityDepartment, entry.ExpectedCostCentre)
+	}
+}
+
+// sortedAttributionCounts returns counts by name, largest first.
+func sortedAttributionCounts(counts map[string]int) []DepartmentAttributionCount {
+	payload := make([]DepartmentAttributionCount, 0, len(counts))
+	for name, members := range counts {
+		payload = append(payload, DepartmentAttributionCount{Name: name, Members: members})
+	}
+	sort.Slice(payload, func(i, j int) bool {
+		if payload[i].Members != payload[j].Members {
+			return payload[i].Members > payload[j].Members
+		}
+		return payload[i].Name < payload[j].Name
+	})
+
+	return payload
 }
@@ -0,0 +1,124 @@
+package handler
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"go.dfds.cloud/aad-finout-sync/internal/ssu"
+)
+
+// withFakeCapabilityMetadata serves metadata, keyed by capability id, in the double encoded form returned by the capability service,
+// and passes other requests to the capability service set up by setupFakes.
+func withFakeCapabilityMetadata(t *testing.T, metadata map[string]map[string]interface{}) {
+	capSvcHost := os.Getenv("AFS_CAPSVC_HOST")
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if id, found := strings.CutSuffix(strings.TrimPrefix(r.URL.Path, "/capabilities/"), "/metadata"); found {
+			data, err := json.Marshal(metadata[id])
+			assert.NoError(t, err)
+			w.Write([]byte(strconv.Quote(string(data))))
+			return
+		}
+		http.Redirect(w, r, capSvcHost+r.URL.Path, http.StatusTemporaryRedirect)
+	}))
+	t.Cleanup(server.Close)
+
+	t.Setenv("AFS_CAPSVC_HOST", server.URL)
+	// Metadata differs between tests for the same capability ids, so the shared cache must not be used
+	t.Setenv("AFS_CAPSVC_METADATA_CACHETTL", "0s")
+}
+
+func TestBuildDepartmentAttributionReport(t *testing.T) {
+	var capabilities []*ssu.GetCapabilitiesResponseContextCapability
+	graph := setupFakes(t, func() []*ssu.GetCapabilitiesResponseContextCapability { return capabilities })
+	withFakeCapabilityMetadata(t, map[string]map[string]interface{}{
+		"cap-a": {tagKey: "ti-arch"},
+		"cap-b": {tagKey: "finance"},
+		"cap-c": {tagKey: 42},
+	})
+
+	aUnitId := graph.AddAdministrativeUnit(testAdministrativeUnitName)
+	alice := graph.AddUser("alice@example.com", "Alice")
+	bob := graph.AddUser("bob@example.com", "Bob")
+	carol := graph.AddUser("carol@example.com", "Carol")
+	graph.SetUserJob(alice, "ti-arch", "Architect")
+	graph.SetUserJob(bob, "ti-arch", "Developer")
+	graph.SetUserJob(carol, "Finance", "Controller")
+	graph.AddGroup(aUnitId, "CI_SSU_Cap - cap-a", alice, bob, carol)
+	graph.AddGroup(aUnitId, "CI_SSU_Cap - cap-b", alice, bob)
+	graph.AddGroup(aUnitId, "CI_SSU_Cap - cap-c", carol)
+
+	capabilities = []*ssu.GetCapabilitiesResponseContextCapability{
+		newTestCapability("cap-a"),
+		newTestCapability("cap-b"),
+		newTestCapability("cap-c"),
+	}
+
+	report, err := BuildDepartmentAttributionReport(context.Background())
+	assert.NoError(t, err)
+	assert.Equal(t, 1, report.Mismatches)
+	if assert.Len(t, report.Capabilities, 3) {
+		capA := report.Capabilities[0]
+		assert.False(t, capA.Mismatch)
+		assert.Equal(t, 3, capA.Members)
+		assert.Equal(t, []DepartmentAttributionCount{{Name: "ti-arch", Members: 2}, {Name: "Finance", Members: 1}}, capA.Departments)
+		assert.Equal(t, []DepartmentAttributionCount{{Name: "Architect", Members: 1}, {Name: "Controller", Members: 1}, {Name: "Developer", Members: 1}}, capA.JobTitles)
+
+		capB := report.Capabilities[1]
+		assert.True(t, capB.Mismatch)
+		assert.Equal(t, "ti-arch", capB.MajorityDepartment)
+		assert.Equal(t, 1.0, capB.MajorityShare)
+
+		capC := report.Capabilities[2]
+		assert.False(t, capC.Mismatch)
+		assert.Equal(t, "Finance", capC.ExpectedCostCentre)
+		assert.Contains(t, capC.Note, "no 'dfds.cost.centre' metadata")
+		if assert.Len(t, capC.MetadataIssues, 1) {
+			assert.Equal(t, ssu.MetadataIssueInvalidType, capC.MetadataIssues[0].Kind)
+		}
+	}
+}
+
+func TestAttributeDepartment(t *testing.T) {
+	mapping := map[string]string{"cloud engineering": "ti-platform"}
+
+	entry := &DepartmentAttributionReportCapability{CapabilityRootId: "cap-a", CostCentre: "ti-platform", Members: 4, Departments: []DepartmentAttributionCount{{Name: "Cloud Engineering", Members: 3}, {Name: departmentUnknown, Members: 1}}}
+	attributeDepartment(entry, mapping, 0.5)
+	assert.False(t, entry.Mismatch)
+	assert.Equal(t, "ti-platform", entry.ExpectedCostCentre)
+
+	// Members without a department count towards the total, but never make up the majority.
+	entry = &DepartmentAttributionReportCapability{CapabilityRootId: "cap-b", CostCentre: "finance", Members: 4, Departments: []DepartmentAttributionCount{{Name: departmentUnknown, Members: 3}, {Name: "Cloud Engineering", Members: 1}}}
+	attributeDepartment(entry, mapping, 0.5)
+	assert.False(t, entry.Mismatch)
+	assert.Empty(t, entry.MajorityDepartment)
+
+	entry = &DepartmentAttributionReportCapability{CapabilityRootId: "cap-c", CostCentre: "finance", Members: 2, Departments: []DepartmentAttributionCount{{Name: "Cloud Engineering", Members: 1}, {Name: "Finance", Members: 1}}}
+	attributeDepartment(entry, mapping, 0.5)
+	assert.False(t, entry.Mismatch)
+	assert.Empty(t, entry.MajorityDepartment)
+	assert.Equal(t, "No department has more than 50% of the members", entry.Note)
+
+	// A tie between the largest departments isn't a majority, even below the threshold.
+	entry = &DepartmentAttributionReportCapability{CapabilityRootId: "cap-c", CostCentre: "finance", Members: 4, Departments: []DepartmentAttributionCount{{Name: "Cloud Engineering", Members: 2}, {Name: "Finance", Members: 2}}}
+	attributeDepartment(entry, mapping, 0.25)
+	assert.False(t, entry.Mismatch)
+	assert.Empty(t, entry.MajorityDepartment)
+	assert.Equal(t, "Departments 'Cloud Engineering' and 'Finance' have the same number of members", entry.Note)
+
+	entry = &DepartmentAttributionReportCapability{CapabilityRootId: "cap-c", CostCentre: "finance", Members: 3, Departments: []DepartmentAttributionCount{{Name: "Cloud Engineering", Members: 2}, {Name: "Finance", Members: 1}}}
+	attributeDepartment(entry, mapping, 0.5)
+	assert.True(t, entry.Mismatch)
+	assert.Equal(t, "Cloud Engineering", entry.MajorityDepartment)
+
+	entry = &DepartmentAttributionReportCapability{CapabilityRootId: "cap-d", CostCentre: "finance", Members: 2, Departments: []DepartmentAttributionCount{{Name: "Cloud Engineering", Members: 1}, {Name: "Finance", Members: 1}}}
+	attributeDepartment(entry, mapping, 0.75)
+	assert.False(t, entry.Mismatch)
+	assert.Empty(t, entry.MajorityDepartment)
+}
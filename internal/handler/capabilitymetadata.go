@@ -0,0 +1,64 @@
+package handler
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"go.dfds.cloud/aad-finout-sync/internal/config"
+	"go.dfds.cloud/aad-finout-sync/internal/ssu"
+	"go.dfds.cloud/aad-finout-sync/internal/util"
+	"go.uber.org/zap"
+)
+
+// capabilityMetadataCache is shared by all handlers, so jobs running close to each other don't request the same metadata again.
+var capabilityMetadataCache = ssu.NewMetadataCache()
+
+var capabilityMetadataErrors *prometheus.CounterVec = promauto.NewCounterVec(prometheus.CounterOpts{
+	Name:      "capability_metadata_errors_total",
+	Help:      "Failed capability metadata requests by {job}, and whether a {stale} cached value was used instead.",
+	Namespace: "aad_finout_sync",
+}, []string{"job", "stale"})
+
+// getCapabilitiesMetadata returns the validated metadata of the capabilities with the given ids, keyed by capability id.
+// Capabilities whose metadata can't be fetched are logged and left out, unless an earlier value is cached, so one broken capability doesn't fail the job.
+// Invalid values are logged, missing values are left to the handlers as they know whether it matters.
+func getCapabilitiesMetadata(ctx context.Context, conf config.Config, client *ssu.Client, jobName string, ids []string) (map[string]*ssu.Metadata, error) {
+	results, err := client.GetCapabilitiesMetadata(ctx, ids, ssu.MetadataOptions{
+		Concurrency: conf.CapSvc.Metadata.Concurrency,
+		Cache:       capabilityMetadataCache,
+		MaxAge:      conf.CapSvc.Metadata.CacheTtl,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	payload := make(map[string]*ssu.Metadata)
+	failed := 0
+	for id, result := range results {
+		if result.Err != nil {
+			capabilityMetadataErrors.WithLabelValues(jobName, fmt.Sprintf("%t", result.Stale)).Inc()
+			if !result.Stale {
+				failed = failed + 1
+				util.Logger.Error(fmt.Sprintf("Unable to get metadata of capability %s, skipping", id), zap.String("jobName", jobName), zap.Error(result.Err))
+				continue
+			}
+			util.Logger.Warn(fmt.Sprintf("Unable to get metadata of capability %s, using earlier metadata", id), zap.String("jobName", jobName), zap.Error(result.Err))
+		}
+
+		metadata := ssu.ParseMetadata(result.Metadata)
+		for _, issue := range metadata.Issues {
+			if issue.Kind != ssu.MetadataIssueMissing {
+				util.Logger.Warn(fmt.Sprintf("Invalid metadata on capability %s, %s", id, issue), zap.String("jobName", jobName), zap.Any("value", issue.Value))
+			}
+		}
+		payload[id] = metadata
+	}
+
+	if failed > 0 {
+		util.Logger.Warn(fmt.Sprintf("Skipped %d of %d capabilities without metadata", failed, len(ids)), zap.String("jobName", jobName))
+	}
+
+	return payload, nil
+}
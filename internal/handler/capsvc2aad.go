@@ -4,6 +4,8 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"strings"
+	"time"
 
 	"github.com/joomcode/errorx"
 	"go.dfds.cloud/aad-finout-sync/internal/azure"
@@ -13,7 +15,6 @@ import (
 	"go.uber.org/zap"
 )
 
-const CAPABILITY_GROUP_PREFIX = "CI_SSU_Cap -"
 const CapabilityServiceToAzureAdName = "capSvcToAad"
 
 func Capsvc2AadHandler(ctx context.Context) error {
@@ -22,74 +23,78 @@ func Capsvc2AadHandler(ctx context.Context) error {
 		return err
 	}
 
-	groupsInAzure := make(map[string]*azure.Group)
-	capabilitiesByRootId := make(map[string]*ssu.GetCapabilitiesResponseContextCapability)
-	client := ssu.NewSsuClient(ssu.Config{
-		Host:         conf.CapSvc.Host,
-		TenantId:     conf.Azure.TenantId,
-		ClientId:     conf.CapSvc.ClientId,
-		ClientSecret: conf.CapSvc.ClientSecret,
-		Scope:        conf.CapSvc.TokenScope,
-	})
-
-	capabilities, err := client.GetCapabilities()
+	naming, err := newGroupNaming(conf)
 	if err != nil {
 		return err
 	}
 
-	azureClient := azure.NewAzureClient(azure.Config{
-		TenantId:     conf.Azure.TenantId,
-		ClientId:     conf.Azure.ClientId,
-		ClientSecret: conf.Azure.ClientSecret,
-	})
-
-	aUnits, err := azureClient.GetAdministrativeUnits()
+	capabilitiesByRootId := make(map[string]*ssu.GetCapabilitiesResponseContextCapability)
+	client, err := newSsuClient(conf)
 	if err != nil {
 		return err
 	}
 
-	aUnit := aUnits.GetUnit("Team - Cloud Engineering - Self service")
-	if aUnit == nil {
-		return errors.New("unable to find administrative unit")
+	capabilities, err := client.GetCapabilities(ctx)
+	if err != nil {
+		return err
 	}
 
-	aUnitMembers, err := azureClient.GetAdministrativeUnitMembers(aUnit.ID)
+	azureClient := newAzureClient(conf)
+
+	aUnitName := administrativeUnitName(conf)
+	aUnits, err := azureClient.GetAdministrativeUnits(ctx, aUnitName)
 	if err != nil {
 		return err
 	}
 
+	aUnit := aUnits.GetUnit(aUnitName)
+	if aUnit == nil {
+		return fmt.Errorf("unable to find administrative unit %s", aUnitName)
+	}
+
+	capabilityIds := make(map[string]string)         // keyed by root id
+	retainedCapabilityIds := make(map[string]string) // capabilities whose groups are kept, keyed by root id
 	for _, capability := range capabilities {
+		capabilityIds[capability.RootID] = capability.ID
+		// Groups of capabilities that don't keep their access are retired like those of capabilities that no longer exist.
+		if !capability.Lifecycle().KeepExistingAccess {
+			util.Logger.Debug(fmt.Sprintf("Capability %s is %s, treating it as removed", capability.RootID, capability.LifecycleStatus()), zap.String("jobName", CapabilityServiceToAzureAdName))
+			continue
+		}
+		retainedCapabilityIds[capability.RootID] = capability.ID
 		_, err := capability.GetContext()
 		if err == nil {
 			capabilitiesByRootId[capability.RootID] = capability
 		}
 	}
 
-	for _, member := range aUnitMembers.Value {
-		select {
-		case <-ctx.Done():
+	groupsInAzure, err := loadAzureGroups(ctx, conf, azureClient, naming, aUnit.ID, capabilityIds)
+	if err != nil {
+		if errors.Is(err, context.Canceled) {
 			util.Logger.Info("Job cancelled", zap.String("jobName", CapabilityServiceToAzureAdName))
 			return nil
-		default:
-			group := &azure.Group{
-				DisplayName: member.DisplayName,
-				ID:          member.ID,
-				Members:     []*azure.Member{},
-			}
-			groupMembers, err := azureClient.GetGroupMembers(member.ID)
-			if err != nil {
-				return err
-			}
+		}
+		return err
+	}
 
-			for _, groupMember := range groupMembers.Value {
-				group.Members = append(group.Members, &azure.Member{
-					ID:                groupMember.ID,
-					DisplayName:       groupMember.DisplayName,
-					UserPrincipalName: groupMember.UserPrincipalName,
-				})
-			}
+	inviter, err := newGuestInviter(conf, azureClient)
+	if err != nil {
+		return err
+	}
 
-			groupsInAzure[group.DisplayName] = group
+	resolver := azure.NewUserResolver(azureClient)
+	membershipBatch := azureClient.NewBatch(CapabilityServiceToAzureAdName)
+	membershipChanges := make(map[string]string)
+	disabledMembers := &DisabledMembersReport{GeneratedAt: time.Now().UTC(), Members: []DisabledMembersReportEntry{}}
+
+	if conf.Azure.OrphanGroups.Enabled {
+		err = retireOrphanedGroups(ctx, conf, azureClient, naming, aUnit.ID, groupsInAzure, retainedCapabilityIds, membershipBatch, membershipChanges)
+		if err != nil {
+			if errors.Is(err, context.Canceled) {
+				util.Logger.Info("Job cancelled", zap.String("jobName", CapabilityServiceToAzureAdName))
+				return nil
+			}
+			return err
 		}
 	}
 
@@ -100,17 +105,25 @@ func Capsvc2AadHandler(ctx context.Context) error {
 			return nil
 		default:
 		}
-		azureGroupName := fmt.Sprintf("%s %s", CAPABILITY_GROUP_PREFIX, rootId)
 		var azureGroup *azure.Group
+		lifecycle := capability.Lifecycle()
+		capabilityInviter := inviter
+		if !lifecycle.AllowNewResources {
+			capabilityInviter = nil
+		}
 
 		// Check if Capability has a group in Azure AD, if it doesn't create it
-		if resp, ok := groupsInAzure[azureGroupName]; !ok {
+		if resp, ok := groupsInAzure[rootId]; !ok {
+			if !lifecycle.AllowNewResources {
+				util.Logger.Debug(fmt.Sprintf("Capability %s is %s and has no group in Azure, skipping", rootId, capability.LifecycleStatus()), zap.String("jobName", CapabilityServiceToAzureAdName))
+				continue
+			}
 			util.Logger.Info(fmt.Sprintf("Capability %s doesn't exist in Azure, creating.\n", rootId), zap.String("jobName", CapabilityServiceToAzureAdName))
 			createGroupRequest := azure.CreateAdministrativeUnitGroupRequest{
 				OdataType:       "#Microsoft.Graph.Group",
-				Description:     "[Automated] - aad-finout-sync",
-				DisplayName:     azure.GenerateAzureGroupDisplayName(rootId),
-				MailNickname:    azure.GenerateAzureGroupMailPrefix(rootId),
+				Description:     naming.Description(),
+				DisplayName:     naming.DisplayName(rootId),
+				MailNickname:    naming.MailNickname(rootId),
 				GroupTypes:      []interface{}{},
 				MailEnabled:     false,
 				SecurityEnabled: true,
@@ -123,12 +136,23 @@ func Capsvc2AadHandler(ctx context.Context) error {
 			}
 
 			azureGroup = &azure.Group{ID: resp.ID, DisplayName: resp.DisplayName}
+
+			// A group without the capability extension is stamped by the next run, matching it by display name until then.
+			groupCapability := azure.CapabilityExtension{CapabilityId: capability.ID, RootId: rootId}
+			err = azureClient.SetGroupCapability(ctx, resp.ID, groupCapability)
+			if err != nil {
+				util.Logger.Warn(fmt.Sprintf("Unable to stamp capability %s on group %s", rootId, resp.DisplayName), zap.String("jobName", CapabilityServiceToAzureAdName), zap.Error(err))
+			} else {
+				azureGroup.Capability = &groupCapability
+			}
 		} else {
 			azureGroup = resp
 		}
 
 		// Add missing members in Azure AD group
 		if azureGroup != nil {
+			memberIds := make(map[string]string) // keyed by lower case email
+			isMember := make(map[string]bool)
 			for _, capMember := range capability.Members {
 				select {
 				case <-ctx.Done():
@@ -137,21 +161,36 @@ func Capsvc2AadHandler(ctx context.Context) error {
 				default:
 				}
 
-				if !azureGroup.HasMember(capMember.Email) {
-					util.Logger.Debug(fmt.Sprintf("Azure group %s missing member %s, adding.\n", azureGroup.DisplayName, capMember.Email), zap.String("jobName", CapabilityServiceToAzureAdName))
-					err = azureClient.AddGroupMember(azureGroup.ID, capMember.Email)
-					if err != nil {
-						if errorx.IsOfType(err, azure.AdUserNotFound) {
-							util.Logger.Debug(err.Error(), zap.String("jobName", CapabilityServiceToAzureAdName))
-							continue
-						}
-						if errorx.IsOfType(err, azure.HttpError403) {
-							util.Logger.Debug(err.Error(), zap.String("jobName", CapabilityServiceToAzureAdName))
-							continue
-						}
-
-						return err
+				memberId, disabled, err := resolveCapabilityMember(ctx, resolver, capabilityInviter, azureGroup, capMember.Email)
+				if err != nil {
+					if errors.Is(err, context.Canceled) {
+						util.Logger.Info("Job cancelled", zap.String("jobName", CapabilityServiceToAzureAdName))
+						return nil
 					}
+					return err
+				}
+				if memberId == "" {
+					util.Logger.Debug(fmt.Sprintf("User %s not found, skipping", capMember.Email), zap.String("jobName", CapabilityServiceToAzureAdName))
+					disabledMembers.add(capability, capMember.Email, "", MemberAccountNotFound)
+					continue
+				}
+				// Disabled users aren't counted as members, so leavers still listed by the capability service are removed from the group.
+				if disabled {
+					util.Logger.Debug(fmt.Sprintf("User %s is disabled, skipping", capMember.Email), zap.String("jobName", CapabilityServiceToAzureAdName))
+					disabledMembers.add(capability, capMember.Email, memberId, MemberAccountDisabled)
+					continue
+				}
+				memberIds[strings.ToLower(capMember.Email)] = memberId
+				isMember[memberId] = true
+
+				if !azureGroup.HasMemberId(memberId) {
+					if !lifecycle.AllowNewResources {
+						util.Logger.Debug(fmt.Sprintf("Capability %s is %s, not adding member %s", rootId, capability.LifecycleStatus(), capMember.Email), zap.String("jobName", CapabilityServiceToAzureAdName))
+						continue
+					}
+					util.Logger.Debug(fmt.Sprintf("Azure group %s missing member %s, adding.\n", azureGroup.DisplayName, capMember.Email), zap.String("jobName", CapabilityServiceToAzureAdName))
+					id := membershipBatch.AddGroupMember(azureGroup.ID, memberId)
+					membershipChanges[id] = fmt.Sprintf("add %s to %s", capMember.Email, azureGroup.DisplayName)
 				}
 			}
 
@@ -164,16 +203,95 @@ func Capsvc2AadHandler(ctx context.Context) error {
 				default:
 				}
 
-				if !capability.HasMember(member.UserPrincipalName) {
+				if !isMember[member.ID] {
 					util.Logger.Debug(fmt.Sprintf("Azure group %s contains stale member %s, removing.\n", azureGroup.DisplayName, member.UserPrincipalName), zap.String("jobName", CapabilityServiceToAzureAdName))
-					err = azureClient.DeleteGroupMember(azureGroup.ID, member.ID)
-					if err != nil {
-						return err
+					id := membershipBatch.DeleteGroupMember(azureGroup.ID, member.ID)
+					membershipChanges[id] = fmt.Sprintf("remove %s from %s", member.UserPrincipalName, azureGroup.DisplayName)
+				}
+			}
+
+			if conf.Azure.SyncOwners && lifecycle.AllowNewResources {
+				err = syncGroupOwners(ctx, azureClient, azureGroup, capability, memberIds, membershipBatch, membershipChanges)
+				if err != nil {
+					if errors.Is(err, context.Canceled) {
+						util.Logger.Info("Job cancelled", zap.String("jobName", CapabilityServiceToAzureAdName))
+						return nil
 					}
+					return err
 				}
 			}
+		}
+	}
+
+	storeDisabledMembersReport(disabledMembers)
+
+	return applyMembershipChanges(ctx, membershipBatch, membershipChanges)
+}
+
+// resolveCapabilityMember returns the object id of the user for a capability member's email, or an empty string if there is no such user,
+// and whether the user's account is disabled.
+// Members of the group whose user principal name matches are used as is, other emails are resolved by mail, user principal name and proxy addresses.
+// Members that can't be found are invited as guests, if their domain is allow-listed.
+func resolveCapabilityMember(ctx context.Context, resolver *azure.UserResolver, inviter *guestInviter, group *azure.Group, email string) (string, bool, error) {
+	if member := group.GetMemberByUpn(email); member != nil {
+		return member.ID, member.IsDisabled(), nil
+	}
+
+	user, err := resolver.Resolve(ctx, email)
+	if err == nil {
+		return user.ID, user.IsDisabled(), nil
+	}
+	if !errorx.IsOfType(err, azure.AdUserNotFound) {
+		return "", false, err
+	}
+
+	// Guests that were just invited might not be returned by queries yet.
+	if guestId, invited := inviter.guestId(email); invited {
+		return guestId, false, nil
+	}
 
+	if !inviter.canInvite(email) {
+		return "", false, nil
+	}
+
+	guestId, err := inviter.invite(ctx, email)
+	if err != nil {
+		util.Logger.Error(fmt.Sprintf("Unable to invite %s", email), zap.String("jobName", CapabilityServiceToAzureAdName), zap.Error(err))
+		return "", false, nil
+	}
+
+	return guestId, false, nil
+}
+
+// applyMembershipChanges sends the queued membership changes using Graph batching. Users that don't exist or can't be changed are skipped, like the single request calls.
+func applyMembershipChanges(ctx context.Context, batch *azure.Batch, changes map[string]string) error {
+	if batch.Len() == 0 {
+		return nil
+	}
+
+	util.Logger.Info(fmt.Sprintf("Applying %d membership changes", batch.Len()), zap.String("jobName", CapabilityServiceToAzureAdName))
+	results, err := batch.Execute(ctx)
+	if err != nil {
+		return err
+	}
+
+	failed := 0
+	for id, result := range results {
+		if result.Err == nil {
+			continue
+		}
+		if errorx.IsOfType(result.Err, azure.AdUserNotFound) || errorx.IsOfType(result.Err, azure.HttpError403) {
+			util.Logger.Debug(result.Err.Error(), zap.String("jobName", CapabilityServiceToAzureAdName))
+			continue
 		}
+
+		failed = failed + 1
+		util.Logger.Error(fmt.Sprintf("Unable to %s", changes[id]), zap.String("jobName", CapabilityServiceToAzureAdName), zap.Error(result.Err))
+	}
+
+	if failed > 0 {
+		return fmt.Errorf("unable to apply %d membership changes", failed)
 	}
+
 	return nil
 }
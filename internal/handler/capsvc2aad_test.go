@@ -0,0 +1,497 @@
+package handler
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"go.dfds.cloud/aad-finout-sync/internal/azure"
+	"go.dfds.cloud/aad-finout-sync/internal/azure/fakegraph"
+	"go.dfds.cloud/aad-finout-sync/internal/ssu"
+	"go.dfds.cloud/aad-finout-sync/internal/util"
+)
+
+const testAdministrativeUnitName = azure.DefaultAdministrativeUnit
+
+// newFakeCapSvc serves the capabilities returned by capabilities() on the legacy endpoint used by ssu.Client.GetCapabilities.
+func newFakeCapSvc(t *testing.T, capabilities func() []*ssu.GetCapabilitiesResponseContextCapability) *httptest.Server {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/system/legacy/aad-aws-sync" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		err := json.NewEncoder(w).Encode(capabilities())
+		assert.NoError(t, err)
+	}))
+	t.Cleanup(server.Close)
+
+	return server
+}
+
+// setupFakes points the configuration at a fake Graph server and a fake capability service.
+func setupFakes(t *testing.T, capabilities func() []*ssu.GetCapabilitiesResponseContextCapability) *fakegraph.Server {
+	util.InitializeLogger()
+
+	graph := fakegraph.NewServer()
+	t.Cleanup(graph.Close)
+	capSvc := newFakeCapSvc(t, capabilities)
+
+	t.Setenv("AAS_AZURE_TOKEN", "")
+	t.Setenv("AAS_CAPSVC_TOKEN", "")
+	t.Setenv("AFS_AZURE_TENANTID", "tenant")
+	t.Setenv("AFS_AZURE_GRAPHENDPOINT", graph.URL)
+	t.Setenv("AFS_AZURE_LOGINENDPOINT", graph.URL)
+	t.Setenv("AFS_CAPSVC_HOST", capSvc.URL)
+
+	return graph
+}
+
+func newTestCapability(rootId string, emails ...string) *ssu.GetCapabilitiesResponseContextCapability {
+	capability := &ssu.GetCapabilitiesResponseContextCapability{
+		ID:       rootId,
+		Name:     rootId,
+		RootID:   rootId,
+		Contexts: []*ssu.GetCapabilitiesResponseContext{{ID: "default", AwsAccountID: "123456789012"}},
+	}
+	for _, email := range emails {
+		capability.Members = append(capability.Members, &ssu.GetCapabilitiesResponseContextCapabilityMember{Email: email})
+	}
+
+	return capability
+}
+
+func TestCapsvc2AadHandler(t *testing.T) {
+	var capabilities []*ssu.GetCapabilitiesResponseContextCapability
+	graph := setupFakes(t, func() []*ssu.GetCapabilitiesResponseContextCapability { return capabilities })
+	graph.PageSize = 1
+
+	aUnitId := graph.AddAdministrativeUnit(testAdministrativeUnitName)
+	graph.AddUser("alice@example.com", "Alice")
+	bob := graph.AddUser("bob@example.com", "Bob")
+	carol := graph.AddUser("carol@example.com", "Carol")
+	capAGroupId := graph.AddGroup(aUnitId, "CI_SSU_Cap - cap-a", bob, carol)
+
+	capabilities = []*ssu.GetCapabilitiesResponseContextCapability{
+		newTestCapability("cap-a", "alice@example.com", "bob@example.com", "unknown@example.com"),
+		newTestCapability("cap-b", "carol@example.com"),
+	}
+	// Capabilities without an AWS account aren't synchronised.
+	capabilities = append(capabilities, &ssu.GetCapabilitiesResponseContextCapability{ID: "cap-c", RootID: "cap-c"})
+
+	err := Capsvc2AadHandler(context.Background())
+	assert.NoError(t, err)
+
+	assert.Equal(t, []string{"alice@example.com", "bob@example.com"}, graph.GroupMemberUpns(capAGroupId))
+
+	capBGroup := graph.GroupByName("CI_SSU_Cap - cap-b")
+	if assert.NotNil(t, capBGroup) {
+		assert.Equal(t, "ci-ssu_cap_cap-b", capBGroup.MailNickname)
+		assert.Equal(t, []string{"carol@example.com"}, graph.GroupMemberUpns(capBGroup.ID))
+	}
+	assert.Nil(t, graph.GroupByName("CI_SSU_Cap - cap-c"))
+}
+
+func TestCapsvc2AadHandler_Delta(t *testing.T) {
+	var capabilities []*ssu.GetCapabilitiesResponseContextCapability
+	graph := setupFakes(t, func() []*ssu.GetCapabilitiesResponseContextCapability { return capabilities })
+	t.Setenv("AFS_AZURE_DELTA_ENABLED", "true")
+	t.Setenv("AFS_AZURE_DELTA_STATEFILE", filepath.Join(t.TempDir(), "delta.json"))
+
+	aUnitId := graph.AddAdministrativeUnit(testAdministrativeUnitName)
+	graph.AddUser("alice@example.com", "Alice")
+	dave := graph.AddUser("dave@example.com", "Dave")
+	capAGroupId := graph.AddGroup(aUnitId, "CI_SSU_Cap - cap-a")
+
+	capabilities = []*ssu.GetCapabilitiesResponseContextCapability{
+		newTestCapability("cap-a", "alice@example.com"),
+	}
+
+	err := Capsvc2AadHandler(context.Background())
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"alice@example.com"}, graph.GroupMemberUpns(capAGroupId))
+
+	// Changes made outside of the sync are picked up from the delta, without listing the administrative unit again.
+	graph.AddGroupMember(capAGroupId, dave)
+	graph.ResetRequests()
+
+	err = Capsvc2AadHandler(context.Background())
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"alice@example.com"}, graph.GroupMemberUpns(capAGroupId))
+	for _, req := range graph.Requests() {
+		assert.False(t, strings.HasSuffix(req, "/members") && strings.HasPrefix(req, "GET "), req)
+	}
+
+	// An expired delta token results in a full sync.
+	graph.AddGroupMember(capAGroupId, dave)
+	graph.ExpireDeltaTokens()
+
+	err = Capsvc2AadHandler(context.Background())
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"alice@example.com"}, graph.GroupMemberUpns(capAGroupId))
+
+	// Groups outside of the administrative unit aren't adopted from the delta, even if they are named like capability groups.
+	outsideGroupId := graph.AddGroup("", "CI_SSU_Cap - cap-b", dave)
+	capabilities = append(capabilities, newTestCapability("cap-b", "alice@example.com"))
+
+	err = Capsvc2AadHandler(context.Background())
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"dave@example.com"}, graph.GroupMemberUpns(outsideGroupId))
+
+	// A failing user lookup doesn't drop the member from the snapshot, a full sync is done instead.
+	graph.AddGroupMember(capAGroupId, dave)
+	graph.FailRequests("GET", "/v1.0/users/"+dave, http.StatusServiceUnavailable)
+	graph.ResetRequests()
+
+	err = Capsvc2AadHandler(context.Background())
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"alice@example.com"}, graph.GroupMemberUpns(capAGroupId))
+	assert.Contains(t, graph.Requests(), "GET /v1.0/groups/"+capAGroupId+"/members")
+}
+
+func TestCapsvc2AadHandler_OrphanedGroups(t *testing.T) {
+	var capabilities []*ssu.GetCapabilitiesResponseContextCapability
+	graph := setupFakes(t, func() []*ssu.GetCapabilitiesResponseContextCapability { return capabilities })
+	t.Setenv("AFS_AZURE_ORPHANGROUPS_ENABLED", "true")
+	t.Setenv("AFS_AZURE_ORPHANGROUPS_EMPTYAFTER", "1h")
+	t.Setenv("AFS_AZURE_ORPHANGROUPS_GRACEPERIOD", "24h")
+
+	aUnitId := graph.AddAdministrativeUnit(testAdministrativeUnitName)
+	alice := graph.AddUser("alice@example.com", "Alice")
+	bob := graph.AddUser("bob@example.com", "Bob")
+	capAGroupId := graph.AddGroup(aUnitId, "CI_SSU_Cap - cap-a", alice)
+	capGoneGroupId := graph.AddGroup(aUnitId, "CI_SSU_Cap - cap-gone", bob)
+	capEmptyGroupId := graph.AddGroup(aUnitId, "CI_SSU_Cap - cap-empty", alice, bob)
+	capOldGroupId := graph.AddGroup(aUnitId, "CI_SSU_Cap - cap-old", bob)
+	otherGroupId := graph.AddGroup(aUnitId, "Some other group", bob)
+
+	graph.SetGroupDescription(capEmptyGroupId, azure.DefaultGroupDescription+orphanedGroupMarker+time.Now().Add(-2*time.Hour).UTC().Format(time.RFC3339))
+	graph.SetGroupDescription(capOldGroupId, azure.DefaultGroupDescription+orphanedGroupMarker+time.Now().Add(-48*time.Hour).UTC().Format(time.RFC3339))
+
+	capabilities = []*ssu.GetCapabilitiesResponseContextCapability{
+		newTestCapability("cap-a", "alice@example.com"),
+	}
+
+	err := Capsvc2AadHandler(context.Background())
+	assert.NoError(t, err)
+
+	assert.Equal(t, []string{"alice@example.com"}, graph.GroupMemberUpns(capAGroupId))
+
+	// Newly orphaned groups are marked, but keep their members.
+	capGoneGroup := graph.GroupByName("CI_SSU_Cap - cap-gone")
+	if assert.NotNil(t, capGoneGroup) {
+		_, marked := orphanedSince(capGoneGroup.Description)
+		assert.True(t, marked)
+		assert.Equal(t, []string{"bob@example.com"}, graph.GroupMemberUpns(capGoneGroupId))
+	}
+
+	assert.Empty(t, graph.GroupMemberUpns(capEmptyGroupId))
+	assert.Nil(t, graph.GroupByName("CI_SSU_Cap - cap-old"))
+	assert.Equal(t, []string{"bob@example.com"}, graph.GroupMemberUpns(otherGroupId))
+
+	// A capability that reappears has its group unmarked and its members restored.
+	capabilities = append(capabilities, newTestCapability("cap-gone", "alice@example.com"))
+
+	err = Capsvc2AadHandler(context.Background())
+	assert.NoError(t, err)
+
+	assert.Equal(t, azure.DefaultGroupDescription, graph.GroupByName("CI_SSU_Cap - cap-gone").Description)
+	assert.Equal(t, []string{"alice@example.com"}, graph.GroupMemberUpns(capGoneGroupId))
+}
+
+func TestCapsvc2AadHandler_OrphanedGroupsGuard(t *testing.T) {
+	var capabilities []*ssu.GetCapabilitiesResponseContextCapability
+	graph := setupFakes(t, func() []*ssu.GetCapabilitiesResponseContextCapability { return capabilities })
+	t.Setenv("AFS_AZURE_ORPHANGROUPS_ENABLED", "true")
+
+	aUnitId := graph.AddAdministrativeUnit(testAdministrativeUnitName)
+	graph.AddGroup(aUnitId, "CI_SSU_Cap - cap-a")
+	graph.AddGroup(aUnitId, "CI_SSU_Cap - cap-b")
+	graph.AddGroup(aUnitId, "CI_SSU_Cap - cap-c")
+
+	marked := func() []string {
+		var payload []string
+		for _, name := range []string{"CI_SSU_Cap - cap-a", "CI_SSU_Cap - cap-b", "CI_SSU_Cap - cap-c"} {
+			if _, ok := orphanedSince(graph.GroupByName(name).Description); ok {
+				payload = append(payload, name)
+			}
+		}
+		return payload
+	}
+
+	// An empty capability list doesn't orphan anything.
+	err := Capsvc2AadHandler(context.Background())
+	assert.NoError(t, err)
+	assert.Empty(t, marked())
+
+	// Neither does one that would orphan more than half of the groups.
+	capabilities = []*ssu.GetCapabilitiesResponseContextCapability{newTestCapability("cap-a")}
+	err = Capsvc2AadHandler(context.Background())
+	assert.NoError(t, err)
+	assert.Empty(t, marked())
+
+	t.Setenv("AFS_AZURE_ORPHANGROUPS_ALLOWEMPTY", "true")
+	err = Capsvc2AadHandler(context.Background())
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"CI_SSU_Cap - cap-b", "CI_SSU_Cap - cap-c"}, marked())
+}
+
+func TestCapsvc2AadHandler_LifecycleStatus(t *testing.T) {
+	var capabilities []*ssu.GetCapabilitiesResponseContextCapability
+	graph := setupFakes(t, func() []*ssu.GetCapabilitiesResponseContextCapability { return capabilities })
+	t.Setenv("AFS_AZURE_ORPHANGROUPS_ENABLED", "true")
+	t.Setenv("AFS_AZURE_ORPHANGROUPS_EMPTYAFTER", "1h")
+	t.Setenv("AFS_AZURE_ORPHANGROUPS_GRACEPERIOD", "24h")
+
+	aUnitId := graph.AddAdministrativeUnit(testAdministrativeUnitName)
+	graph.AddUser("alice@example.com", "Alice")
+	bob := graph.AddUser("bob@example.com", "Bob")
+	carol := graph.AddUser("carol@example.com", "Carol")
+	pendingGroupId := graph.AddGroup(aUnitId, "CI_SSU_Cap - cap-pending", bob, carol)
+	deletedGroupId := graph.AddGroup(aUnitId, "CI_SSU_Cap - cap-deleted", bob)
+
+	pending := newTestCapability("cap-pending", "alice@example.com", "bob@example.com")
+	pending.Status = ssu.CapabilityStatusPendingDeletion
+	pendingNew := newTestCapability("cap-pending-new", "alice@example.com")
+	pendingNew.Status = "PendingDeletion"
+	deleted := newTestCapability("cap-deleted", "bob@example.com")
+	deleted.Status = ssu.CapabilityStatusDeleted
+	capabilities = []*ssu.GetCapabilitiesResponseContextCapability{pending, pendingNew, deleted}
+
+	err := Capsvc2AadHandler(context.Background())
+	assert.NoError(t, err)
+
+	// Capabilities pending deletion keep their members, but get no new members or groups.
+	assert.Equal(t, []string{"bob@example.com"}, graph.GroupMemberUpns(pendingGroupId))
+	assert.Nil(t, graph.GroupByName("CI_SSU_Cap - cap-pending-new"))
+
+	// Groups of deleted capabilities are retired like orphaned groups.
+	deletedGroup := graph.GroupByName("CI_SSU_Cap - cap-deleted")
+	if assert.NotNil(t, deletedGroup) {
+		_, marked := orphanedSince(deletedGroup.Description)
+		assert.True(t, marked)
+		assert.Equal(t, []string{"bob@example.com"}, graph.GroupMemberUpns(deletedGroupId))
+	}
+}
+
+func TestOrphanedSince(t *testing.T) {
+	since, marked := orphanedSince("[Automated] - aad-finout-sync - orphaned since 2024-03-01T10:00:00Z")
+	assert.True(t, marked)
+	assert.Equal(t, time.Date(2024, 3, 1, 10, 0, 0, 0, time.UTC), since)
+
+	_, marked = orphanedSince("[Automated] - aad-finout-sync")
+	assert.False(t, marked)
+
+	_, marked = orphanedSince("[Automated] - aad-finout-sync - orphaned since yesterday")
+	assert.False(t, marked)
+}
+
+func TestCapsvc2AadHandler_InviteGuests(t *testing.T) {
+	var capabilities []*ssu.GetCapabilitiesResponseContextCapability
+	graph := setupFakes(t, func() []*ssu.GetCapabilitiesResponseContextCapability { return capabilities })
+	t.Setenv("AFS_AZURE_INVITATIONS_ENABLED", "true")
+	t.Setenv("AFS_AZURE_INVITATIONS_ALLOWEDDOMAINS", "partner.com")
+	t.Setenv("AFS_AZURE_INVITATIONS_STATEFILE", filepath.Join(t.TempDir(), "invitations.json"))
+
+	aUnitId := graph.AddAdministrativeUnit(testAdministrativeUnitName)
+	graph.AddUser("alice@example.com", "Alice")
+	capAGroupId := graph.AddGroup(aUnitId, "CI_SSU_Cap - cap-a")
+	capBGroupId := graph.AddGroup(aUnitId, "CI_SSU_Cap - cap-b")
+
+	capabilities = []*ssu.GetCapabilitiesResponseContextCapability{
+		newTestCapability("cap-a", "alice@example.com", "contractor@partner.com", "someone@elsewhere.com"),
+		newTestCapability("cap-b", " Contractor@Partner.com"),
+	}
+
+	err := Capsvc2AadHandler(context.Background())
+	assert.NoError(t, err)
+
+	// Whichever capability is synchronised first, the guest is invited in lower case.
+	assert.Equal(t, []string{"contractor@partner.com"}, graph.Invitations())
+	guestUpn := "contractor_partner.com#EXT#@fake.onmicrosoft.com"
+	assert.Equal(t, []string{"alice@example.com", guestUpn}, graph.GroupMemberUpns(capAGroupId))
+	assert.Equal(t, []string{guestUpn}, graph.GroupMemberUpns(capBGroupId))
+
+	// Guests aren't invited again, and aren't removed as stale members.
+	err = Capsvc2AadHandler(context.Background())
+	assert.NoError(t, err)
+
+	assert.Len(t, graph.Invitations(), 1)
+	assert.Equal(t, []string{"alice@example.com", guestUpn}, graph.GroupMemberUpns(capAGroupId))
+	assert.Equal(t, []string{guestUpn}, graph.GroupMemberUpns(capBGroupId))
+}
+
+func TestCapsvc2AadHandler_ResolvesUsersByMailAndAlias(t *testing.T) {
+	var capabilities []*ssu.GetCapabilitiesResponseContextCapability
+	graph := setupFakes(t, func() []*ssu.GetCapabilitiesResponseContextCapability { return capabilities })
+
+	aUnitId := graph.AddAdministrativeUnit(testAdministrativeUnitName)
+	graph.AddUserWithMail("alice.a@example.onmicrosoft.com", "alice@example.com", "Alice")
+	graph.AddUserWithMail("bob@example.com", "bob@example.com", "Bob", "SMTP:bob@example.com", "smtp:robert@example.com")
+	capAGroupId := graph.AddGroup(aUnitId, "CI_SSU_Cap - cap-a")
+
+	capabilities = []*ssu.GetCapabilitiesResponseContextCapability{
+		newTestCapability("cap-a", "alice@example.com", "robert@example.com"),
+	}
+
+	err := Capsvc2AadHandler(context.Background())
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"alice.a@example.onmicrosoft.com", "bob@example.com"}, graph.GroupMemberUpns(capAGroupId))
+
+	// Members whose user principal name differs from their email aren't removed and added again.
+	graph.ResetRequests()
+	err = Capsvc2AadHandler(context.Background())
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"alice.a@example.onmicrosoft.com", "bob@example.com"}, graph.GroupMemberUpns(capAGroupId))
+	assert.NotContains(t, graph.Requests(), "POST /v1.0/$batch")
+}
+
+func TestCapsvc2AadHandler_SyncOwners(t *testing.T) {
+	var capabilities []*ssu.GetCapabilitiesResponseContextCapability
+	graph := setupFakes(t, func() []*ssu.GetCapabilitiesResponseContextCapability { return capabilities })
+	t.Setenv("AFS_AZURE_SYNCOWNERS", "true")
+
+	aUnitId := graph.AddAdministrativeUnit(testAdministrativeUnitName)
+	graph.AddUser("alice@example.com", "Alice")
+	graph.AddUser("bob@example.com", "Bob")
+	carol := graph.AddUser("carol@example.com", "Carol")
+	capAGroupId := graph.AddGroup(aUnitId, "CI_SSU_Cap - cap-a")
+	capBGroupId := graph.AddGroup(aUnitId, "CI_SSU_Cap - cap-b")
+	capCGroupId := graph.AddGroup(aUnitId, "CI_SSU_Cap - cap-c")
+	graph.AddGroupOwner(capAGroupId, carol)
+	graph.AddGroupOwner(capAGroupId, "service-principal")
+	graph.AddGroupOwner(capBGroupId, carol)
+	graph.AddGroupOwner(capCGroupId, carol)
+
+	capA := newTestCapability("cap-a", "alice@example.com", "bob@example.com")
+	capA.Members[0].Role = ssu.MemberRoleOwner
+	capA.Members[1].Role = ssu.MemberRoleMember
+	// The only owner of cap-c isn't in Azure AD, so there's no owner to replace carol with.
+	capC := newTestCapability("cap-c", "dave@example.com", "bob@example.com")
+	capC.Members[0].Role = ssu.MemberRoleOwner
+	capC.Members[1].Role = ssu.MemberRoleMember
+	capabilities = []*ssu.GetCapabilitiesResponseContextCapability{
+		capA,
+		// Without member roles, owners are left alone.
+		newTestCapability("cap-b", "bob@example.com"),
+		capC,
+	}
+
+	err := Capsvc2AadHandler(context.Background())
+	assert.NoError(t, err)
+
+	assert.Equal(t, []string{"alice@example.com", "service-principal"}, graph.GroupOwners(capAGroupId))
+	assert.Equal(t, []string{"carol@example.com"}, graph.GroupOwners(capBGroupId))
+	assert.Equal(t, []string{"carol@example.com"}, graph.GroupOwners(capCGroupId))
+}
+
+func TestCapsvc2AadHandler_CustomNaming(t *testing.T) {
+	var capabilities []*ssu.GetCapabilitiesResponseContextCapability
+	graph := setupFakes(t, func() []*ssu.GetCapabilitiesResponseContextCapability { return capabilities })
+	t.Setenv("AFS_AZURE_GROUPS_ADMINISTRATIVEUNIT", "Sandbox")
+	t.Setenv("AFS_AZURE_GROUPS_DISPLAYNAMETEMPLATE", "SBX_Cap - {rootId}")
+	t.Setenv("AFS_AZURE_GROUPS_MAILNICKNAMETEMPLATE", "sbx-cap-{rootId}")
+	t.Setenv("AFS_AZURE_GROUPS_DESCRIPTION", "Sandbox capability group")
+
+	graph.AddAdministrativeUnit(testAdministrativeUnitName)
+	graph.AddAdministrativeUnit("Sandbox")
+	graph.AddUser("alice@example.com", "Alice")
+
+	capabilities = []*ssu.GetCapabilitiesResponseContextCapability{
+		newTestCapability("cap-a", "alice@example.com"),
+	}
+
+	err := Capsvc2AadHandler(context.Background())
+	assert.NoError(t, err)
+
+	group := graph.GroupByName("SBX_Cap - cap-a")
+	if assert.NotNil(t, group) {
+		assert.Equal(t, "sbx-cap-cap-a", group.MailNickname)
+		assert.Equal(t, "Sandbox capability group", group.Description)
+		assert.Equal(t, []string{"alice@example.com"}, graph.GroupMemberUpns(group.ID))
+	}
+	assert.Nil(t, graph.GroupByName("CI_SSU_Cap - cap-a"))
+}
+
+func TestCapsvc2AadHandler_DisabledMembers(t *testing.T) {
+	var capabilities []*ssu.GetCapabilitiesResponseContextCapability
+	graph := setupFakes(t, func() []*ssu.GetCapabilitiesResponseContextCapability { return capabilities })
+
+	aUnitId := graph.AddAdministrativeUnit(testAdministrativeUnitName)
+	graph.AddUser("alice@example.com", "Alice")
+	bob := graph.AddUser("bob@example.com", "Bob")
+	carol := graph.AddUser("carol@example.com", "Carol")
+	capAGroupId := graph.AddGroup(aUnitId, "CI_SSU_Cap - cap-a", bob)
+	graph.SetUserAccountEnabled(bob, false)
+	graph.SetUserAccountEnabled(carol, false)
+
+	capabilities = []*ssu.GetCapabilitiesResponseContextCapability{
+		newTestCapability("cap-a", "alice@example.com", "bob@example.com", "carol@example.com", "dave@example.com"),
+	}
+
+	err := Capsvc2AadHandler(context.Background())
+	assert.NoError(t, err)
+
+	// Disabled users are neither added nor kept.
+	assert.Equal(t, []string{"alice@example.com"}, graph.GroupMemberUpns(capAGroupId))
+
+	report, ok := GetDisabledMembersReport()
+	if assert.True(t, ok) && assert.Len(t, report.Members, 3) {
+		assert.Equal(t, DisabledMembersReportEntry{CapabilityId: "cap-a", CapabilityRootId: "cap-a", CapabilityName: "cap-a", Email: "bob@example.com", UserId: bob, Reason: MemberAccountDisabled}, report.Members[0])
+		assert.Equal(t, DisabledMembersReportEntry{CapabilityId: "cap-a", CapabilityRootId: "cap-a", CapabilityName: "cap-a", Email: "carol@example.com", UserId: carol, Reason: MemberAccountDisabled}, report.Members[1])
+		assert.Equal(t, MemberAccountNotFound, report.Members[2].Reason)
+		assert.Equal(t, "dave@example.com", report.Members[2].Email)
+	}
+}
+
+func TestCapsvc2AadHandler_CapabilityExtension(t *testing.T) {
+	for _, delta := range []bool{false, true} {
+		t.Run(fmt.Sprintf("delta=%t", delta), func(t *testing.T) {
+			var capabilities []*ssu.GetCapabilitiesResponseContextCapability
+			graph := setupFakes(t, func() []*ssu.GetCapabilitiesResponseContextCapability { return capabilities })
+			if delta {
+				t.Setenv("AFS_AZURE_DELTA_ENABLED", "true")
+				t.Setenv("AFS_AZURE_DELTA_STATEFILE", filepath.Join(t.TempDir(), "delta.json"))
+			}
+
+			aUnitId := graph.AddAdministrativeUnit(testAdministrativeUnitName)
+			graph.AddUser("alice@example.com", "Alice")
+			graph.AddUser("bob@example.com", "Bob")
+			capAGroupId := graph.AddGroup(aUnitId, "CI_SSU_Cap - cap-a")
+
+			capA := newTestCapability("cap-a", "alice@example.com")
+			capA.ID = "cap-a-id"
+			capabilities = []*ssu.GetCapabilitiesResponseContextCapability{
+				capA,
+				newTestCapability("cap-b", "bob@example.com"),
+			}
+
+			err := Capsvc2AadHandler(context.Background())
+			assert.NoError(t, err)
+
+			// Existing groups are backfilled, new groups are stamped when created.
+			capAExtension := graph.GroupExtension(capAGroupId, azure.CapabilityExtensionName)
+			assert.Equal(t, "cap-a-id", capAExtension["capabilityId"])
+			assert.Equal(t, "cap-a", capAExtension["rootId"])
+			capBGroup := graph.GroupByName("CI_SSU_Cap - cap-b")
+			if assert.NotNil(t, capBGroup) {
+				assert.Equal(t, "cap-b", graph.GroupExtension(capBGroup.ID, azure.CapabilityExtensionName)["rootId"])
+			}
+
+			// Renamed groups are still matched to their capability.
+			graph.RenameGroup(capAGroupId, "Renamed by hand")
+			capA.Members = append(capA.Members, &ssu.GetCapabilitiesResponseContextCapabilityMember{Email: "bob@example.com"})
+
+			err = Capsvc2AadHandler(context.Background())
+			assert.NoError(t, err)
+			assert.Nil(t, graph.GroupByName("CI_SSU_Cap - cap-a"))
+			assert.Equal(t, []string{"alice@example.com", "bob@example.com"}, graph.GroupMemberUpns(capAGroupId))
+		})
+	}
+}
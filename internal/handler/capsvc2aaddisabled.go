@@ -0,0 +1,83 @@
+package handler
+
+import (
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"go.dfds.cloud/aad-finout-sync/internal/ssu"
+)
+
+const (
+	MemberAccountDisabled = "disabled"
+	MemberAccountNotFound = "notFound"
+)
+
+var capabilityMembersInactive *prometheus.GaugeVec = promauto.NewGaugeVec(prometheus.GaugeOpts{
+	Name:      "capability_members_inactive",
+	Help:      "Amount of capability members that aren't synced to Azure AD because their account is disabled or doesn't exist, by {reason}.",
+	Namespace: "aad_finout_sync",
+}, []string{"reason"})
+
+// DisabledMembersReport lists the capability members whose directory account is disabled or can't be found, so they can be removed from the capability.
+type DisabledMembersReport struct {
+	GeneratedAt time.Time                    `json:"generatedAt"`
+	Members     []DisabledMembersReportEntry `json:"members"`
+}
+
+type DisabledMembersReportEntry struct {
+	CapabilityId     string `json:"capabilityId"`
+	CapabilityRootId string `json:"capabilityRootId"`
+	CapabilityName   string `json:"capabilityName"`
+	Email            string `json:"email"`
+	UserId           string `json:"userId,omitempty"`
+	Reason           string `json:"reason"`
+}
+
+func (r *DisabledMembersReport) add(capability *ssu.GetCapabilitiesResponseContextCapability, email string, userId string, reason string) {
+	r.Members = append(r.Members, DisabledMembersReportEntry{
+		CapabilityId:     capability.ID,
+		CapabilityRootId: capability.RootID,
+		CapabilityName:   capability.Name,
+		Email:            email,
+		UserId:           userId,
+		Reason:           reason,
+	})
+}
+
+// latestDisabledMembersReport is the report of the last completed Capsvc2AadHandler run.
+var latestDisabledMembersReport = struct {
+	mu     sync.Mutex
+	report *DisabledMembersReport
+}{}
+
+func storeDisabledMembersReport(report *DisabledMembersReport) {
+	sort.Slice(report.Members, func(i, j int) bool {
+		if report.Members[i].CapabilityRootId != report.Members[j].CapabilityRootId {
+			return report.Members[i].CapabilityRootId < report.Members[j].CapabilityRootId
+		}
+		return report.Members[i].Email < report.Members[j].Email
+	})
+
+	reasons := map[string]int{MemberAccountDisabled: 0, MemberAccountNotFound: 0}
+	for _, member := range report.Members {
+		reasons[member.Reason] = reasons[member.Reason] + 1
+	}
+	for reason, count := range reasons {
+		capabilityMembersInactive.WithLabelValues(reason).Set(float64(count))
+	}
+
+	latestDisabledMembersReport.mu.Lock()
+	defer latestDisabledMembersReport.mu.Unlock()
+	latestDisabledMembersReport.report = report
+}
+
+// GetDisabledMembersReport returns the disabled members found by the last run of the capability service to Azure AD sync, or false if it hasn't completed yet.
+func GetDisabledMembersReport() (*DisabledMembersReport, bool) {
+	latestDisabledMembersReport.mu.Lock()
+	defer latestDisabledMembersReport.mu.Unlock()
+
+	return latestDisabledMembersReport.report, latestDisabledMembersReport.report != nil
+}
@@ -0,0 +1,305 @@
+package handler
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/joomcode/errorx"
+	"go.dfds.cloud/aad-finout-sync/internal/azure"
+	"go.dfds.cloud/aad-finout-sync/internal/config"
+	"go.dfds.cloud/aad-finout-sync/internal/util"
+	"go.uber.org/zap"
+)
+
+// capsvc2AadState is the snapshot of the capability groups in Azure AD that delta queries are applied to.
+type capsvc2AadState struct {
+	DeltaLink    string                  `json:"deltaLink"`
+	LastFullSync time.Time               `json:"lastFullSync"`
+	Groups       map[string]*azure.Group `json:"groups"` // keyed by group id
+}
+
+// loadAzureGroups returns the capability groups in the administrative unit and their members, keyed by capability root id.
+// Groups are matched to their capability by the capability extension, or by display name for groups without one. Groups matched by display name
+// are stamped with the capability extension, if capabilityIds (capability ids keyed by root id) contains their capability.
+// If delta sync is enabled, only the changes since the last run are requested from Azure AD. A full sync is done when there is no usable state,
+// the delta token has expired or the full resync interval has passed. Disabling an account isn't a group change, so with delta sync
+// the account status of existing members is only refreshed by full syncs.
+func loadAzureGroups(ctx context.Context, conf config.Config, azureClient *azure.Client, naming *azure.GroupNaming, aUnitId string, capabilityIds map[string]string) (map[string]*azure.Group, error) {
+	if !conf.Azure.Delta.Enabled {
+		groups, err := loadAzureGroupsFull(ctx, azureClient, aUnitId)
+		if err != nil {
+			return nil, err
+		}
+		err = backfillGroupCapabilities(ctx, azureClient, naming, groups, capabilityIds)
+		if err != nil {
+			return nil, err
+		}
+		return groupsByRootId(naming, groups), nil
+	}
+
+	stateFile := jobStateFile("delta", conf.Azure.Delta.StateFile)
+
+	var state capsvc2AadState
+	found, err := stateFile.Load(&state)
+	if err != nil {
+		util.Logger.Warn("Unable to load delta state, doing a full sync", zap.String("jobName", CapabilityServiceToAzureAdName), zap.Error(err))
+		found = false
+	}
+
+	fullSync := !found || state.DeltaLink == "" || state.Groups == nil
+	if found && conf.Azure.Delta.FullResyncInterval > 0 && time.Since(state.LastFullSync) > conf.Azure.Delta.FullResyncInterval {
+		util.Logger.Info("Full resync interval has passed, doing a full sync", zap.String("jobName", CapabilityServiceToAzureAdName))
+		fullSync = true
+	}
+
+	if !fullSync {
+		err = applyGroupsDelta(ctx, azureClient, naming, aUnitId, &state)
+		if err != nil {
+			if ctx.Err() != nil {
+				return nil, ctx.Err()
+			}
+			// A snapshot that misses changes would go unnoticed until the next full sync, so it is rebuilt instead.
+			if errorx.IsOfType(err, azure.DeltaTokenExpired) {
+				util.Logger.Info("Delta token has expired, doing a full sync", zap.String("jobName", CapabilityServiceToAzureAdName))
+			} else {
+				util.Logger.Warn("Unable to apply delta changes, doing a full sync", zap.String("jobName", CapabilityServiceToAzureAdName), zap.Error(err))
+			}
+			fullSync = true
+		}
+	}
+
+	if fullSync {
+		// The delta link is requested before listing, so changes made while listing are picked up by the next run.
+		deltaLink, err := azureClient.GetGroupsDeltaLatest(ctx)
+		if err != nil {
+			return nil, err
+		}
+
+		groups, err := loadAzureGroupsFull(ctx, azureClient, aUnitId)
+		if err != nil {
+			return nil, err
+		}
+
+		state = capsvc2AadState{
+			DeltaLink:    deltaLink,
+			LastFullSync: time.Now(),
+			Groups:       make(map[string]*azure.Group),
+		}
+		for _, group := range groups {
+			state.Groups[group.ID] = group
+		}
+	}
+
+	groups := make([]*azure.Group, 0, len(state.Groups))
+	for _, group := range state.Groups {
+		groups = append(groups, group)
+	}
+
+	// Backfilling before saving keeps the stamped capabilities in the snapshot, as extension changes aren't returned by delta queries.
+	err = backfillGroupCapabilities(ctx, azureClient, naming, groups, capabilityIds)
+	if err != nil {
+		return nil, err
+	}
+
+	err = stateFile.Save(state)
+	if err != nil {
+		return nil, err
+	}
+
+	return groupsByRootId(naming, groups), nil
+}
+
+func loadAzureGroupsFull(ctx context.Context, azureClient *azure.Client, aUnitId string) ([]*azure.Group, error) {
+	aUnitMembers, err := azureClient.GetAdministrativeUnitMembers(ctx, aUnitId)
+	if err != nil {
+		return nil, err
+	}
+
+	var groups []*azure.Group
+	for _, member := range aUnitMembers.Value {
+		group := &azure.Group{
+			DisplayName: member.DisplayName,
+			ID:          member.ID,
+			Members:     []*azure.Member{},
+		}
+		if description, ok := member.Description.(string); ok {
+			group.Description = description
+		}
+		capability, err := azureClient.GetGroupCapability(ctx, member.ID)
+		if err != nil {
+			return nil, err
+		}
+		group.Capability = capability
+
+		err = azureClient.ListGroupMembers(member.ID, &azure.QueryOptions{Select: []string{"id", "displayName", "userPrincipalName", "accountEnabled", "department", "jobTitle"}}).ForEach(ctx, func(groupMember azure.GroupMembersMember) error {
+			group.Members = append(group.Members, &azure.Member{
+				ID:                groupMember.ID,
+				DisplayName:       groupMember.DisplayName,
+				UserPrincipalName: groupMember.UserPrincipalName,
+				AccountEnabled:    groupMember.AccountEnabled,
+				Department:        groupMember.Department,
+				JobTitle:          groupMember.JobTitle,
+			})
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+
+		groups = append(groups, group)
+	}
+
+	return groups, nil
+}
+
+// applyGroupsDelta updates the snapshot in state with the changes since state.DeltaLink. The delta covers every group in the tenant, so groups that
+// aren't in the snapshot are only picked up if they are capability groups in the administrative unit, e.g. groups created by a previous run.
+// On error, state is partially updated and must be discarded.
+func applyGroupsDelta(ctx context.Context, azureClient *azure.Client, naming *azure.GroupNaming, aUnitId string, state *capsvc2AadState) error {
+	delta, err := azureClient.GetGroupsDelta(ctx, state.DeltaLink)
+	if err != nil {
+		return err
+	}
+
+	changes := 0
+	for _, deltaGroup := range delta.Groups {
+		group, exists := state.Groups[deltaGroup.ID]
+
+		if deltaGroup.Removed != nil {
+			if exists {
+				delete(state.Groups, deltaGroup.ID)
+				changes = changes + 1
+			}
+			continue
+		}
+
+		if !exists {
+			if !naming.IsCapabilityGroup(deltaGroup.DisplayName) {
+				continue
+			}
+			inUnit, err := azureClient.IsAdministrativeUnitMember(ctx, aUnitId, deltaGroup.ID)
+			if err != nil {
+				return err
+			}
+			if !inUnit {
+				util.Logger.Debug(fmt.Sprintf("Group %s isn't in the administrative unit, skipping", deltaGroup.DisplayName), zap.String("jobName", CapabilityServiceToAzureAdName))
+				continue
+			}
+			capability, err := azureClient.GetGroupCapability(ctx, deltaGroup.ID)
+			if err != nil {
+				return err
+			}
+			group = &azure.Group{ID: deltaGroup.ID, Capability: capability, Members: []*azure.Member{}}
+			state.Groups[deltaGroup.ID] = group
+		}
+
+		if deltaGroup.DisplayName != "" {
+			group.DisplayName = deltaGroup.DisplayName
+		}
+		if deltaGroup.Description != nil {
+			group.Description = *deltaGroup.Description
+		}
+
+		for _, deltaMember := range deltaGroup.MembersDelta {
+			if !deltaMember.IsUser() {
+				continue
+			}
+
+			if deltaMember.Removed != nil {
+				removeGroupMember(group, deltaMember.ID)
+				continue
+			}
+
+			if group.HasMemberId(deltaMember.ID) {
+				continue
+			}
+
+			// Member changes only include the object id, the user principal name is needed for comparing with capability members.
+			user, err := azureClient.GetUser(ctx, deltaMember.ID)
+			if err != nil {
+				if errorx.IsOfType(err, azure.AdUserNotFound) {
+					util.Logger.Debug(fmt.Sprintf("User %s not found, skipping", deltaMember.ID), zap.String("jobName", CapabilityServiceToAzureAdName))
+					continue
+				}
+				return err
+			}
+
+			group.Members = append(group.Members, &azure.Member{
+				ID:                user.ID,
+				DisplayName:       user.DisplayName,
+				UserPrincipalName: user.UserPrincipalName,
+				AccountEnabled:    user.AccountEnabled,
+			})
+		}
+		changes = changes + 1
+	}
+
+	util.Logger.Info(fmt.Sprintf("Applied delta changes to %d groups", changes), zap.String("jobName", CapabilityServiceToAzureAdName))
+	state.DeltaLink = delta.DeltaLink
+	return nil
+}
+
+func removeGroupMember(group *azure.Group, id string) {
+	members := []*azure.Member{}
+	for _, member := range group.Members {
+		if member.ID != id {
+			members = append(members, member)
+		}
+	}
+	group.Members = members
+}
+
+// backfillGroupCapabilities stamps the capability extension on capability groups that were created before groups carried one.
+func backfillGroupCapabilities(ctx context.Context, azureClient *azure.Client, naming *azure.GroupNaming, groups []*azure.Group, capabilityIds map[string]string) error {
+	for _, group := range groups {
+		if group.Capability != nil {
+			continue
+		}
+		rootId, ok := naming.RootId(group.DisplayName)
+		if !ok {
+			continue
+		}
+		capabilityId, exists := capabilityIds[rootId]
+		if !exists {
+			continue
+		}
+
+		util.Logger.Info(fmt.Sprintf("Stamping capability %s on group %s", rootId, group.DisplayName), zap.String("jobName", CapabilityServiceToAzureAdName))
+		capability := azure.CapabilityExtension{CapabilityId: capabilityId, RootId: rootId}
+		err := azureClient.SetGroupCapability(ctx, group.ID, capability)
+		if err != nil {
+			return err
+		}
+		group.Capability = &capability
+	}
+
+	return nil
+}
+
+// groupRootId returns the root id of the capability a group belongs to, from its capability extension or else its display name.
+func groupRootId(naming *azure.GroupNaming, group *azure.Group) (string, bool) {
+	if group.Capability != nil && group.Capability.RootId != "" {
+		return group.Capability.RootId, true
+	}
+
+	return naming.RootId(group.DisplayName)
+}
+
+// groupsByRootId keys capability groups by the root id of their capability. Groups that aren't capability groups are left out.
+// If several groups claim the same capability, a group with the capability extension is preferred over one matched by display name.
+func groupsByRootId(naming *azure.GroupNaming, groups []*azure.Group) map[string]*azure.Group {
+	payload := make(map[string]*azure.Group)
+	for _, group := range groups {
+		rootId, ok := groupRootId(naming, group)
+		if !ok {
+			continue
+		}
+		if existing, exists := payload[rootId]; exists && existing.Capability != nil {
+			continue
+		}
+		payload[rootId] = group
+	}
+
+	return payload
+}
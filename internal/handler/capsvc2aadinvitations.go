@@ -0,0 +1,123 @@
+package handler
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"go.dfds.cloud/aad-finout-sync/internal/azure"
+	"go.dfds.cloud/aad-finout-sync/internal/config"
+	"go.dfds.cloud/aad-finout-sync/internal/util"
+	"go.uber.org/zap"
+)
+
+type guestInvitation struct {
+	Email     string    `json:"email"`
+	UserId    string    `json:"userId"`
+	Status    string    `json:"status"`
+	InvitedAt time.Time `json:"invitedAt"`
+}
+
+type guestInvitationState struct {
+	Invitations map[string]*guestInvitation `json:"invitations"` // keyed by lower case email
+}
+
+// guestInviter invites capability members from allow-listed domains that aren't users in the tenant as B2B guests.
+// Invitations are kept in a state file, so members aren't invited again while their invitation is pending.
+// guestId and canInvite can be called on a nil guestInviter, which is what newGuestInviter returns if invitations aren't enabled.
+type guestInviter struct {
+	client         *azure.Client
+	file           *util.JsonStateFile
+	state          guestInvitationState
+	allowedDomains map[string]bool
+	redirectUrl    string
+	sendMessage    bool
+}
+
+func newGuestInviter(conf config.Config, client *azure.Client) (*guestInviter, error) {
+	if !conf.Azure.Invitations.Enabled {
+		return nil, nil
+	}
+
+	inviter := &guestInviter{
+		client:         client,
+		file:           jobStateFile("invitations", conf.Azure.Invitations.StateFile),
+		allowedDomains: make(map[string]bool),
+		redirectUrl:    conf.Azure.Invitations.RedirectUrl,
+		sendMessage:    conf.Azure.Invitations.SendMessage,
+	}
+	for _, domain := range conf.Azure.Invitations.AllowedDomains {
+		inviter.allowedDomains[strings.ToLower(strings.TrimPrefix(strings.TrimSpace(domain), "@"))] = true
+	}
+
+	_, err := inviter.file.Load(&inviter.state)
+	if err != nil {
+		return nil, err
+	}
+	if inviter.state.Invitations == nil {
+		inviter.state.Invitations = make(map[string]*guestInvitation)
+	}
+
+	return inviter, nil
+}
+
+// guestId returns the object id of the guest user that was invited for email.
+func (g *guestInviter) guestId(email string) (string, bool) {
+	if g == nil {
+		return "", false
+	}
+
+	invitation, exists := g.state.Invitations[strings.ToLower(strings.TrimSpace(email))]
+	if !exists {
+		return "", false
+	}
+
+	return invitation.UserId, true
+}
+
+// canInvite returns true if email is from an allow-listed domain.
+func (g *guestInviter) canInvite(email string) bool {
+	if g == nil {
+		return false
+	}
+
+	i := strings.LastIndex(email, "@")
+	if i == -1 {
+		return false
+	}
+
+	return g.allowedDomains[strings.ToLower(email[i+1:])]
+}
+
+// invite returns the object id of the guest user for email, inviting them if that hasn't been done before.
+// The email is invited and recorded in lower case, so the guest's user principal name doesn't depend on which capability invited them first.
+func (g *guestInviter) invite(ctx context.Context, email string) (string, error) {
+	email = strings.ToLower(strings.TrimSpace(email))
+	if guestId, exists := g.guestId(email); exists {
+		return guestId, nil
+	}
+
+	util.Logger.Info(fmt.Sprintf("Inviting %s as guest", email), zap.String("jobName", CapabilityServiceToAzureAdName))
+	resp, err := g.client.CreateInvitation(ctx, azure.CreateInvitationRequest{
+		InvitedUserEmailAddress: email,
+		InviteRedirectUrl:       g.redirectUrl,
+		SendInvitationMessage:   g.sendMessage,
+	})
+	if err != nil {
+		return "", err
+	}
+
+	g.state.Invitations[email] = &guestInvitation{
+		Email:     email,
+		UserId:    resp.InvitedUser.ID,
+		Status:    resp.Status,
+		InvitedAt: time.Now(),
+	}
+	err = g.file.Save(g.state)
+	if err != nil {
+		return "", err
+	}
+
+	return resp.InvitedUser.ID, nil
+}
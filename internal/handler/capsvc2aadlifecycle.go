@@ -0,0 +1,156 @@
+package handler
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"go.dfds.cloud/aad-finout-sync/internal/azure"
+	"go.dfds.cloud/aad-finout-sync/internal/config"
+	"go.dfds.cloud/aad-finout-sync/internal/util"
+	"go.uber.org/zap"
+)
+
+// orphanedGroupMarker is appended to the description of a capability group once its capability no longer exists, followed by the time it was first seen as orphaned.
+const orphanedGroupMarker = " - orphaned since "
+
+const (
+	OrphanGroupStageMarked  = "marked"
+	OrphanGroupStageEmptied = "emptied"
+)
+
+var capabilityGroupsOrphaned *prometheus.GaugeVec = promauto.NewGaugeVec(prometheus.GaugeOpts{
+	Name:      "capability_groups_orphaned",
+	Help:      "Amount of Azure AD capability groups whose capability no longer exists, by lifecycle {stage}.",
+	Namespace: "aad_finout_sync",
+}, []string{"stage"})
+
+var capabilityGroupLifecycleActions *prometheus.CounterVec = promauto.NewCounterVec(prometheus.CounterOpts{
+	Name:      "capability_group_lifecycle_actions_total",
+	Help:      "Lifecycle actions taken on orphaned Azure AD capability groups, by {action}.",
+	Namespace: "aad_finout_sync",
+}, []string{"action"})
+
+// orphanedSince returns the time a group was marked as orphaned, based on its description.
+func orphanedSince(description string) (time.Time, bool) {
+	i := strings.LastIndex(description, orphanedGroupMarker)
+	if i == -1 {
+		return time.Time{}, false
+	}
+
+	since, err := time.Parse(time.RFC3339, strings.TrimSpace(description[i+len(orphanedGroupMarker):]))
+	if err != nil {
+		return time.Time{}, false
+	}
+
+	return since, true
+}
+
+// retireOrphanedGroups handles capability groups whose capability no longer exists. Such a group is first marked as orphaned in its description,
+// emptied once EmptyAfter has passed, and deleted from the administrative unit once GracePeriod has passed. If the capability reappears in the meantime,
+// the mark is removed and the members are restored by the regular reconciliation. Member removals are queued on batch.
+// groups and capabilityIds are keyed by capability root id. Orphaned groups are removed from groups, so they aren't reconciled.
+// As an empty or partial capability list would orphan groups that are still in use, nothing is retired if capabilityIds is empty or more than
+// OrphanGroups.MaxShare of the groups would be newly orphaned, unless OrphanGroups.AllowEmpty is set.
+func retireOrphanedGroups(ctx context.Context, conf config.Config, azureClient *azure.Client, naming *azure.GroupNaming, aUnitId string, groups map[string]*azure.Group, capabilityIds map[string]string, batch *azure.Batch, changes map[string]string) error {
+	if !conf.Azure.OrphanGroups.AllowEmpty && len(groups) > 0 {
+		if len(capabilityIds) == 0 {
+			util.Logger.Warn("No capabilities found, not retiring any groups. Set orphanGroups.allowEmpty to retire them", zap.String("jobName", CapabilityServiceToAzureAdName))
+			return nil
+		}
+
+		newlyOrphaned := 0
+		for rootId, group := range groups {
+			if _, exists := capabilityIds[rootId]; !exists {
+				if _, marked := orphanedSince(group.Description); !marked {
+					newlyOrphaned = newlyOrphaned + 1
+				}
+			}
+		}
+		if share := float64(newlyOrphaned) / float64(len(groups)); share > conf.Azure.OrphanGroups.MaxShare {
+			util.Logger.Warn(fmt.Sprintf("%d of %d groups would be newly orphaned, more than the allowed %.0f%%, not retiring any groups. Set orphanGroups.allowEmpty to retire them", newlyOrphaned, len(groups), conf.Azure.OrphanGroups.MaxShare*100), zap.String("jobName", CapabilityServiceToAzureAdName))
+			return nil
+		}
+	}
+
+	now := time.Now().UTC()
+	stages := map[string]int{OrphanGroupStageMarked: 0, OrphanGroupStageEmptied: 0}
+
+	for rootId, group := range groups {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		default:
+		}
+
+		since, marked := orphanedSince(group.Description)
+
+		if _, exists := capabilityIds[rootId]; exists {
+			if marked {
+				util.Logger.Info(fmt.Sprintf("Capability %s exists again, removing orphaned mark from group %s", rootId, group.DisplayName), zap.String("jobName", CapabilityServiceToAzureAdName))
+				description := strings.TrimSuffix(group.Description[:strings.LastIndex(group.Description, orphanedGroupMarker)], " ")
+				err := azureClient.UpdateGroup(ctx, group.ID, azure.UpdateGroupRequest{Description: &description})
+				if err != nil {
+					return err
+				}
+				group.Description = description
+				capabilityGroupLifecycleActions.WithLabelValues("unmarked").Inc()
+			}
+			continue
+		}
+
+		delete(groups, rootId)
+
+		if !marked {
+			util.Logger.Info(fmt.Sprintf("Capability %s no longer exists, marking group %s as orphaned", rootId, group.DisplayName), zap.String("jobName", CapabilityServiceToAzureAdName))
+			description := group.Description
+			if description == "" {
+				description = naming.Description()
+			}
+			description = fmt.Sprintf("%s%s%s", description, orphanedGroupMarker, now.Format(time.RFC3339))
+			err := azureClient.UpdateGroup(ctx, group.ID, azure.UpdateGroupRequest{Description: &description})
+			if err != nil {
+				return err
+			}
+			group.Description = description
+			since = now
+			capabilityGroupLifecycleActions.WithLabelValues("marked").Inc()
+		}
+
+		orphanedFor := now.Sub(since)
+
+		if orphanedFor >= conf.Azure.OrphanGroups.GracePeriod {
+			util.Logger.Info(fmt.Sprintf("Group %s has been orphaned since %s, deleting", group.DisplayName, since.Format(time.RFC3339)), zap.String("jobName", CapabilityServiceToAzureAdName))
+			err := azureClient.DeleteAdministrativeUnitGroup(ctx, aUnitId, group.ID)
+			if err != nil {
+				return err
+			}
+			capabilityGroupLifecycleActions.WithLabelValues("deleted").Inc()
+			continue
+		}
+
+		if orphanedFor >= conf.Azure.OrphanGroups.EmptyAfter {
+			stages[OrphanGroupStageEmptied] = stages[OrphanGroupStageEmptied] + 1
+			if len(group.Members) > 0 {
+				util.Logger.Info(fmt.Sprintf("Group %s has been orphaned since %s, removing %d members", group.DisplayName, since.Format(time.RFC3339), len(group.Members)), zap.String("jobName", CapabilityServiceToAzureAdName))
+				for _, member := range group.Members {
+					id := batch.DeleteGroupMember(group.ID, member.ID)
+					changes[id] = fmt.Sprintf("remove %s from orphaned group %s", member.UserPrincipalName, group.DisplayName)
+				}
+				capabilityGroupLifecycleActions.WithLabelValues("emptied").Inc()
+			}
+			continue
+		}
+
+		stages[OrphanGroupStageMarked] = stages[OrphanGroupStageMarked] + 1
+	}
+
+	for stage, count := range stages {
+		capabilityGroupsOrphaned.WithLabelValues(stage).Set(float64(count))
+	}
+
+	return nil
+}
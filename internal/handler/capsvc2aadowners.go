@@ -0,0 +1,65 @@
+package handler
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"go.dfds.cloud/aad-finout-sync/internal/azure"
+	"go.dfds.cloud/aad-finout-sync/internal/ssu"
+	"go.dfds.cloud/aad-finout-sync/internal/util"
+	"go.uber.org/zap"
+)
+
+// syncGroupOwners queues the changes needed for the user owners of group to match the owners of capability on batch.
+// memberIds holds the object ids of the capability members, keyed by lower case email. Owners that aren't users, e.g. service principals, are left alone.
+// Nothing is changed if the capability service didn't expose member roles for the capability, as the owners are unknown then.
+// Owners are only added, never removed, if none of the capability owners could be resolved, so a group isn't left without owners.
+func syncGroupOwners(ctx context.Context, azureClient *azure.Client, group *azure.Group, capability *ssu.GetCapabilitiesResponseContextCapability, memberIds map[string]string, batch *azure.Batch, changes map[string]string) error {
+	if !capability.HasMemberRoles() {
+		return nil
+	}
+
+	owners, err := azureClient.ListGroupOwners(group.ID, nil).All(ctx)
+	if err != nil {
+		return err
+	}
+
+	wanted := make(map[string]string)
+	for _, member := range capability.Members {
+		if !member.IsOwner() {
+			continue
+		}
+		if id, exists := memberIds[strings.ToLower(member.Email)]; exists {
+			wanted[id] = member.Email
+		}
+	}
+
+	if len(wanted) == 0 {
+		util.Logger.Warn(fmt.Sprintf("None of the owners of capability %s were found in Azure AD, keeping the current owners of %s", capability.RootID, group.DisplayName), zap.String("jobName", CapabilityServiceToAzureAdName))
+	}
+
+	current := make(map[string]bool)
+	for _, owner := range owners {
+		if !owner.IsUser() {
+			continue
+		}
+		current[owner.ID] = true
+
+		if _, exists := wanted[owner.ID]; !exists && len(wanted) > 0 {
+			util.Logger.Debug(fmt.Sprintf("Azure group %s has stale owner %s, removing.\n", group.DisplayName, owner.UserPrincipalName), zap.String("jobName", CapabilityServiceToAzureAdName))
+			id := batch.DeleteGroupOwner(group.ID, owner.ID)
+			changes[id] = fmt.Sprintf("remove owner %s from %s", owner.UserPrincipalName, group.DisplayName)
+		}
+	}
+
+	for ownerId, email := range wanted {
+		if !current[ownerId] {
+			util.Logger.Debug(fmt.Sprintf("Azure group %s missing owner %s, adding.\n", group.DisplayName, email), zap.String("jobName", CapabilityServiceToAzureAdName))
+			id := batch.AddGroupOwner(group.ID, ownerId)
+			changes[id] = fmt.Sprintf("add owner %s to %s", email, group.DisplayName)
+		}
+	}
+
+	return nil
+}
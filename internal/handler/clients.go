@@ -0,0 +1,89 @@
+package handler
+
+import (
+	"go.dfds.cloud/aad-finout-sync/internal/azure"
+	"go.dfds.cloud/aad-finout-sync/internal/config"
+	"go.dfds.cloud/aad-finout-sync/internal/mail"
+	"go.dfds.cloud/aad-finout-sync/internal/notify"
+	"go.dfds.cloud/aad-finout-sync/internal/ssu"
+)
+
+func newAzureClient(conf config.Config) *azure.Client {
+	return azure.NewAzureClient(azure.Config{
+		TenantId:      conf.Azure.TenantId,
+		ClientId:      conf.Azure.ClientId,
+		ClientSecret:  conf.Azure.ClientSecret,
+		GraphEndpoint: conf.Azure.GraphEndpoint,
+		LoginEndpoint: conf.Azure.LoginEndpoint,
+
+		AuthMethod:         conf.Azure.Auth.Method,
+		CertificatePath:    conf.Azure.Auth.CertificatePath,
+		PrivateKeyPath:     conf.Azure.Auth.PrivateKeyPath,
+		FederatedTokenFile: conf.Azure.Auth.FederatedTokenFile,
+	})
+}
+
+// newGroupNaming returns the naming of capability groups set in config, falling back to the default naming for anything not set.
+func newGroupNaming(conf config.Config) (*azure.GroupNaming, error) {
+	return azure.NewGroupNaming(
+		valueOrDefault(conf.Azure.Groups.DisplayNameTemplate, azure.DefaultGroupDisplayNameTemplate),
+		valueOrDefault(conf.Azure.Groups.MailNicknameTemplate, azure.DefaultGroupMailNicknameTemplate),
+		valueOrDefault(conf.Azure.Groups.Description, azure.DefaultGroupDescription),
+	)
+}
+
+// administrativeUnitName returns the administrative unit capability groups are kept in.
+func administrativeUnitName(conf config.Config) string {
+	return valueOrDefault(conf.Azure.Groups.AdministrativeUnit, azure.DefaultAdministrativeUnit)
+}
+
+func valueOrDefault(value string, fallback string) string {
+	if value == "" {
+		return fallback
+	}
+	return value
+}
+
+// newSsuClient returns a capability service client using the path layout set in config.
+func newSsuClient(conf config.Config) (*ssu.Client, error) {
+	paths, err := ssu.PathsForLayout(conf.CapSvc.Paths.Layout, ssu.Paths{
+		Capabilities: conf.CapSvc.Paths.Capabilities,
+		Members:      conf.CapSvc.Paths.Members,
+		AwsAccount:   conf.CapSvc.Paths.AwsAccount,
+		Metadata:     conf.CapSvc.Paths.Metadata,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return ssu.NewSsuClient(ssu.Config{
+		Host:          conf.CapSvc.Host,
+		TenantId:      conf.Azure.TenantId,
+		ClientId:      conf.CapSvc.ClientId,
+		ClientSecret:  conf.CapSvc.ClientSecret,
+		Scope:         conf.CapSvc.TokenScope,
+		LoginEndpoint: conf.Azure.LoginEndpoint,
+
+		AuthMethod:         conf.CapSvc.Auth.Method,
+		CertificatePath:    conf.CapSvc.Auth.CertificatePath,
+		PrivateKeyPath:     conf.CapSvc.Auth.PrivateKeyPath,
+		FederatedTokenFile: conf.CapSvc.Auth.FederatedTokenFile,
+
+		Paths: paths,
+	}), nil
+}
+
+func newNotifier(conf config.Config) notify.Notifier {
+	return notify.NewNotifier(notify.Config{
+		WebhookUrl: conf.Notify.WebhookUrl,
+		Recipients: conf.Notify.Recipients,
+		Mail: mail.Config{
+			Host:     conf.Smtp.Host,
+			Port:     conf.Smtp.Port,
+			Username: conf.Smtp.Username,
+			Password: conf.Smtp.Password,
+			From:     conf.Smtp.From,
+			StartTls: conf.Smtp.StartTls,
+		},
+	})
+}
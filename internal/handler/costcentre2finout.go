@@ -14,7 +14,7 @@ import (
 
 const CostCentreToFinoutName = "costCenterToFinout"
 
-const tagKey = "dfds.cost.centre"
+const tagKey = ssu.MetadataKeyCostCentre
 const author = "aad-finout-sync"
 
 func CostCentre2FinoutHandler(ctx context.Context) error {
@@ -25,35 +25,16 @@ func CostCentre2FinoutHandler(ctx context.Context) error {
 
 	finoutClientApp := finout.NewFinoutClient()
 	finoutClientApp.SetAuthMethod(finout.AuthClientSecretMethod(finout.Config{ClientId: conf.Finout.ClientId, ClientSecret: conf.Finout.ClientSecret}))
-	ssuClient := ssu.NewSsuClient(ssu.Config{
-		Host:         conf.CapSvc.Host,
-		TenantId:     conf.Azure.TenantId,
-		ClientId:     conf.CapSvc.ClientId,
-		ClientSecret: conf.CapSvc.ClientSecret,
-		Scope:        conf.CapSvc.TokenScope,
-	})
-
-	caps, err := ssuClient.GetCapabilities()
+	ssuClient, err := newSsuClient(conf)
 	if err != nil {
 		return err
 	}
-	util.Logger.Debug("Capabilities retrieved")
-	capsTag := make(map[string]string)
-
-	for _, capability := range caps {
-		metadata, err := ssuClient.GetCapabilityMetadata(capability.ID)
-		if err != nil {
-			return err
-		}
 
-		var tribe string = ""
-		if val, exists := metadata["dfds.cost.centre"]; exists {
-			tribe = val.(string)
-		}
-		capsTag[capability.ID] = tribe
+	caps, err := ssuClient.GetCapabilities(ctx)
+	if err != nil {
+		return err
 	}
-
-	util.Logger.Debug("Capability metadata retrieved")
+	util.Logger.Debug("Capabilities retrieved")
 
 	tags, err := finoutClientApp.ApiApp().ListVirtualTags(ctx)
 	if err != nil {
@@ -65,6 +46,19 @@ func CostCentre2FinoutHandler(ctx context.Context) error {
 		return VirtualTagDoesNotExist.New(VirtualTagDoesNotExistMsg)
 	}
 
+	// Capabilities that aren't included in the cost rules are left out, so their spend falls through to the mapping file and the default.
+	caps = costRuleCapabilities(caps)
+	capabilityIds := make([]string, 0, len(caps))
+	for _, capability := range caps {
+		capabilityIds = append(capabilityIds, capability.ID)
+	}
+	capsTag, _, err := getCapabilityCostCentres(ctx, conf, ssuClient, finoutClientApp.ApiApp(), CostCentreToFinoutName, capabilityIds)
+	if err != nil {
+		return err
+	}
+
+	util.Logger.Debug("Capability metadata retrieved")
+
 	mappings, err := getMappings()
 	if err != nil {
 		util.Logger.Warn("No manual mappings found, using default values", zap.Error(err))
@@ -73,44 +67,17 @@ func CostCentre2FinoutHandler(ctx context.Context) error {
 		}
 	}
 
+	ruleSet := newCostCentreRuleSet(capsTag, mappings)
+
 	if tag, exists := tags[tagKey]; !exists {
 		util.Logger.Info(fmt.Sprintf("Tag '%s' doesn't exist, creating", tagKey))
-		var rules []finout.CreateVirtualTagRequestRule
-
-		for k, v := range capsTag {
-			if v != "" {
-				rules = append(rules, finout.CreateVirtualTagRequestRule{
-					To: v,
-					Filters: finout.CreateVirtualTagRequestRuleFilter{
-						CostCenter: "virtualTag",
-						Key:        capabilityTag.ID,
-						Type:       "virtual_tag",
-						Operator:   "oneOf",
-						Value:      []string{k},
-					},
-				})
-			}
-		}
-
-		for _, mapping := range mappings.AwsAccountAlias2CostCentre {
-			rules = append(rules, finout.CreateVirtualTagRequestRule{
-				To: mapping.CostCentre,
-				Filters: finout.CreateVirtualTagRequestRuleFilter{
-					CostCenter: "amazon-cur",
-					Key:        "aws_account_name",
-					Type:       "tag",
-					Operator:   "oneOf",
-					Value:      []string{mapping.Alias},
-				},
-			})
-		}
 
 		virtualTagRequest := finout.CreateVirtualTagRequest{
 			Default: finout.CreateVirtualTagRequestDefault{
 				Type:  "string",
-				Value: "Untagged",
+				Value: ruleSet.Default,
 			},
-			Rules: rules,
+			Rules: ruleSet.createRequestRules(capabilityTag.ID),
 			Name:  tagKey,
 		}
 		_, err := finoutClientApp.ApiApp().CreateVirtualTag(ctx, virtualTagRequest)
@@ -120,43 +87,13 @@ func CostCentre2FinoutHandler(ctx context.Context) error {
 	} else {
 		util.Logger.Info(fmt.Sprintf("Tag '%s' exists, updating", tagKey))
 
-		var rules []finout.UpdateVirtualTagRequestRule
-
-		for k, v := range capsTag {
-			if v != "" {
-				rules = append(rules, finout.UpdateVirtualTagRequestRule{
-					To: v,
-					Filters: finout.UpdateVirtualTagRequestRuleFilter{
-						CostCenter: "virtualTag",
-						Key:        capabilityTag.ID,
-						Type:       "virtual_tag",
-						Operator:   "oneOf",
-						Value:      []string{k},
-					},
-				})
-			}
-		}
-
-		for _, mapping := range mappings.AwsAccountAlias2CostCentre {
-			rules = append(rules, finout.UpdateVirtualTagRequestRule{
-				To: mapping.CostCentre,
-				Filters: finout.UpdateVirtualTagRequestRuleFilter{
-					CostCenter: "amazon-cur",
-					Key:        "aws_account_name",
-					Type:       "tag",
-					Operator:   "oneOf",
-					Value:      []string{mapping.Alias},
-				},
-			})
-		}
-
 		virtualTagUpdateRequest := finout.UpdateVirtualTagRequest{
-			Rules:     rules,
+			Rules:     ruleSet.updateRequestRules(capabilityTag.ID),
 			Endpoints: []string{},
 			Name:      tagKey,
 			Default: finout.CreateVirtualTagRequestDefault{
 				Type:  "string",
-				Value: "Untagged",
+				Value: ruleSet.Default,
 			},
 		}
 		_, err := finoutClientApp.ApiApp().UpdateVirtualTag(ctx, virtualTagUpdateRequest, tag.ID)
@@ -168,8 +105,89 @@ func CostCentre2FinoutHandler(ctx context.Context) error {
 	return nil
 }
 
+// getCapabilityCostCentres returns the cost centre of each capability in capabilityIds, keyed by capability id, as CostCentre2FinoutHandler sends it to Finout,
+// along with the metadata that could be fetched. The live virtual tag is only read if metadata is missing, see capabilityCostCentres.
+func getCapabilityCostCentres(ctx context.Context, conf config.Config, ssuClient *ssu.Client, finoutApi *finout.ApiApp, jobName string, capabilityIds []string) (map[string]string, map[string]*ssu.Metadata, error) {
+	capsMetadata, err := getCapabilitiesMetadata(ctx, conf, ssuClient, jobName, capabilityIds)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var current *finout.GetVirtualTagResponse
+	capabilityTagId := ""
+	if len(capsMetadata) < len(capabilityIds) {
+		tags, err := finoutApi.ListVirtualTags(ctx)
+		if err != nil {
+			return nil, nil, err
+		}
+		capabilityTag, exists := tags["capability"]
+		if !exists {
+			return nil, nil, VirtualTagDoesNotExist.New(VirtualTagDoesNotExistMsg)
+		}
+		capabilityTagId = capabilityTag.ID
+		if tag, exists := tags[tagKey]; exists {
+			current, err = finoutApi.GetVirtualTag(ctx, tag.ID)
+			if err != nil {
+				return nil, nil, err
+			}
+		}
+	}
+
+	costCentres, err := capabilityCostCentres(capabilityIds, capsMetadata, current, capabilityTagId, jobName)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return costCentres, capsMetadata, nil
+}
+
+// capabilityCostCentres returns the cost centre of each capability in capabilityIds, keyed by capability id.
+// Capabilities without metadata keep the cost centre of their rule in current, the live virtual tag, so an unavailable capability service doesn't move their spend.
+// If there is no live virtual tag to fall back on, an error is returned rather than leaving the capabilities out.
+func capabilityCostCentres(capabilityIds []string, capsMetadata map[string]*ssu.Metadata, current *finout.GetVirtualTagResponse, capabilityTagId string, jobName string) (map[string]string, error) {
+	existing := make(map[string]string)
+	if current != nil {
+		for _, rule := range current.Rules {
+			filter := rule.Filters
+			if filter.CostCenter != "virtualTag" || filter.Key != capabilityTagId {
+				continue
+			}
+			for _, id := range filter.Values() {
+				if _, exists := existing[id]; !exists {
+					existing[id] = rule.To
+				}
+			}
+		}
+	}
+
+	payload := make(map[string]string)
+	for _, id := range capabilityIds {
+		if metadata, exists := capsMetadata[id]; exists {
+			payload[id] = metadata.CostCentre
+			continue
+		}
+
+		if current == nil {
+			return nil, fmt.Errorf("unable to get metadata of capability %s and there is no current virtual tag to keep its cost centre from, not updating '%s'", id, tagKey)
+		}
+		if costCentre, exists := existing[id]; exists {
+			util.Logger.Warn(fmt.Sprintf("Keeping the current cost centre '%s' of capability %s, as its metadata is unavailable", costCentre, id), zap.String("jobName", jobName))
+			payload[id] = costCentre
+		}
+	}
+
+	return payload, nil
+}
+
 type dataMappings struct {
 	AwsAccountAlias2CostCentre []dataMappingsAwsAccountAlias2CostCentre `json:"awsAccountAlias2CostCentre"`
+	Department2CostCentre      []dataMappingsDepartment2CostCentre      `json:"department2CostCentre,omitempty"`
+}
+
+// dataMappingsDepartment2CostCentre maps an Azure AD department to its cost centre, for departments whose name differs from the cost centre.
+type dataMappingsDepartment2CostCentre struct {
+	Department string `json:"department"`
+	CostCentre string `json:"costCentre"`
 }
 
 type dataMappingsAwsAccountAlias2CostCentre struct {
@@ -0,0 +1,34 @@
+package handler
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"go.dfds.cloud/aad-finout-sync/internal/finout"
+	"go.dfds.cloud/aad-finout-sync/internal/ssu"
+)
+
+func TestCapabilityCostCentres(t *testing.T) {
+	capsMetadata := map[string]*ssu.Metadata{
+		"cap-a": ssu.ParseMetadata(map[string]interface{}{ssu.MetadataKeyCostCentre: "ti-arch"}),
+	}
+	current := &finout.GetVirtualTagResponse{
+		Rules: []finout.GetVirtualTagResponseRule{
+			{To: "finance", Filters: finout.GetVirtualTagResponseRuleFilter{CostCenter: "virtualTag", Key: "capability-tag", Operator: "oneOf", Value: []interface{}{"cap-a", "cap-b"}}},
+			{To: "ti-platform", Filters: finout.GetVirtualTagResponseRuleFilter{CostCenter: "amazon-cur", Key: "aws_account_name", Operator: "oneOf", Value: []interface{}{"cap-c"}}},
+		},
+	}
+
+	// Fresh metadata wins, capabilities without metadata keep their current rule, or stay without one.
+	costCentres, err := capabilityCostCentres([]string{"cap-a", "cap-b", "cap-c"}, capsMetadata, current, "capability-tag", CostCentreToFinoutName)
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]string{"cap-a": "ti-arch", "cap-b": "finance"}, costCentres)
+
+	costCentres, err = capabilityCostCentres([]string{"cap-a"}, capsMetadata, nil, "capability-tag", CostCentreToFinoutName)
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]string{"cap-a": "ti-arch"}, costCentres)
+
+	// Without a current tag there is nothing to fall back on.
+	_, err = capabilityCostCentres([]string{"cap-a", "cap-b"}, capsMetadata, nil, "capability-tag", CostCentreToFinoutName)
+	assert.Error(t, err)
+}
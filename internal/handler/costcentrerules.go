@@ -0,0 +1,201 @@
+package handler
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"go.dfds.cloud/aad-finout-sync/internal/finout"
+	"go.dfds.cloud/aad-finout-sync/internal/ssu"
+)
+
+const costCentreDefaultValue = "Untagged"
+
+const (
+	CostCentreRuleSourceCapability = "capabilityMetadata"
+	CostCentreRuleSourceMapping    = "mappingFile"
+	CostCentreRuleSourceDefault    = "default"
+)
+
+type costCentreRule struct {
+	To           string
+	Source       string
+	CapabilityId string
+	AccountAlias string
+}
+
+// costCentreRuleSet is the ordered list of rules that make up the cost centre virtual tag in Finout. Finout applies the first matching rule.
+type costCentreRuleSet struct {
+	Rules   []costCentreRule
+	Default string
+}
+
+// costRuleCapabilities returns the capabilities whose lifecycle policy includes them in the cost centre rules and the cost reports.
+func costRuleCapabilities(capabilities []*ssu.GetCapabilitiesResponseContextCapability) []*ssu.GetCapabilitiesResponseContextCapability {
+	payload := make([]*ssu.GetCapabilitiesResponseContextCapability, 0, len(capabilities))
+	for _, capability := range capabilities {
+		if capability.Lifecycle().IncludeInCostRules {
+			payload = append(payload, capability)
+		}
+	}
+
+	return payload
+}
+
+// newCostCentreRuleSet builds the rule set from the cost centre of each capability (keyed by capability id) and the manual mappings.
+// Capability rules come first, ordered by capability id, followed by the mapping file rules in file order.
+func newCostCentreRuleSet(capsTag map[string]string, mappings *dataMappings) *costCentreRuleSet {
+	ruleSet := &costCentreRuleSet{
+		Rules:   []costCentreRule{},
+		Default: costCentreDefaultValue,
+	}
+
+	capabilityIds := make([]string, 0, len(capsTag))
+	for k := range capsTag {
+		capabilityIds = append(capabilityIds, k)
+	}
+	sort.Strings(capabilityIds)
+
+	for _, k := range capabilityIds {
+		if v := capsTag[k]; v != "" {
+			ruleSet.Rules = append(ruleSet.Rules, costCentreRule{
+				To:           v,
+				Source:       CostCentreRuleSourceCapability,
+				CapabilityId: k,
+			})
+		}
+	}
+
+	if mappings != nil {
+		for _, mapping := range mappings.AwsAccountAlias2CostCentre {
+			ruleSet.Rules = append(ruleSet.Rules, costCentreRule{
+				To:           mapping.CostCentre,
+				Source:       CostCentreRuleSourceMapping,
+				AccountAlias: mapping.Alias,
+			})
+		}
+	}
+
+	return ruleSet
+}
+
+func (r *costCentreRuleSet) createRequestRules(capabilityTagId string) []finout.CreateVirtualTagRequestRule {
+	var rules []finout.CreateVirtualTagRequestRule
+	for _, rule := range r.Rules {
+		filter := rule.updateRequestRuleFilter(capabilityTagId)
+		rules = append(rules, finout.CreateVirtualTagRequestRule{
+			To: rule.To,
+			Filters: finout.CreateVirtualTagRequestRuleFilter{
+				CostCenter: filter.CostCenter,
+				Key:        filter.Key,
+				Type:       filter.Type,
+				Operator:   filter.Operator,
+				Value:      filter.Value,
+			},
+		})
+	}
+
+	return rules
+}
+
+func (r *costCentreRuleSet) updateRequestRules(capabilityTagId string) []finout.UpdateVirtualTagRequestRule {
+	var rules []finout.UpdateVirtualTagRequestRule
+	for _, rule := range r.Rules {
+		rules = append(rules, finout.UpdateVirtualTagRequestRule{
+			To:      rule.To,
+			Filters: rule.updateRequestRuleFilter(capabilityTagId),
+		})
+	}
+
+	return rules
+}
+
+func (r costCentreRule) updateRequestRuleFilter(capabilityTagId string) finout.UpdateVirtualTagRequestRuleFilter {
+	if r.Source == CostCentreRuleSourceCapability {
+		return finout.UpdateVirtualTagRequestRuleFilter{
+			CostCenter: "virtualTag",
+			Key:        capabilityTagId,
+			Type:       "virtual_tag",
+			Operator:   "oneOf",
+			Value:      []string{r.CapabilityId},
+		}
+	}
+
+	return finout.UpdateVirtualTagRequestRuleFilter{
+		CostCenter: "amazon-cur",
+		Key:        "aws_account_name",
+		Type:       "tag",
+		Operator:   "oneOf",
+		Value:      []string{r.AccountAlias},
+	}
+}
+
+type CostCentreExplanationStep struct {
+	Source       string `json:"source"`
+	Matched      bool   `json:"matched"`
+	Applied      bool   `json:"applied"`
+	CostCentre   string `json:"costCentre,omitempty"`
+	CapabilityId string `json:"capabilityId,omitempty"`
+	AccountAlias string `json:"accountAlias,omitempty"`
+	Detail       string `json:"detail"`
+}
+
+// evaluate walks the rule set the way Finout does for cost attributed to any of capabilityIds and/or the AWS account accountAlias.
+// Every matching rule is returned in order; only the first one is applied, the remaining ones are shadowed.
+func (r *costCentreRuleSet) evaluate(capabilityIds []string, accountAlias string) (string, []CostCentreExplanationStep) {
+	capabilities := make(map[string]bool)
+	for _, id := range capabilityIds {
+		capabilities[id] = true
+	}
+
+	var steps []CostCentreExplanationStep
+	result := ""
+
+	for i, rule := range r.Rules {
+		matched := false
+		switch rule.Source {
+		case CostCentreRuleSourceCapability:
+			matched = capabilities[rule.CapabilityId]
+		case CostCentreRuleSourceMapping:
+			matched = accountAlias != "" && strings.EqualFold(rule.AccountAlias, accountAlias)
+		}
+
+		if !matched {
+			continue
+		}
+
+		step := CostCentreExplanationStep{
+			Source:       rule.Source,
+			Matched:      true,
+			CostCentre:   rule.To,
+			CapabilityId: rule.CapabilityId,
+			AccountAlias: rule.AccountAlias,
+		}
+
+		if result == "" {
+			result = rule.To
+			step.Applied = true
+			step.Detail = fmt.Sprintf("Rule %d is the first matching rule and sets the cost centre to '%s'", i+1, rule.To)
+		} else {
+			step.Detail = fmt.Sprintf("Rule %d matches as well, but is shadowed by an earlier rule", i+1)
+		}
+
+		steps = append(steps, step)
+	}
+
+	defaultStep := CostCentreExplanationStep{
+		Source:     CostCentreRuleSourceDefault,
+		CostCentre: r.Default,
+	}
+	if result == "" {
+		result = r.Default
+		defaultStep.Matched = true
+		defaultStep.Applied = true
+		defaultStep.Detail = fmt.Sprintf("No rule matched, the virtual tag default '%s' applies", r.Default)
+	} else {
+		defaultStep.Detail = "Not used, an earlier rule matched"
+	}
+	steps = append(steps, defaultStep)
+
+	return result, steps
+}
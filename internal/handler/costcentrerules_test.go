@@ -0,0 +1,135 @@
+package handler
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNewCostCentreRuleSet(t *testing.T) {
+	ruleSet := newCostCentreRuleSet(map[string]string{"cap-b": "finance", "cap-a": "ti-arch", "cap-c": ""}, &dataMappings{
+		AwsAccountAlias2CostCentre: []dataMappingsAwsAccountAlias2CostCentre{
+			{Alias: "shared-prod", CostCentre: "ti-platform"},
+			{Alias: "legacy", CostCentre: "finance"},
+		},
+	})
+
+	// Capability rules come first ordered by capability id, capabilities without a cost centre get no rule, mapping rules keep file order.
+	assert.Equal(t, []costCentreRule{
+		{To: "ti-arch", Source: CostCentreRuleSourceCapability, CapabilityId: "cap-a"},
+		{To: "finance", Source: CostCentreRuleSourceCapability, CapabilityId: "cap-b"},
+		{To: "ti-platform", Source: CostCentreRuleSourceMapping, AccountAlias: "shared-prod"},
+		{To: "finance", Source: CostCentreRuleSourceMapping, AccountAlias: "legacy"},
+	}, ruleSet.Rules)
+	assert.Equal(t, costCentreDefaultValue, ruleSet.Default)
+}
+
+func TestCostCentreRuleSet_Evaluate(t *testing.T) {
+	ruleSet := newCostCentreRuleSet(map[string]string{"cap-a": "ti-arch", "cap-b": "finance"}, &dataMappings{
+		AwsAccountAlias2CostCentre: []dataMappingsAwsAccountAlias2CostCentre{
+			{Alias: "shared-prod", CostCentre: "ti-platform"},
+			{Alias: "shared-prod", CostCentre: "finance"},
+		},
+	})
+
+	tests := []struct {
+		name          string
+		capabilityIds []string
+		accountAlias  string
+		expected      string
+		sources       []string
+		applied       []bool
+	}{
+		{
+			name:          "capability rule",
+			capabilityIds: []string{"cap-b"},
+			expected:      "finance",
+			sources:       []string{CostCentreRuleSourceCapability, CostCentreRuleSourceDefault},
+			applied:       []bool{true, false},
+		},
+		{
+			name:         "mapping rule",
+			accountAlias: "shared-prod",
+			expected:     "ti-platform",
+			sources:      []string{CostCentreRuleSourceMapping, CostCentreRuleSourceMapping, CostCentreRuleSourceDefault},
+			applied:      []bool{true, false, false},
+		},
+		{
+			name:         "mapping rule ignores case",
+			accountAlias: "Shared-Prod",
+			expected:     "ti-platform",
+			sources:      []string{CostCentreRuleSourceMapping, CostCentreRuleSourceMapping, CostCentreRuleSourceDefault},
+			applied:      []bool{true, false, false},
+		},
+		{
+			name:          "capability rule shadows mapping rules",
+			capabilityIds: []string{"cap-a"},
+			accountAlias:  "shared-prod",
+			expected:      "ti-arch",
+			sources:       []string{CostCentreRuleSourceCapability, CostCentreRuleSourceMapping, CostCentreRuleSourceMapping, CostCentreRuleSourceDefault},
+			applied:       []bool{true, false, false, false},
+		},
+		{
+			name:          "first capability by id wins",
+			capabilityIds: []string{"cap-b", "cap-a"},
+			expected:      "ti-arch",
+			sources:       []string{CostCentreRuleSourceCapability, CostCentreRuleSourceCapability, CostCentreRuleSourceDefault},
+			applied:       []bool{true, false, false},
+		},
+		{
+			name:          "default",
+			capabilityIds: []string{"cap-unknown"},
+			accountAlias:  "unmapped",
+			expected:      costCentreDefaultValue,
+			sources:       []string{CostCentreRuleSourceDefault},
+			applied:       []bool{true},
+		},
+		{
+			name:     "nothing to match",
+			expected: costCentreDefaultValue,
+			sources:  []string{CostCentreRuleSourceDefault},
+			applied:  []bool{true},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			result, steps := ruleSet.evaluate(test.capabilityIds, test.accountAlias)
+			assert.Equal(t, test.expected, result)
+
+			var sources []string
+			var applied []bool
+			for _, step := range steps {
+				sources = append(sources, step.Source)
+				applied = append(applied, step.Applied)
+			}
+			assert.Equal(t, test.sources, sources)
+			assert.Equal(t, test.applied, applied)
+
+			// Only the default step can be unmatched, and only if an earlier rule applied.
+			last := steps[len(steps)-1]
+			assert.Equal(t, last.Applied, last.Matched)
+			for _, step := range steps[:len(steps)-1] {
+				assert.True(t, step.Matched)
+			}
+		})
+	}
+}
+
+func TestCostCentreRuleSet_EvaluateDetails(t *testing.T) {
+	ruleSet := newCostCentreRuleSet(map[string]string{"cap-a": "ti-arch"}, &dataMappings{
+		AwsAccountAlias2CostCentre: []dataMappingsAwsAccountAlias2CostCentre{{Alias: "shared-prod", CostCentre: "ti-platform"}},
+	})
+
+	_, steps := ruleSet.evaluate([]string{"cap-a"}, "shared-prod")
+	if assert.Len(t, steps, 3) {
+		assert.Equal(t, "Rule 1 is the first matching rule and sets the cost centre to 'ti-arch'", steps[0].Detail)
+		assert.Equal(t, "Rule 2 matches as well, but is shadowed by an earlier rule", steps[1].Detail)
+		assert.Equal(t, "Not used, an earlier rule matched", steps[2].Detail)
+	}
+
+	_, steps = ruleSet.evaluate(nil, "")
+	if assert.Len(t, steps, 1) {
+		assert.Equal(t, "No rule matched, the virtual tag default 'Untagged' applies", steps[0].Detail)
+	}
+}
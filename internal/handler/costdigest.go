@@ -0,0 +1,235 @@
+package handler
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"text/template"
+	"time"
+
+	"go.dfds.cloud/aad-finout-sync/internal/config"
+	"go.dfds.cloud/aad-finout-sync/internal/digest"
+	"go.dfds.cloud/aad-finout-sync/internal/finout"
+	"go.dfds.cloud/aad-finout-sync/internal/mail"
+	"go.dfds.cloud/aad-finout-sync/internal/util"
+	"go.uber.org/zap"
+)
+
+const CostDigestName = "costDigest"
+
+// costDigestMu keeps runs of the job from sending digests at the same time.
+var costDigestMu sync.Mutex
+
+// costDigestState is the progress of sending the digests for Period, so a job running more than once on the configured day, or after a restart,
+// doesn't send duplicates and only retries the capabilities whose digest failed.
+type costDigestState struct {
+	Period   time.Time            `json:"period"`
+	Sent     map[string]time.Time `json:"sent"` // keyed by capability id
+	Complete bool                 `json:"complete"`
+}
+
+// loadCostDigestState returns the progress for period. Progress stored for another period is discarded.
+func loadCostDigestState(file *util.JsonStateFile, period time.Time) (*costDigestState, error) {
+	state := &costDigestState{}
+	_, err := file.Load(state)
+	if err != nil {
+		return nil, err
+	}
+
+	if !state.Period.Equal(period) || state.Sent == nil {
+		state = &costDigestState{Period: period, Sent: make(map[string]time.Time)}
+	}
+
+	return state, nil
+}
+
+func CostDigestHandler(ctx context.Context) error {
+	conf, err := config.LoadConfig()
+	if err != nil {
+		return err
+	}
+
+	if !conf.Digest.Enabled {
+		util.Logger.Debug("Cost digest is not enabled, skipping", zap.String("jobName", CostDigestName))
+		return nil
+	}
+
+	now := time.Now().UTC()
+	if now.Day() != conf.Digest.DayOfMonth {
+		return nil
+	}
+
+	period := time.Date(now.Year(), now.Month()-1, 1, 0, 0, 0, 0, time.UTC)
+
+	costDigestMu.Lock()
+	defer costDigestMu.Unlock()
+
+	return SendCostDigests(ctx, conf, period)
+}
+
+// SendCostDigests mails a cost digest for the month starting at period to the members of every capability with spend in that month.
+// Capabilities are recorded in the state file as their digest is sent, so they are skipped if the digests for period are sent again.
+func SendCostDigests(ctx context.Context, conf config.Config, period time.Time) error {
+	if conf.Digest.ViewId == "" {
+		return errors.New("no Finout view configured for the cost digest")
+	}
+
+	stateFile := jobStateFile("costDigest", conf.Digest.StateFile)
+	state, err := loadCostDigestState(stateFile, period)
+	if err != nil {
+		return err
+	}
+	if state.Complete {
+		util.Logger.Debug(fmt.Sprintf("Cost digests for %s have been sent, skipping", period.Format("2006-01")), zap.String("jobName", CostDigestName))
+		return nil
+	}
+
+	renderer, err := digest.NewRenderer(conf.Digest.TemplateDir, conf.Digest.Currency)
+	if err != nil {
+		return err
+	}
+
+	var urlTemplate *template.Template
+	if conf.Digest.FinoutUrlTemplate != "" {
+		urlTemplate, err = template.New("finoutUrl").Parse(conf.Digest.FinoutUrlTemplate)
+		if err != nil {
+			return err
+		}
+	}
+
+	finoutClientApp := finout.NewFinoutClient()
+	finoutClientApp.SetAuthMethod(finout.AuthClientSecretMethod(finout.Config{ClientId: conf.Finout.ClientId, ClientSecret: conf.Finout.ClientSecret}))
+	ssuClient, err := newSsuClient(conf)
+	if err != nil {
+		return err
+	}
+	mailClient := mail.NewMailClient(mail.Config{
+		Host:     conf.Smtp.Host,
+		Port:     conf.Smtp.Port,
+		Username: conf.Smtp.Username,
+		Password: conf.Smtp.Password,
+		From:     conf.Smtp.From,
+		StartTls: conf.Smtp.StartTls,
+	})
+
+	previousPeriod := period.AddDate(0, -1, 0)
+	nextPeriod := period.AddDate(0, 1, 0)
+
+	current, err := finoutClientApp.ApiApp().QueryByView(ctx, finout.QueryByViewRequest{
+		ViewId: conf.Digest.ViewId,
+		Date:   finout.NewQueryByViewRequestDate(period, nextPeriod.Add(-time.Millisecond)),
+	})
+	if err != nil {
+		return err
+	}
+
+	previous, err := finoutClientApp.ApiApp().QueryByView(ctx, finout.QueryByViewRequest{
+		ViewId: conf.Digest.ViewId,
+		Date:   finout.NewQueryByViewRequestDate(previousPeriod, period.Add(-time.Millisecond)),
+	})
+	if err != nil {
+		return err
+	}
+
+	currentSummaries := digest.SummariseByCapability(current.Data, conf.Digest.GroupSeparator, conf.Digest.TopDrivers)
+	previousSummaries := digest.SummariseByCapability(previous.Data, conf.Digest.GroupSeparator, conf.Digest.TopDrivers)
+
+	caps, err := ssuClient.GetCapabilities(ctx)
+	if err != nil {
+		return err
+	}
+
+	failed := 0
+	for _, capability := range costRuleCapabilities(caps) {
+		select {
+		case <-ctx.Done():
+			util.Logger.Info("Job cancelled", zap.String("jobName", CostDigestName))
+			return nil
+		default:
+		}
+
+		if _, sent := state.Sent[capability.ID]; sent {
+			continue
+		}
+
+		summary, exists := currentSummaries[capability.ID]
+		if !exists || summary.Spend == 0 {
+			continue
+		}
+
+		var recipients []string
+		for _, member := range capability.Members {
+			if member.Email != "" {
+				recipients = append(recipients, member.Email)
+			}
+		}
+		if len(recipients) == 0 {
+			continue
+		}
+
+		d := digest.Digest{
+			Capability: digest.Capability{
+				Id:     capability.ID,
+				RootId: capability.RootID,
+				Name:   capability.Name,
+			},
+			Period:         period,
+			PreviousPeriod: previousPeriod,
+			Spend:          summary.Spend,
+			Drivers:        summary.Drivers,
+		}
+
+		if previousSummary, exists := previousSummaries[capability.ID]; exists {
+			d.PreviousSpend = previousSummary.Spend
+			d.HasPrevious = true
+		}
+
+		if urlTemplate != nil {
+			var buf bytes.Buffer
+			err = urlTemplate.Execute(&buf, map[string]string{
+				"CapabilityId": capability.ID,
+				"RootId":       capability.RootID,
+				"ViewId":       conf.Digest.ViewId,
+			})
+			if err != nil {
+				return err
+			}
+			d.FinoutUrl = strings.TrimSpace(buf.String())
+		}
+
+		rendered, err := renderer.Render(d)
+		if err != nil {
+			return err
+		}
+
+		err = mailClient.Send(ctx, mail.Message{
+			To:      recipients,
+			Subject: rendered.Subject,
+			Text:    rendered.Text,
+			Html:    rendered.Html,
+		})
+		if err != nil {
+			failed = failed + 1
+			util.Logger.Error("Unable to send cost digest", zap.String("jobName", CostDigestName), zap.String("capabilityId", capability.ID), zap.Error(err))
+			continue
+		}
+
+		util.Logger.Info(fmt.Sprintf("Sent cost digest for %s to %d members", capability.RootID, len(recipients)), zap.String("jobName", CostDigestName))
+
+		state.Sent[capability.ID] = time.Now().UTC()
+		err = stateFile.Save(state)
+		if err != nil {
+			return err
+		}
+	}
+
+	if failed > 0 {
+		return fmt.Errorf("unable to send %d cost digests", failed)
+	}
+
+	state.Complete = true
+	return stateFile.Save(state)
+}
@@ -0,0 +1,37 @@
+package handler
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"go.dfds.cloud/aad-finout-sync/internal/util"
+)
+
+func TestLoadCostDigestState(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "digest.json")
+	file := util.NewJsonStateFile(path)
+	march := time.Date(2024, 3, 1, 0, 0, 0, 0, time.UTC)
+	april := time.Date(2024, 4, 1, 0, 0, 0, 0, time.UTC)
+
+	state, err := loadCostDigestState(file, march)
+	assert.NoError(t, err)
+	assert.Equal(t, march, state.Period)
+	assert.Empty(t, state.Sent)
+
+	state.Sent["cap-a"] = time.Now().UTC()
+	assert.NoError(t, file.Save(state))
+
+	// Progress survives a restart, a new file instance reads what was saved.
+	state, err = loadCostDigestState(util.NewJsonStateFile(path), march)
+	assert.NoError(t, err)
+	assert.Contains(t, state.Sent, "cap-a")
+	assert.False(t, state.Complete)
+
+	// Progress of an earlier period is discarded.
+	state, err = loadCostDigestState(file, april)
+	assert.NoError(t, err)
+	assert.Equal(t, april, state.Period)
+	assert.Empty(t, state.Sent)
+}
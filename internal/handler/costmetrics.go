@@ -0,0 +1,158 @@
+package handler
+
+import (
+	"context"
+	"errors"
+	"sort"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"go.dfds.cloud/aad-finout-sync/internal/config"
+	"go.dfds.cloud/aad-finout-sync/internal/finout"
+	"go.dfds.cloud/aad-finout-sync/internal/util"
+	"go.uber.org/zap"
+)
+
+const CostMetricsName = "costMetrics"
+
+// costMetricsOtherLabel is used for the series that don't fit within the configured maximum amount of series.
+const costMetricsOtherLabel = "other"
+
+var costCentreDailyCost *prometheus.GaugeVec = promauto.NewGaugeVec(prometheus.GaugeOpts{
+	Name:      "cost_centre_daily_cost",
+	Help:      "Cost of {cost_centre} for the last complete day, as reported by Finout.",
+	Namespace: "aad_finout_sync",
+}, []string{"cost_centre"})
+
+var costCentreMonthToDateCost *prometheus.GaugeVec = promauto.NewGaugeVec(prometheus.GaugeOpts{
+	Name:      "cost_centre_month_to_date_cost",
+	Help:      "Month-to-date cost of {cost_centre}, as reported by Finout.",
+	Namespace: "aad_finout_sync",
+}, []string{"cost_centre"})
+
+var capabilityDailyCost *prometheus.GaugeVec = promauto.NewGaugeVec(prometheus.GaugeOpts{
+	Name:      "capability_daily_cost",
+	Help:      "Cost of {capability} for the last complete day, as reported by Finout.",
+	Namespace: "aad_finout_sync",
+}, []string{"capability"})
+
+var capabilityMonthToDateCost *prometheus.GaugeVec = promauto.NewGaugeVec(prometheus.GaugeOpts{
+	Name:      "capability_month_to_date_cost",
+	Help:      "Month-to-date cost of {capability}, as reported by Finout.",
+	Namespace: "aad_finout_sync",
+}, []string{"capability"})
+
+var costMetricsLastUpdated prometheus.Gauge = promauto.NewGauge(prometheus.GaugeOpts{
+	Name:      "cost_metrics_last_updated_timestamp_seconds",
+	Help:      "Unix timestamp of the last successful update of the cost metrics.",
+	Namespace: "aad_finout_sync",
+})
+
+type costMetricsValues struct {
+	daily       float64
+	monthToDate float64
+}
+
+func CostMetricsHandler(ctx context.Context) error {
+	conf, err := config.LoadConfig()
+	if err != nil {
+		return err
+	}
+
+	if conf.Finout.Views.CostByCostCentre == "" && conf.Finout.Views.CostByCapability == "" {
+		return errors.New("no Finout views configured for cost metrics")
+	}
+
+	finoutClientApp := finout.NewFinoutClient()
+	finoutClientApp.SetAuthMethod(finout.AuthClientSecretMethod(finout.Config{ClientId: conf.Finout.ClientId, ClientSecret: conf.Finout.ClientSecret}))
+
+	now := time.Now().UTC()
+	today := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, time.UTC)
+	yesterday := today.AddDate(0, 0, -1)
+	monthStart := time.Date(now.Year(), now.Month(), 1, 0, 0, 0, 0, time.UTC)
+	from := monthStart
+	if yesterday.Before(from) {
+		from = yesterday
+	}
+
+	views := []struct {
+		viewId      string
+		daily       *prometheus.GaugeVec
+		monthToDate *prometheus.GaugeVec
+	}{
+		{conf.Finout.Views.CostByCostCentre, costCentreDailyCost, costCentreMonthToDateCost},
+		{conf.Finout.Views.CostByCapability, capabilityDailyCost, capabilityMonthToDateCost},
+	}
+
+	for _, view := range views {
+		if view.viewId == "" {
+			continue
+		}
+
+		resp, err := finoutClientApp.ApiApp().QueryByView(ctx, finout.QueryByViewRequest{
+			ViewId: view.viewId,
+			Date:   finout.NewQueryByViewRequestDate(from, now),
+		})
+		if err != nil {
+			return err
+		}
+
+		values := make(map[string]costMetricsValues)
+		for _, series := range resp.Data {
+			values[series.Name] = costMetricsValues{
+				daily:       series.CostBetween(yesterday, today),
+				monthToDate: series.CostBetween(monthStart, now),
+			}
+		}
+
+		values = limitCostMetricsSeries(values, conf.Finout.Metrics.MaxSeries)
+
+		view.daily.Reset()
+		view.monthToDate.Reset()
+		for name, val := range values {
+			view.daily.WithLabelValues(name).Set(val.daily)
+			view.monthToDate.WithLabelValues(name).Set(val.monthToDate)
+		}
+
+		util.Logger.Debug("Cost metrics updated", zap.String("jobName", CostMetricsName), zap.String("viewId", view.viewId), zap.Int("series", len(values)))
+	}
+
+	costMetricsLastUpdated.SetToCurrentTime()
+
+	return nil
+}
+
+// limitCostMetricsSeries keeps the maxSeries-1 most expensive series by month-to-date cost and folds the remainder into a single "other" series, to bound label cardinality.
+func limitCostMetricsSeries(values map[string]costMetricsValues, maxSeries int) map[string]costMetricsValues {
+	if maxSeries < 1 || len(values) <= maxSeries {
+		return values
+	}
+
+	names := make([]string, 0, len(values))
+	for name := range values {
+		if name != costMetricsOtherLabel {
+			names = append(names, name)
+		}
+	}
+	sort.Slice(names, func(i, j int) bool {
+		if values[names[i]].monthToDate == values[names[j]].monthToDate {
+			return names[i] < names[j]
+		}
+		return values[names[i]].monthToDate > values[names[j]].monthToDate
+	})
+
+	payload := make(map[string]costMetricsValues)
+	other := values[costMetricsOtherLabel]
+	for i, name := range names {
+		if i < maxSeries-1 {
+			payload[name] = values[name]
+			continue
+		}
+		other.daily = other.daily + values[name].daily
+		other.monthToDate = other.monthToDate + values[name].monthToDate
+	}
+	payload[costMetricsOtherLabel] = other
+
+	return payload
+}
@@ -0,0 +1,91 @@
+package handler
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLimitCostMetricsSeries(t *testing.T) {
+	values := map[string]costMetricsValues{
+		"ti-arch":    {daily: 10, monthToDate: 300},
+		"finance":    {daily: 5, monthToDate: 150},
+		"ti-network": {daily: 2, monthToDate: 60},
+		"marketing":  {daily: 2, monthToDate: 60},
+		"sales":      {daily: 1, monthToDate: 20},
+	}
+
+	tests := []struct {
+		name      string
+		values    map[string]costMetricsValues
+		maxSeries int
+		expected  map[string]costMetricsValues
+	}{
+		{
+			name:      "unlimited",
+			values:    values,
+			maxSeries: 0,
+			expected:  values,
+		},
+		{
+			name:      "within limit",
+			values:    values,
+			maxSeries: 5,
+			expected:  values,
+		},
+		{
+			name:      "truncated",
+			values:    values,
+			maxSeries: 3,
+			expected: map[string]costMetricsValues{
+				"ti-arch":             {daily: 10, monthToDate: 300},
+				"finance":             {daily: 5, monthToDate: 150},
+				costMetricsOtherLabel: {daily: 5, monthToDate: 140},
+			},
+		},
+		{
+			name:      "ties ordered by name",
+			values:    values,
+			maxSeries: 4,
+			expected: map[string]costMetricsValues{
+				"ti-arch":             {daily: 10, monthToDate: 300},
+				"finance":             {daily: 5, monthToDate: 150},
+				"marketing":           {daily: 2, monthToDate: 60},
+				costMetricsOtherLabel: {daily: 3, monthToDate: 80},
+			},
+		},
+		{
+			name:      "everything folded",
+			values:    values,
+			maxSeries: 1,
+			expected: map[string]costMetricsValues{
+				costMetricsOtherLabel: {daily: 20, monthToDate: 590},
+			},
+		},
+		{
+			name: "existing other series is merged",
+			values: map[string]costMetricsValues{
+				"ti-arch":             {daily: 10, monthToDate: 300},
+				costMetricsOtherLabel: {daily: 4, monthToDate: 200},
+				"finance":             {daily: 5, monthToDate: 150},
+				"sales":               {daily: 1, monthToDate: 20},
+			},
+			maxSeries: 3,
+			expected: map[string]costMetricsValues{
+				"ti-arch":             {daily: 10, monthToDate: 300},
+				"finance":             {daily: 5, monthToDate: 150},
+				costMetricsOtherLabel: {daily: 5, monthToDate: 220},
+			},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			result := limitCostMetricsSeries(test.values, test.maxSeries)
+			assert.Equal(t, test.expected, result)
+			if test.maxSeries > 0 {
+				assert.LessOrEqual(t, len(result), test.maxSeries)
+			}
+		})
+	}
+}
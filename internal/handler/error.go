@@ -6,4 +6,6 @@ var (
 	HandlerError              = errorx.NewNamespace("handler")
 	VirtualTagDoesNotExist    = HandlerError.NewType("tag_does_not_exist")
 	VirtualTagDoesNotExistMsg = "Unable to find virtual tag"
+	InvalidInput              = HandlerError.NewType("invalid_input")
+	NotFound                  = HandlerError.NewType("not_found")
 )
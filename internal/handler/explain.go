@@ -0,0 +1,215 @@
+package handler
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/service/organizations"
+	orgTypes "github.com/aws/aws-sdk-go-v2/service/organizations/types"
+	"go.dfds.cloud/aad-finout-sync/internal/aws"
+	"go.dfds.cloud/aad-finout-sync/internal/config"
+	"go.dfds.cloud/aad-finout-sync/internal/finout"
+	"go.dfds.cloud/aad-finout-sync/internal/ssu"
+	"go.dfds.cloud/aad-finout-sync/internal/util"
+	"go.uber.org/zap"
+)
+
+const ExplainCostCentreName = "explainCostCentre"
+
+type CostCentreExplanation struct {
+	CostCentre   string                            `json:"costCentre"`
+	AwsAccount   *CostCentreExplanationAwsAccount  `json:"awsAccount,omitempty"`
+	Capabilities []CostCentreExplanationCapability `json:"capabilities"`
+	Chain        []CostCentreExplanationStep       `json:"chain"`
+	Notes        []string                          `json:"notes,omitempty"`
+}
+
+type CostCentreExplanationAwsAccount struct {
+	Id    string `json:"id,omitempty"`
+	Alias string `json:"alias,omitempty"`
+}
+
+type CostCentreExplanationCapability struct {
+	Id         string `json:"id"`
+	RootId     string `json:"rootId"`
+	Name       string `json:"name"`
+	Status     string `json:"status"`
+	CostCentre string `json:"costCentre"`
+}
+
+// ExplainCostCentre evaluates the cost centre rules that CostCentre2FinoutHandler would send to Finout for either an AWS account (id or alias) or a capability (id or root id),
+// and returns the chain of rules that decide the cost centre.
+func ExplainCostCentre(ctx context.Context, awsAccount string, capability string) (*CostCentreExplanation, error) {
+	awsAccount = strings.TrimSpace(awsAccount)
+	capability = strings.TrimSpace(capability)
+	if (awsAccount == "") == (capability == "") {
+		return nil, InvalidInput.New("Exactly one of awsAccount or capability must be provided")
+	}
+
+	conf, err := config.LoadConfig()
+	if err != nil {
+		return nil, err
+	}
+
+	ssuClient, err := newSsuClient(conf)
+	if err != nil {
+		return nil, err
+	}
+
+	caps, err := ssuClient.GetCapabilities(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	mappings, err := getMappings()
+	if err != nil {
+		util.Logger.Warn("No manual mappings found, using default values", zap.Error(err), zap.String("jobName", ExplainCostCentreName))
+		mappings = &dataMappings{
+			AwsAccountAlias2CostCentre: []dataMappingsAwsAccountAlias2CostCentre{},
+		}
+	}
+
+	explanation := &CostCentreExplanation{
+		Capabilities: []CostCentreExplanationCapability{},
+		Notes:        []string{},
+	}
+
+	var matchedCaps []*ssu.GetCapabilitiesResponseContextCapability
+	if capability != "" {
+		for _, c := range caps {
+			if c.ID == capability || c.RootID == capability {
+				matchedCaps = append(matchedCaps, c)
+				break
+			}
+		}
+		if len(matchedCaps) == 0 {
+			return nil, NotFound.New(fmt.Sprintf("Capability %s not found", capability))
+		}
+	} else {
+		explanation.AwsAccount = resolveAwsAccountForExplanation(ctx, conf, awsAccount, explanation)
+		for _, c := range caps {
+			for _, capContext := range c.Contexts {
+				if explanation.AwsAccount.Id != "" && capContext.AwsAccountID == explanation.AwsAccount.Id {
+					matchedCaps = append(matchedCaps, c)
+					break
+				}
+			}
+		}
+		if len(matchedCaps) == 0 {
+			explanation.Notes = append(explanation.Notes, "No capability context is associated with this AWS account")
+		}
+	}
+
+	// A capability's own AWS account can be matched by a mapping file rule as well.
+	if explanation.AwsAccount == nil {
+		for _, c := range matchedCaps {
+			for _, capContext := range c.Contexts {
+				if capContext.AwsAccountID != "" && explanation.AwsAccount == nil {
+					explanation.AwsAccount = resolveAwsAccountForExplanation(ctx, conf, capContext.AwsAccountID, explanation)
+				}
+			}
+		}
+	}
+
+	// Capabilities left out of the cost rules by their lifecycle status are listed, but never match.
+	var ruleCaps []*ssu.GetCapabilitiesResponseContextCapability
+	for _, c := range matchedCaps {
+		if c.Lifecycle().IncludeInCostRules {
+			ruleCaps = append(ruleCaps, c)
+			continue
+		}
+		explanation.Notes = append(explanation.Notes, fmt.Sprintf("Capability %s is %s, so no capability rule is generated for it", c.RootID, c.LifecycleStatus()))
+		explanation.Capabilities = append(explanation.Capabilities, CostCentreExplanationCapability{
+			Id:     c.ID,
+			RootId: c.RootID,
+			Name:   c.Name,
+			Status: c.LifecycleStatus(),
+		})
+	}
+	matchedCaps = ruleCaps
+
+	// Only the capabilities relevant to the query are fetched; rules for other capabilities can never match and don't change the outcome.
+	// Cost centres are resolved the same way as CostCentre2FinoutHandler does, so capabilities whose metadata is unavailable keep their current rule.
+	capabilityIds := make([]string, 0, len(matchedCaps))
+	for _, c := range matchedCaps {
+		capabilityIds = append(capabilityIds, c.ID)
+	}
+	finoutClientApp := finout.NewFinoutClient()
+	finoutClientApp.SetAuthMethod(finout.AuthClientSecretMethod(finout.Config{ClientId: conf.Finout.ClientId, ClientSecret: conf.Finout.ClientSecret}))
+	capsTag, capsMetadata, err := getCapabilityCostCentres(ctx, conf, ssuClient, finoutClientApp.ApiApp(), ExplainCostCentreName, capabilityIds)
+	if err != nil {
+		return nil, err
+	}
+	for _, c := range matchedCaps {
+		costCentre := capsTag[c.ID]
+		if metadata, exists := capsMetadata[c.ID]; exists {
+			if costCentre == "" {
+				explanation.Notes = append(explanation.Notes, fmt.Sprintf("Capability %s has no valid '%s' metadata, so no capability rule is generated for it", c.RootID, tagKey))
+			}
+			for _, issue := range metadata.Issues {
+				if issue.Kind != ssu.MetadataIssueMissing {
+					explanation.Notes = append(explanation.Notes, fmt.Sprintf("Capability %s has invalid metadata, %s", c.RootID, issue))
+				}
+			}
+		} else if costCentre != "" {
+			explanation.Notes = append(explanation.Notes, fmt.Sprintf("Metadata of capability %s is unavailable, its current rule in Finout is kept", c.RootID))
+		} else {
+			explanation.Notes = append(explanation.Notes, fmt.Sprintf("Metadata of capability %s is unavailable and it has no current rule in Finout, so no capability rule is generated for it", c.RootID))
+		}
+
+		explanation.Capabilities = append(explanation.Capabilities, CostCentreExplanationCapability{
+			Id:         c.ID,
+			RootId:     c.RootID,
+			Name:       c.Name,
+			Status:     c.LifecycleStatus(),
+			CostCentre: costCentre,
+		})
+	}
+
+	accountAlias := ""
+	if explanation.AwsAccount != nil {
+		accountAlias = explanation.AwsAccount.Alias
+	}
+
+	ruleSet := newCostCentreRuleSet(capsTag, mappings)
+	explanation.CostCentre, explanation.Chain = ruleSet.evaluate(capabilityIds, accountAlias)
+
+	return explanation, nil
+}
+
+// resolveAwsAccountForExplanation completes an AWS account id or alias using AWS Organizations. Lookup failures are recorded as notes rather than failing the explanation.
+func resolveAwsAccountForExplanation(ctx context.Context, conf config.Config, val string, explanation *CostCentreExplanation) *CostCentreExplanationAwsAccount {
+	payload := &CostCentreExplanationAwsAccount{}
+	if len(val) == 12 && awsAccountIdPattern.MatchString(val) {
+		payload.Id = val
+	} else {
+		payload.Alias = val
+	}
+
+	if conf.Aws.RootOrganizationsParentId == "" {
+		explanation.Notes = append(explanation.Notes, "AWS Organizations lookup is not configured, the account could not be completed")
+		return payload
+	}
+
+	cfg, err := loadAwsConfig(ctx, conf, ExplainCostCentreName)
+	if err == nil {
+		var accounts []orgTypes.Account
+		accounts, err = aws.GetAllAccountsFromOuRecursive(ctx, organizations.NewFromConfig(cfg), conf.Aws.RootOrganizationsParentId)
+		if err == nil {
+			for _, acc := range accounts {
+				if (payload.Id != "" && *acc.Id == payload.Id) || (payload.Alias != "" && strings.EqualFold(*acc.Name, payload.Alias)) {
+					payload.Id = *acc.Id
+					payload.Alias = *acc.Name
+					return payload
+				}
+			}
+			explanation.Notes = append(explanation.Notes, "Account not found in AWS Organizations")
+			return payload
+		}
+	}
+
+	util.Logger.Warn("Unable to look up AWS account", zap.String("jobName", ExplainCostCentreName), zap.Error(err))
+	explanation.Notes = append(explanation.Notes, fmt.Sprintf("Unable to look up the account in AWS Organizations: %s", err))
+	return payload
+}
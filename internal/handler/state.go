@@ -0,0 +1,29 @@
+package handler
+
+import (
+	"fmt"
+	"sync"
+
+	"go.dfds.cloud/aad-finout-sync/internal/util"
+)
+
+var jobStateFiles = struct {
+	mu    sync.Mutex
+	files map[string]*util.JsonStateFile
+}{files: make(map[string]*util.JsonStateFile)}
+
+// jobStateFile returns the state file for name and path. The same instance is returned for every run, so state kept in memory survives between runs.
+// name keeps different kinds of state apart when they are only kept in memory.
+func jobStateFile(name string, path string) *util.JsonStateFile {
+	jobStateFiles.mu.Lock()
+	defer jobStateFiles.mu.Unlock()
+
+	key := fmt.Sprintf("%s:%s", name, path)
+	if file, exists := jobStateFiles.files[key]; exists {
+		return file
+	}
+
+	file := util.NewJsonStateFile(path)
+	jobStateFiles.files[key] = file
+	return file
+}
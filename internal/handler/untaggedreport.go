@@ -0,0 +1,247 @@
+package handler
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/service/organizations"
+	orgTypes "github.com/aws/aws-sdk-go-v2/service/organizations/types"
+	"go.dfds.cloud/aad-finout-sync/internal/aws"
+	"go.dfds.cloud/aad-finout-sync/internal/config"
+	"go.dfds.cloud/aad-finout-sync/internal/finout"
+	"go.dfds.cloud/aad-finout-sync/internal/ssu"
+	"go.dfds.cloud/aad-finout-sync/internal/util"
+	"go.uber.org/zap"
+)
+
+const UntaggedSpendReportName = "untaggedSpendReport"
+
+const untaggedSpendReportDefaultPeriod = time.Hour * 24 * 30
+
+var awsAccountIdPattern = regexp.MustCompile(`\b\d{12}\b`)
+
+type UntaggedSpendReport struct {
+	From      time.Time                     `json:"from"`
+	To        time.Time                     `json:"to"`
+	TotalCost float64                       `json:"totalCost"`
+	Accounts  []*UntaggedSpendReportAccount `json:"accounts"`
+}
+
+type UntaggedSpendReportAccount struct {
+	FinoutName       string  `json:"finoutName"`
+	AccountId        string  `json:"accountId"`
+	AccountName      string  `json:"accountName"`
+	Cost             float64 `json:"cost"`
+	CapabilityId     string  `json:"capabilityId,omitempty"`
+	CapabilityRootId string  `json:"capabilityRootId,omitempty"`
+	CostCentre       string  `json:"costCentre,omitempty"`
+	MappingFileEntry string  `json:"mappingFileEntry,omitempty"`
+	Suggestion       string  `json:"suggestion"`
+
+	MetadataIssues []ssu.MetadataIssue `json:"metadataIssues,omitempty"`
+}
+
+func UntaggedSpendReportHandler(ctx context.Context) error {
+	to := time.Now()
+	report, err := BuildUntaggedSpendReport(ctx, to.Add(-untaggedSpendReportDefaultPeriod), to)
+	if err != nil {
+		return err
+	}
+
+	util.Logger.Info(fmt.Sprintf("Untagged spend between %s and %s: %.2f across %d accounts", report.From.Format(time.DateOnly), report.To.Format(time.DateOnly), report.TotalCost, len(report.Accounts)), zap.String("jobName", UntaggedSpendReportName))
+	for _, account := range report.Accounts {
+		util.Logger.Info(account.Suggestion,
+			zap.String("jobName", UntaggedSpendReportName),
+			zap.String("accountId", account.AccountId),
+			zap.String("accountName", account.AccountName),
+			zap.Float64("cost", account.Cost),
+			zap.String("capabilityId", account.CapabilityId),
+			zap.String("costCentre", account.CostCentre))
+	}
+
+	return nil
+}
+
+// BuildUntaggedSpendReport lists every AWS account contributing to the Untagged cost centre in Finout, cross-referenced with AWS Organizations and the capability service.
+func BuildUntaggedSpendReport(ctx context.Context, from time.Time, to time.Time) (*UntaggedSpendReport, error) {
+	conf, err := config.LoadConfig()
+	if err != nil {
+		return nil, err
+	}
+
+	if conf.Finout.Views.UntaggedByAccount == "" {
+		return nil, errors.New("no Finout view configured for untagged spend by AWS account")
+	}
+
+	finoutClientApp := finout.NewFinoutClient()
+	finoutClientApp.SetAuthMethod(finout.AuthClientSecretMethod(finout.Config{ClientId: conf.Finout.ClientId, ClientSecret: conf.Finout.ClientSecret}))
+	ssuClient, err := newSsuClient(conf)
+	if err != nil {
+		return nil, err
+	}
+
+	costs, err := finoutClientApp.ApiApp().QueryByView(ctx, finout.QueryByViewRequest{
+		ViewId: conf.Finout.Views.UntaggedByAccount,
+		Date:   finout.NewQueryByViewRequestDate(from, to),
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	cfg, err := loadAwsConfig(ctx, conf, UntaggedSpendReportName)
+	if err != nil {
+		return nil, err
+	}
+
+	awsAccounts, err := aws.GetAllAccountsFromOuRecursive(ctx, organizations.NewFromConfig(cfg), conf.Aws.RootOrganizationsParentId)
+	if err != nil {
+		return nil, err
+	}
+
+	caps, err := ssuClient.GetCapabilities(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	mappings, err := getMappings()
+	if err != nil {
+		util.Logger.Warn("No manual mappings found, using default values", zap.Error(err), zap.String("jobName", UntaggedSpendReportName))
+		mappings = &dataMappings{
+			AwsAccountAlias2CostCentre: []dataMappingsAwsAccountAlias2CostCentre{},
+		}
+	}
+
+	report := &UntaggedSpendReport{
+		From:     from,
+		To:       to,
+		Accounts: []*UntaggedSpendReportAccount{},
+	}
+
+	lookup := &untaggedSpendLookup{
+		accountsById:            make(map[string]orgTypes.Account),
+		accountsByName:          make(map[string]orgTypes.Account),
+		capabilitiesByAccountId: make(map[string]*ssu.GetCapabilitiesResponseContextCapability),
+		mappingsByAlias:         make(map[string]string),
+	}
+	for _, acc := range awsAccounts {
+		lookup.accountsById[*acc.Id] = acc
+		lookup.accountsByName[strings.ToLower(*acc.Name)] = acc
+	}
+
+	for _, capability := range costRuleCapabilities(caps) {
+		for _, capContext := range capability.Contexts {
+			if capContext.AwsAccountID != "" {
+				lookup.capabilitiesByAccountId[capContext.AwsAccountID] = capability
+			}
+		}
+	}
+
+	for _, mapping := range mappings.AwsAccountAlias2CostCentre {
+		lookup.mappingsByAlias[strings.ToLower(mapping.Alias)] = mapping.CostCentre
+	}
+
+	// Only the metadata of capabilities owning an untagged account is needed.
+	var capabilityIds []string
+	for _, series := range costs.Data {
+		if acc, found := lookupAwsAccount(series.Name, lookup.accountsById, lookup.accountsByName); found {
+			if capability, exists := lookup.capabilitiesByAccountId[*acc.Id]; exists {
+				capabilityIds = append(capabilityIds, capability.ID)
+			}
+		}
+	}
+	lookup.capsMetadata, err = getCapabilitiesMetadata(ctx, conf, ssuClient, UntaggedSpendReportName, capabilityIds)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, series := range costs.Data {
+		select {
+		case <-ctx.Done():
+			util.Logger.Info("Job cancelled", zap.String("jobName", UntaggedSpendReportName))
+			return nil, ctx.Err()
+		default:
+		}
+
+		entry := lookup.account(series.Name, series.TotalCost())
+		report.TotalCost = report.TotalCost + entry.Cost
+		report.Accounts = append(report.Accounts, entry)
+	}
+
+	sort.SliceStable(report.Accounts, func(i, j int) bool {
+		return report.Accounts[i].Cost > report.Accounts[j].Cost
+	})
+
+	return report, nil
+}
+
+// lookupAwsAccount resolves a Finout series name, which either contains the account id or is the account name, to an AWS account.
+func lookupAwsAccount(name string, accountsById map[string]orgTypes.Account, accountsByName map[string]orgTypes.Account) (orgTypes.Account, bool) {
+	if id := awsAccountIdPattern.FindString(name); id != "" {
+		if acc, exists := accountsById[id]; exists {
+			return acc, true
+		}
+	}
+
+	acc, exists := accountsByName[strings.ToLower(strings.TrimSpace(name))]
+	return acc, exists
+}
+
+type untaggedSpendLookup struct {
+	accountsById            map[string]orgTypes.Account
+	accountsByName          map[string]orgTypes.Account
+	capabilitiesByAccountId map[string]*ssu.GetCapabilitiesResponseContextCapability
+	mappingsByAlias         map[string]string
+	capsMetadata            map[string]*ssu.Metadata
+}
+
+// account builds the report entry for a Finout series, including a suggestion on how to get its spend tagged.
+func (l *untaggedSpendLookup) account(finoutName string, cost float64) *UntaggedSpendReportAccount {
+	entry := &UntaggedSpendReportAccount{
+		FinoutName: finoutName,
+		Cost:       cost,
+	}
+
+	acc, found := lookupAwsAccount(finoutName, l.accountsById, l.accountsByName)
+	if !found {
+		entry.AccountId = awsAccountIdPattern.FindString(finoutName)
+		entry.Suggestion = "Account not found in AWS Organizations, verify that the Finout view is grouped by AWS account and that the account belongs to the organisation"
+		return entry
+	}
+	entry.AccountId = *acc.Id
+	entry.AccountName = *acc.Name
+
+	if costCentre, exists := l.mappingsByAlias[strings.ToLower(entry.AccountName)]; exists {
+		entry.MappingFileEntry = costCentre
+	}
+
+	capability, hasCapability := l.capabilitiesByAccountId[entry.AccountId]
+	if !hasCapability {
+		if entry.MappingFileEntry != "" {
+			entry.Suggestion = fmt.Sprintf("Account has a mapping file entry for cost centre '%s' but is still untagged, verify that the alias matches the aws_account_name in Finout", entry.MappingFileEntry)
+		} else {
+			entry.Suggestion = fmt.Sprintf("Account is not owned by any capability, add an awsAccountAlias2CostCentre entry for '%s' to the mapping file", entry.AccountName)
+		}
+		return entry
+	}
+
+	entry.CapabilityId = capability.ID
+	entry.CapabilityRootId = capability.RootID
+
+	if metadata, exists := l.capsMetadata[capability.ID]; exists {
+		entry.CostCentre = metadata.CostCentre
+		entry.MetadataIssues = metadata.Issues
+	}
+
+	if entry.CostCentre == "" {
+		entry.Suggestion = fmt.Sprintf("Capability %s has no '%s' metadata, set it in the capability service", capability.RootID, tagKey)
+	} else {
+		entry.Suggestion = fmt.Sprintf("Capability %s has cost centre '%s' but its spend is untagged, verify that the 'capability' virtual tag in Finout covers this account", capability.RootID, entry.CostCentre)
+	}
+
+	return entry
+}
@@ -0,0 +1,109 @@
+package handler
+
+import (
+	"strings"
+	"testing"
+
+	awsSdk "github.com/aws/aws-sdk-go-v2/aws"
+	orgTypes "github.com/aws/aws-sdk-go-v2/service/organizations/types"
+	"github.com/stretchr/testify/assert"
+	"go.dfds.cloud/aad-finout-sync/internal/ssu"
+)
+
+func newTestUntaggedSpendLookup() *untaggedSpendLookup {
+	owned := orgTypes.Account{Id: awsSdk.String("111111111111"), Name: awsSdk.String("cap-a-prod")}
+	untaggedOwner := orgTypes.Account{Id: awsSdk.String("222222222222"), Name: awsSdk.String("cap-b-prod")}
+	unowned := orgTypes.Account{Id: awsSdk.String("333333333333"), Name: awsSdk.String("Shared-Network")}
+	mapped := orgTypes.Account{Id: awsSdk.String("444444444444"), Name: awsSdk.String("legacy")}
+
+	lookup := &untaggedSpendLookup{
+		accountsById:   make(map[string]orgTypes.Account),
+		accountsByName: make(map[string]orgTypes.Account),
+		capabilitiesByAccountId: map[string]*ssu.GetCapabilitiesResponseContextCapability{
+			"111111111111": {ID: "cap-a", RootID: "cap-a-xyz"},
+			"222222222222": {ID: "cap-b", RootID: "cap-b-xyz"},
+		},
+		mappingsByAlias: map[string]string{"legacy": "finance"},
+		capsMetadata: map[string]*ssu.Metadata{
+			"cap-a": ssu.ParseMetadata(map[string]interface{}{ssu.MetadataKeyCostCentre: "ti-arch"}),
+			"cap-b": ssu.ParseMetadata(nil),
+		},
+	}
+	for _, acc := range []orgTypes.Account{owned, untaggedOwner, unowned, mapped} {
+		lookup.accountsById[*acc.Id] = acc
+		lookup.accountsByName[strings.ToLower(*acc.Name)] = acc
+	}
+
+	return lookup
+}
+
+func TestUntaggedSpendLookup_Account(t *testing.T) {
+	lookup := newTestUntaggedSpendLookup()
+
+	tests := []struct {
+		name       string
+		finoutName string
+		expected   UntaggedSpendReportAccount
+	}{
+		{
+			name:       "owned by capability with cost centre",
+			finoutName: "cap-a-prod (111111111111)",
+			expected: UntaggedSpendReportAccount{
+				AccountId:        "111111111111",
+				AccountName:      "cap-a-prod",
+				CapabilityId:     "cap-a",
+				CapabilityRootId: "cap-a-xyz",
+				CostCentre:       "ti-arch",
+				Suggestion:       "Capability cap-a-xyz has cost centre 'ti-arch' but its spend is untagged, verify that the 'capability' virtual tag in Finout covers this account",
+			},
+		},
+		{
+			name:       "owned by capability without cost centre",
+			finoutName: "222222222222",
+			expected: UntaggedSpendReportAccount{
+				AccountId:        "222222222222",
+				AccountName:      "cap-b-prod",
+				CapabilityId:     "cap-b",
+				CapabilityRootId: "cap-b-xyz",
+				Suggestion:       "Capability cap-b-xyz has no 'dfds.cost.centre' metadata, set it in the capability service",
+				MetadataIssues:   []ssu.MetadataIssue{{Key: ssu.MetadataKeyCostCentre, Kind: ssu.MetadataIssueMissing, Message: "required key is missing"}},
+			},
+		},
+		{
+			name:       "unowned account",
+			finoutName: "shared-network",
+			expected: UntaggedSpendReportAccount{
+				AccountId:   "333333333333",
+				AccountName: "Shared-Network",
+				Suggestion:  "Account is not owned by any capability, add an awsAccountAlias2CostCentre entry for 'Shared-Network' to the mapping file",
+			},
+		},
+		{
+			name:       "unowned account with mapping file entry",
+			finoutName: "444444444444",
+			expected: UntaggedSpendReportAccount{
+				AccountId:        "444444444444",
+				AccountName:      "legacy",
+				MappingFileEntry: "finance",
+				Suggestion:       "Account has a mapping file entry for cost centre 'finance' but is still untagged, verify that the alias matches the aws_account_name in Finout",
+			},
+		},
+		{
+			name:       "unknown account",
+			finoutName: "old-sandbox (999999999999)",
+			expected: UntaggedSpendReportAccount{
+				AccountId:  "999999999999",
+				Suggestion: "Account not found in AWS Organizations, verify that the Finout view is grouped by AWS account and that the account belongs to the organisation",
+			},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			test.expected.FinoutName = test.finoutName
+			test.expected.Cost = 12.5
+
+			assert.Equal(t, &test.expected, lookup.account(test.finoutName, 12.5))
+		})
+	}
+}
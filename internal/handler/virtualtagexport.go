@@ -0,0 +1,182 @@
+package handler
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"go.dfds.cloud/aad-finout-sync/internal/config"
+	"go.dfds.cloud/aad-finout-sync/internal/finout"
+	"go.dfds.cloud/aad-finout-sync/internal/util"
+	"go.uber.org/zap"
+)
+
+const ExportVirtualTagName = "exportVirtualTag"
+
+type VirtualTagExport struct {
+	TagId           string                     `json:"tagId"`
+	TagName         string                     `json:"tagName"`
+	Default         string                     `json:"default"`
+	Mappings        *dataMappings              `json:"mappings"`
+	ManagedRules    int                        `json:"managedRules"`
+	Unrepresentable []VirtualTagExportRule     `json:"unrepresentable"`
+	Conflicts       []VirtualTagExportConflict `json:"conflicts,omitempty"`
+}
+
+type VirtualTagExportRule struct {
+	Index   int                                    `json:"index"`
+	To      string                                 `json:"to"`
+	Filters finout.GetVirtualTagResponseRuleFilter `json:"filters"`
+	Reason  string                                 `json:"reason"`
+}
+
+// VirtualTagExportConflict is an AWS account alias that maps to a different cost centre in the live tag than in the mapping file.
+type VirtualTagExportConflict struct {
+	Alias      string `json:"alias"`
+	File       string `json:"file"`
+	VirtualTag string `json:"virtualTag"`
+}
+
+// ExportCostCentreVirtualTag reads the live cost centre virtual tag from Finout and converts its AWS account rules into the mapping file format.
+// Rules for capabilities are managed by CostCentre2FinoutHandler and are only counted. Rules that can't be expressed in the mapping file are returned as unrepresentable.
+// If merge is true, the result is merged with the current mapping file. Entries from the file take precedence, differences are reported as conflicts.
+func ExportCostCentreVirtualTag(ctx context.Context, merge bool) (*VirtualTagExport, error) {
+	conf, err := config.LoadConfig()
+	if err != nil {
+		return nil, err
+	}
+
+	finoutClientApp := finout.NewFinoutClient()
+	finoutClientApp.SetAuthMethod(finout.AuthClientSecretMethod(finout.Config{ClientId: conf.Finout.ClientId, ClientSecret: conf.Finout.ClientSecret}))
+
+	tags, err := finoutClientApp.ApiApp().ListVirtualTags(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	tag, exists := tags[tagKey]
+	if !exists {
+		return nil, NotFound.New(fmt.Sprintf("Virtual tag '%s' not found", tagKey))
+	}
+
+	capabilityTagId := ""
+	if capabilityTag, exists := tags["capability"]; exists {
+		capabilityTagId = capabilityTag.ID
+	}
+
+	resp, err := finoutClientApp.ApiApp().GetVirtualTag(ctx, tag.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	export := convertVirtualTagToMappings(resp, capabilityTagId)
+
+	if merge {
+		mappings, err := getMappings()
+		if err != nil {
+			util.Logger.Warn("No manual mappings found, nothing to merge with", zap.Error(err), zap.String("jobName", ExportVirtualTagName))
+		} else {
+			export.Mappings, export.Conflicts = mergeMappings(mappings, export.Mappings)
+		}
+	}
+
+	return export, nil
+}
+
+// convertVirtualTagToMappings converts the rules of a cost centre virtual tag into the mapping file format, keeping the rule order Finout evaluates them in.
+func convertVirtualTagToMappings(tag *finout.GetVirtualTagResponse, capabilityTagId string) *VirtualTagExport {
+	export := &VirtualTagExport{
+		TagId:   tag.ID,
+		TagName: tag.Name,
+		Default: tag.Default.Value,
+		Mappings: &dataMappings{
+			AwsAccountAlias2CostCentre: []dataMappingsAwsAccountAlias2CostCentre{},
+		},
+		Unrepresentable: []VirtualTagExportRule{},
+	}
+
+	seen := make(map[string]bool)
+	for i, rule := range tag.Rules {
+		filter := rule.Filters
+		unrepresentable := func(reason string) {
+			export.Unrepresentable = append(export.Unrepresentable, VirtualTagExportRule{
+				Index:   i + 1,
+				To:      rule.To,
+				Filters: filter,
+				Reason:  reason,
+			})
+		}
+
+		if len(filter.And) > 0 || len(filter.Or) > 0 {
+			unrepresentable("Rule combines multiple filters")
+			continue
+		}
+
+		if filter.CostCenter == "virtualTag" && capabilityTagId != "" && filter.Key == capabilityTagId {
+			export.ManagedRules = export.ManagedRules + 1
+			continue
+		}
+
+		if filter.CostCenter != "amazon-cur" || filter.Key != "aws_account_name" {
+			unrepresentable(fmt.Sprintf("Filter on '%s' '%s' is not an AWS account name", filter.CostCenter, filter.Key))
+			continue
+		}
+
+		if filter.Operator != "oneOf" && filter.Operator != "is" {
+			unrepresentable(fmt.Sprintf("Operator '%s' is not supported, only exact matches can be represented", filter.Operator))
+			continue
+		}
+
+		values := filter.Values()
+		if len(values) == 0 {
+			unrepresentable("Rule has no values")
+			continue
+		}
+
+		for _, alias := range values {
+			// Finout applies the first matching rule, so later rules for the same alias never take effect. Aliases are compared case-insensitively, like in mergeMappings.
+			key := strings.ToLower(alias)
+			if seen[key] {
+				continue
+			}
+			seen[key] = true
+			export.Mappings.AwsAccountAlias2CostCentre = append(export.Mappings.AwsAccountAlias2CostCentre, dataMappingsAwsAccountAlias2CostCentre{
+				Alias:      alias,
+				CostCentre: rule.To,
+			})
+		}
+	}
+
+	return export
+}
+
+func mergeMappings(file *dataMappings, live *dataMappings) (*dataMappings, []VirtualTagExportConflict) {
+	payload := &dataMappings{
+		AwsAccountAlias2CostCentre: []dataMappingsAwsAccountAlias2CostCentre{},
+		Department2CostCentre:      file.Department2CostCentre, // not part of the virtual tag
+	}
+	var conflicts []VirtualTagExportConflict
+
+	fromFile := make(map[string]string)
+	for _, mapping := range file.AwsAccountAlias2CostCentre {
+		fromFile[strings.ToLower(mapping.Alias)] = mapping.CostCentre
+		payload.AwsAccountAlias2CostCentre = append(payload.AwsAccountAlias2CostCentre, mapping)
+	}
+
+	for _, mapping := range live.AwsAccountAlias2CostCentre {
+		costCentre, exists := fromFile[strings.ToLower(mapping.Alias)]
+		if !exists {
+			payload.AwsAccountAlias2CostCentre = append(payload.AwsAccountAlias2CostCentre, mapping)
+			continue
+		}
+		if costCentre != mapping.CostCentre {
+			conflicts = append(conflicts, VirtualTagExportConflict{
+				Alias:      mapping.Alias,
+				File:       costCentre,
+				VirtualTag: mapping.CostCentre,
+			})
+		}
+	}
+
+	return payload, conflicts
+}
@@ -0,0 +1,86 @@
+package handler
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"go.dfds.cloud/aad-finout-sync/internal/finout"
+)
+
+func TestConvertVirtualTagToMappings(t *testing.T) {
+	tag := &finout.GetVirtualTagResponse{
+		ID:   "tag-1",
+		Name: tagKey,
+		Rules: []finout.GetVirtualTagResponseRule{
+			{To: "ti-arch", Filters: finout.GetVirtualTagResponseRuleFilter{CostCenter: "virtualTag", Key: "capability-tag", Operator: "oneOf", Value: []interface{}{"cap-a"}}},
+			{To: "ti-platform", Filters: finout.GetVirtualTagResponseRuleFilter{CostCenter: "amazon-cur", Key: "aws_account_name", Operator: "oneOf", Value: []interface{}{"shared-prod", "Shared-Network"}}},
+			{To: "finance", Filters: finout.GetVirtualTagResponseRuleFilter{CostCenter: "amazon-cur", Key: "aws_account_name", Operator: "is", Value: "legacy"}},
+			{To: "finance", Filters: finout.GetVirtualTagResponseRuleFilter{CostCenter: "amazon-cur", Key: "aws_account_name", Operator: "is", Value: "SHARED-PROD"}},
+			{To: "finance", Filters: finout.GetVirtualTagResponseRuleFilter{CostCenter: "amazon-cur", Key: "aws_account_name", Operator: "contains", Value: "fin-"}},
+			{To: "finance", Filters: finout.GetVirtualTagResponseRuleFilter{CostCenter: "amazon-cur", Key: "aws_account_id", Operator: "is", Value: "111111111111"}},
+			{To: "finance", Filters: finout.GetVirtualTagResponseRuleFilter{Or: []finout.GetVirtualTagResponseRuleFilter{{CostCenter: "amazon-cur", Key: "aws_account_name", Operator: "is", Value: "a"}}}},
+			{To: "finance", Filters: finout.GetVirtualTagResponseRuleFilter{CostCenter: "amazon-cur", Key: "aws_account_name", Operator: "oneOf", Value: []interface{}{}}},
+		},
+	}
+	tag.Default.Value = costCentreDefaultValue
+
+	export := convertVirtualTagToMappings(tag, "capability-tag")
+
+	assert.Equal(t, "tag-1", export.TagId)
+	assert.Equal(t, costCentreDefaultValue, export.Default)
+	assert.Equal(t, 1, export.ManagedRules)
+	// The later SHARED-PROD rule is shadowed by the earlier shared-prod rule, regardless of case.
+	assert.Equal(t, []dataMappingsAwsAccountAlias2CostCentre{
+		{Alias: "shared-prod", CostCentre: "ti-platform"},
+		{Alias: "Shared-Network", CostCentre: "ti-platform"},
+		{Alias: "legacy", CostCentre: "finance"},
+	}, export.Mappings.AwsAccountAlias2CostCentre)
+
+	var unrepresentable []int
+	for _, rule := range export.Unrepresentable {
+		unrepresentable = append(unrepresentable, rule.Index)
+	}
+	assert.Equal(t, []int{5, 6, 7, 8}, unrepresentable)
+}
+
+func TestConvertVirtualTagToMappings_NoCapabilityTag(t *testing.T) {
+	tag := &finout.GetVirtualTagResponse{
+		Rules: []finout.GetVirtualTagResponseRule{
+			{To: "ti-arch", Filters: finout.GetVirtualTagResponseRuleFilter{CostCenter: "virtualTag", Key: "capability-tag", Operator: "oneOf", Value: []interface{}{"cap-a"}}},
+		},
+	}
+
+	export := convertVirtualTagToMappings(tag, "")
+
+	assert.Equal(t, 0, export.ManagedRules)
+	assert.Len(t, export.Unrepresentable, 1)
+	assert.Empty(t, export.Mappings.AwsAccountAlias2CostCentre)
+}
+
+func TestMergeMappings(t *testing.T) {
+	file := &dataMappings{
+		AwsAccountAlias2CostCentre: []dataMappingsAwsAccountAlias2CostCentre{
+			{Alias: "shared-prod", CostCentre: "ti-platform"},
+			{Alias: "Legacy", CostCentre: "finance"},
+		},
+		Department2CostCentre: []dataMappingsDepartment2CostCentre{{Department: "Finance", CostCentre: "finance"}},
+	}
+	live := &dataMappings{
+		AwsAccountAlias2CostCentre: []dataMappingsAwsAccountAlias2CostCentre{
+			{Alias: "SHARED-PROD", CostCentre: "ti-platform"},
+			{Alias: "legacy", CostCentre: "ti-arch"},
+			{Alias: "sandbox", CostCentre: "ti-arch"},
+		},
+	}
+
+	merged, conflicts := mergeMappings(file, live)
+
+	// File entries come first and take precedence, new live entries are appended.
+	assert.Equal(t, []dataMappingsAwsAccountAlias2CostCentre{
+		{Alias: "shared-prod", CostCentre: "ti-platform"},
+		{Alias: "Legacy", CostCentre: "finance"},
+		{Alias: "sandbox", CostCentre: "ti-arch"},
+	}, merged.AwsAccountAlias2CostCentre)
+	assert.Equal(t, file.Department2CostCentre, merged.Department2CostCentre)
+	assert.Equal(t, []VirtualTagExportConflict{{Alias: "legacy", File: "finance", VirtualTag: "ti-arch"}}, conflicts)
+}
@@ -0,0 +1,9 @@
+package mail
+
+import "github.com/joomcode/errorx"
+
+var (
+	MailError       = errorx.NewNamespace("mail")
+	NoRecipients    = MailError.NewType("no_recipients")
+	NoRecipientsMsg = "Message has no recipients"
+)
@@ -0,0 +1,163 @@
+package mail
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"fmt"
+	"mime"
+	"mime/multipart"
+	"net"
+	"net/smtp"
+	"net/textproto"
+	"strings"
+	"time"
+)
+
+type Client struct {
+	config Config
+}
+
+type Config struct {
+	Host     string `json:"host"`
+	Port     int    `json:"port"`
+	Username string `json:"username"`
+	Password string `json:"password"`
+	From     string `json:"from"`
+	StartTls bool   `json:"startTls"`
+}
+
+type Message struct {
+	To      []string
+	Subject string
+	Text    string
+	Html    string
+}
+
+func (c *Client) address() string {
+	return net.JoinHostPort(c.config.Host, fmt.Sprintf("%d", c.config.Port))
+}
+
+// Send delivers the message as a multipart/alternative mail with a plain text and a HTML part.
+func (c *Client) Send(ctx context.Context, msg Message) error {
+	if len(msg.To) == 0 {
+		return NoRecipients.New(NoRecipientsMsg)
+	}
+
+	body, err := c.buildMessage(msg)
+	if err != nil {
+		return err
+	}
+
+	dialer := &net.Dialer{Timeout: time.Second * 30}
+	conn, err := dialer.DialContext(ctx, "tcp", c.address())
+	if err != nil {
+		return err
+	}
+	if deadline, ok := ctx.Deadline(); ok {
+		conn.SetDeadline(deadline)
+	}
+
+	client, err := smtp.NewClient(conn, c.config.Host)
+	if err != nil {
+		conn.Close()
+		return err
+	}
+	defer client.Close()
+
+	if c.config.StartTls {
+		err = client.StartTLS(&tls.Config{ServerName: c.config.Host})
+		if err != nil {
+			return err
+		}
+	}
+
+	if c.config.Username != "" {
+		err = client.Auth(smtp.PlainAuth("", c.config.Username, c.config.Password, c.config.Host))
+		if err != nil {
+			return err
+		}
+	}
+
+	err = client.Mail(c.config.From)
+	if err != nil {
+		return err
+	}
+
+	for _, recipient := range msg.To {
+		err = client.Rcpt(recipient)
+		if err != nil {
+			return err
+		}
+	}
+
+	writer, err := client.Data()
+	if err != nil {
+		return err
+	}
+
+	_, err = writer.Write(body)
+	if err != nil {
+		return err
+	}
+
+	err = writer.Close()
+	if err != nil {
+		return err
+	}
+
+	return client.Quit()
+}
+
+func (c *Client) buildMessage(msg Message) ([]byte, error) {
+	var buf bytes.Buffer
+	mw := multipart.NewWriter(&buf)
+
+	fmt.Fprintf(&buf, "From: %s\r\n", c.config.From)
+	fmt.Fprintf(&buf, "To: %s\r\n", strings.Join(msg.To, ", "))
+	fmt.Fprintf(&buf, "Subject: %s\r\n", mime.QEncoding.Encode("utf-8", msg.Subject))
+	fmt.Fprintf(&buf, "Date: %s\r\n", time.Now().Format(time.RFC1123Z))
+	fmt.Fprintf(&buf, "MIME-Version: 1.0\r\n")
+	fmt.Fprintf(&buf, "Content-Type: multipart/alternative; boundary=%s\r\n\r\n", mw.Boundary())
+
+	parts := []struct {
+		contentType string
+		content     string
+	}{
+		{"text/plain; charset=utf-8", msg.Text},
+		{"text/html; charset=utf-8", msg.Html},
+	}
+
+	for _, part := range parts {
+		if part.content == "" {
+			continue
+		}
+
+		header := textproto.MIMEHeader{}
+		header.Set("Content-Type", part.contentType)
+		header.Set("Content-Transfer-Encoding", "8bit")
+		pw, err := mw.CreatePart(header)
+		if err != nil {
+			return nil, err
+		}
+
+		normalised := strings.ReplaceAll(part.content, "\r\n", "\n")
+		_, err = pw.Write([]byte(strings.ReplaceAll(normalised, "\n", "\r\n")))
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	err := mw.Close()
+	if err != nil {
+		return nil, err
+	}
+
+	return buf.Bytes(), nil
+}
+
+func NewMailClient(conf Config) *Client {
+	return &Client{
+		config: conf,
+	}
+}
@@ -0,0 +1,141 @@
+package mail
+
+import (
+	"bufio"
+	"context"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type fakeSmtpServer struct {
+	listener   net.Listener
+	mu         sync.Mutex
+	from       string
+	recipients []string
+	data       string
+}
+
+func newFakeSmtpServer(t *testing.T) *fakeSmtpServer {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.NoError(t, err)
+
+	srv := &fakeSmtpServer{listener: listener}
+	go srv.serve()
+	t.Cleanup(func() {
+		listener.Close()
+	})
+
+	return srv
+}
+
+func (s *fakeSmtpServer) port() int {
+	return s.listener.Addr().(*net.TCPAddr).Port
+}
+
+func (s *fakeSmtpServer) serve() {
+	for {
+		conn, err := s.listener.Accept()
+		if err != nil {
+			return
+		}
+		go s.handle(conn)
+	}
+}
+
+func (s *fakeSmtpServer) handle(conn net.Conn) {
+	defer conn.Close()
+	reader := bufio.NewReader(conn)
+	reply := func(line string) {
+		conn.Write([]byte(line + "\r\n"))
+	}
+
+	reply("220 localhost fake smtp")
+	for {
+		line, err := reader.ReadString('\n')
+		if err != nil {
+			return
+		}
+		line = strings.TrimRight(line, "\r\n")
+		cmd := strings.ToUpper(line)
+
+		switch {
+		case strings.HasPrefix(cmd, "EHLO"), strings.HasPrefix(cmd, "HELO"):
+			reply("250 localhost")
+		case strings.HasPrefix(cmd, "MAIL FROM:"):
+			s.mu.Lock()
+			s.from = strings.Trim(line[len("MAIL FROM:"):], "<>")
+			s.mu.Unlock()
+			reply("250 OK")
+		case strings.HasPrefix(cmd, "RCPT TO:"):
+			s.mu.Lock()
+			s.recipients = append(s.recipients, strings.Trim(line[len("RCPT TO:"):], "<>"))
+			s.mu.Unlock()
+			reply("250 OK")
+		case cmd == "DATA":
+			reply("354 End data with <CR><LF>.<CR><LF>")
+			var data strings.Builder
+			for {
+				dataLine, err := reader.ReadString('\n')
+				if err != nil {
+					return
+				}
+				if dataLine == ".\r\n" {
+					break
+				}
+				data.WriteString(dataLine)
+			}
+			s.mu.Lock()
+			s.data = data.String()
+			s.mu.Unlock()
+			reply("250 OK")
+		case cmd == "QUIT":
+			reply("221 Bye")
+			return
+		default:
+			reply("250 OK")
+		}
+	}
+}
+
+func TestClient_Send(t *testing.T) {
+	srv := newFakeSmtpServer(t)
+	client := NewMailClient(Config{
+		Host: "127.0.0.1",
+		Port: srv.port(),
+		From: "noreply@dfds.cloud",
+	})
+
+	err := client.Send(context.Background(), Message{
+		To:      []string{"first@dfds.cloud", "second@dfds.cloud"},
+		Subject: "Monthly digest",
+		Text:    "plain body",
+		Html:    "<p>html body</p>",
+	})
+	assert.NoError(t, err)
+
+	srv.mu.Lock()
+	defer srv.mu.Unlock()
+	assert.Equal(t, "noreply@dfds.cloud", srv.from)
+	assert.Equal(t, []string{"first@dfds.cloud", "second@dfds.cloud"}, srv.recipients)
+	assert.Contains(t, srv.data, "Subject: Monthly digest")
+	assert.Contains(t, srv.data, "multipart/alternative")
+	assert.Contains(t, srv.data, "plain body")
+	assert.Contains(t, srv.data, "<p>html body</p>")
+}
+
+func TestClient_SendWithoutRecipients(t *testing.T) {
+	client := NewMailClient(Config{Host: "127.0.0.1", Port: 1})
+	err := client.Send(context.Background(), Message{Subject: "dummy"})
+	assert.Error(t, err)
+}
+
+func TestNewMailClient(t *testing.T) {
+	client := NewMailClient(Config{Host: "localhost", Port: 1025})
+	assert.NotNil(t, client)
+	assert.Equal(t, "localhost:"+strconv.Itoa(1025), client.address())
+}
@@ -0,0 +1,8 @@
+package notify
+
+import "github.com/joomcode/errorx"
+
+var (
+	NotifyError = errorx.NewNamespace("notify")
+	HttpError   = NotifyError.NewType("http_error")
+)
@@ -0,0 +1,133 @@
+// Package notify delivers operational warnings, such as expiring credentials, to the people running the service.
+package notify
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"html"
+	"net/http"
+
+	"go.dfds.cloud/aad-finout-sync/internal/mail"
+	"go.dfds.cloud/aad-finout-sync/internal/util"
+	"go.uber.org/zap"
+)
+
+const (
+	SeverityInfo    = "info"
+	SeverityWarning = "warning"
+	SeverityError   = "error"
+)
+
+type Notification struct {
+	Severity string `json:"severity"`
+	Subject  string `json:"subject"`
+	Text     string `json:"text"`
+}
+
+type Notifier interface {
+	Notify(ctx context.Context, n Notification) error
+}
+
+type Config struct {
+	WebhookUrl string   `json:"webhookUrl"` // receives each notification as a JSON POST
+	Recipients []string `json:"recipients"` // receive each notification as a mail
+	Mail       mail.Config
+}
+
+// NewNotifier returns a notifier that logs every notification, and delivers it to the webhook and mail recipients if configured.
+func NewNotifier(conf Config) Notifier {
+	notifiers := Multi{&LogNotifier{}}
+	if conf.WebhookUrl != "" {
+		notifiers = append(notifiers, &WebhookNotifier{url: conf.WebhookUrl, httpClient: http.DefaultClient})
+	}
+	if len(conf.Recipients) > 0 {
+		notifiers = append(notifiers, &MailNotifier{client: mail.NewMailClient(conf.Mail), recipients: conf.Recipients})
+	}
+
+	return notifiers
+}
+
+// Multi delivers a notification to every notifier, also when some of them fail.
+type Multi []Notifier
+
+func (m Multi) Notify(ctx context.Context, n Notification) error {
+	var errs []error
+	for _, notifier := range m {
+		err := notifier.Notify(ctx, n)
+		if err != nil {
+			errs = append(errs, err)
+		}
+	}
+
+	return errors.Join(errs...)
+}
+
+type LogNotifier struct{}
+
+func (l *LogNotifier) Notify(ctx context.Context, n Notification) error {
+	fields := []zap.Field{zap.String("notification", n.Subject), zap.String("severity", n.Severity)}
+	switch n.Severity {
+	case SeverityError:
+		util.Logger.Error(n.Text, fields...)
+	case SeverityWarning:
+		util.Logger.Warn(n.Text, fields...)
+	default:
+		util.Logger.Info(n.Text, fields...)
+	}
+
+	return nil
+}
+
+// WebhookNotifier posts notifications as JSON. The subject is repeated in the text field, which makes the payload usable with Slack and Teams incoming webhooks.
+type WebhookNotifier struct {
+	url        string
+	httpClient *http.Client
+}
+
+func NewWebhookNotifier(url string) *WebhookNotifier {
+	return &WebhookNotifier{url: url, httpClient: http.DefaultClient}
+}
+
+func (w *WebhookNotifier) Notify(ctx context.Context, n Notification) error {
+	payload := n
+	payload.Text = fmt.Sprintf("%s\n%s", n.Subject, n.Text)
+	data, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, w.url, bytes.NewBuffer(data))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := w.httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return HttpError.New(fmt.Sprintf("webhook responded with %d", resp.StatusCode))
+	}
+
+	return nil
+}
+
+type MailNotifier struct {
+	client     *mail.Client
+	recipients []string
+}
+
+func (m *MailNotifier) Notify(ctx context.Context, n Notification) error {
+	return m.client.Send(ctx, mail.Message{
+		To:      m.recipients,
+		Subject: fmt.Sprintf("[aad-finout-sync] %s", n.Subject),
+		Text:    n.Text,
+		Html:    fmt.Sprintf("<pre>%s</pre>", html.EscapeString(n.Text)),
+	})
+}
@@ -0,0 +1,60 @@
+package notify
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/joomcode/errorx"
+	"github.com/stretchr/testify/assert"
+	"go.dfds.cloud/aad-finout-sync/internal/util"
+)
+
+func TestWebhookNotifier(t *testing.T) {
+	var received Notification
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, http.MethodPost, r.Method)
+		assert.Equal(t, "application/json", r.Header.Get("Content-Type"))
+		assert.NoError(t, json.NewDecoder(r.Body).Decode(&received))
+	}))
+	defer server.Close()
+
+	err := NewWebhookNotifier(server.URL).Notify(context.Background(), Notification{Severity: SeverityWarning, Subject: "Secret expires", Text: "in 7 days"})
+	assert.NoError(t, err)
+	assert.Equal(t, SeverityWarning, received.Severity)
+	assert.Equal(t, "Secret expires", received.Subject)
+	assert.Equal(t, "Secret expires\nin 7 days", received.Text)
+}
+
+func TestWebhookNotifier_Error(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusBadGateway)
+	}))
+	defer server.Close()
+
+	err := NewWebhookNotifier(server.URL).Notify(context.Background(), Notification{Subject: "test"})
+	assert.True(t, errorx.IsOfType(err, HttpError))
+}
+
+type failingNotifier struct {
+	calls int
+}
+
+func (f *failingNotifier) Notify(ctx context.Context, n Notification) error {
+	f.calls = f.calls + 1
+	return errors.New("unavailable")
+}
+
+func TestMulti(t *testing.T) {
+	util.InitializeLogger()
+
+	first := &failingNotifier{}
+	second := &failingNotifier{}
+	err := Multi{first, &LogNotifier{}, second}.Notify(context.Background(), Notification{Severity: SeverityError, Subject: "test"})
+	assert.Error(t, err)
+	assert.Equal(t, 1, first.calls)
+	assert.Equal(t, 1, second.calls)
+}
@@ -1,14 +1,15 @@
 package ssu
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
 	"io"
 	"net/http"
 	"net/url"
-	"strconv"
 	"strings"
 
+	"github.com/joomcode/errorx"
 	"go.dfds.cloud/aad-finout-sync/internal/util"
 	"k8s.io/utils/env"
 )
@@ -25,6 +26,70 @@ type Config struct {
 	ClientId     string `json:"clientId"`
 	ClientSecret string `json:"clientSecret"`
 	Scope        string `json:"scope"`
+	// LoginEndpoint is the Microsoft identity platform endpoint tokens are requested from, defaults to https://login.microsoftonline.com
+	LoginEndpoint string `json:"loginEndpoint"`
+	// AuthMethod is one of util.ClientAuthSecret (default), util.ClientAuthCertificate or util.ClientAuthFederated.
+	AuthMethod         string `json:"authMethod"`
+	CertificatePath    string `json:"certificatePath"`
+	PrivateKeyPath     string `json:"privateKeyPath"`
+	FederatedTokenFile string `json:"federatedTokenFile"`
+	// Paths is the layout of the capability service API, defaults to LegacyPaths.
+	Paths Paths `json:"paths"`
+}
+
+// Paths is the layout of the capability service API. {id} is replaced with the capability id.
+type Paths struct {
+	Capabilities string `json:"capabilities"`
+	Members      string `json:"members"`    // if empty, members are expected to be included in the capabilities response
+	AwsAccount   string `json:"awsAccount"` // if empty, contexts are expected to be included in the capabilities response
+	Metadata     string `json:"metadata"`
+}
+
+const (
+	PathLayoutLegacy = "legacy"
+	PathLayoutRest   = "rest"
+)
+
+// LegacyPaths is the layout of the endpoint made for aad-aws-sync, which returns capabilities including their members and contexts.
+var LegacyPaths = Paths{
+	Capabilities: "/system/legacy/aad-aws-sync",
+	Metadata:     "/capabilities/{id}/metadata",
+}
+
+// RestPaths is the layout of the current REST API of the capability service.
+var RestPaths = Paths{
+	Capabilities: "/capabilities",
+	Members:      "/capabilities/{id}/members",
+	AwsAccount:   "/capabilities/{id}/awsaccount",
+	Metadata:     "/capabilities/{id}/metadata",
+}
+
+// PathsForLayout returns the paths of a known layout, with the paths set in overrides taking precedence.
+func PathsForLayout(layout string, overrides Paths) (Paths, error) {
+	var paths Paths
+	switch strings.ToLower(layout) {
+	case "", PathLayoutLegacy:
+		paths = LegacyPaths
+	case PathLayoutRest:
+		paths = RestPaths
+	default:
+		return Paths{}, fmt.Errorf("unknown capability service path layout %s", layout)
+	}
+
+	if overrides.Capabilities != "" {
+		paths.Capabilities = overrides.Capabilities
+	}
+	if overrides.Members != "" {
+		paths.Members = overrides.Members
+	}
+	if overrides.AwsAccount != "" {
+		paths.AwsAccount = overrides.AwsAccount
+	}
+	if overrides.Metadata != "" {
+		paths.Metadata = overrides.Metadata
+	}
+
+	return paths, nil
 }
 
 func (c *Client) prepareHttpRequest(h *http.Request) error {
@@ -33,40 +98,84 @@ func (c *Client) prepareHttpRequest(h *http.Request) error {
 		return err
 	}
 
-	h.Header.Set("Authorization", fmt.Sprintf("Bearer %s", c.tokenClient.Token.GetToken()))
+	h.Header.Set("Authorization", fmt.Sprintf("Bearer %s", c.tokenClient.GetToken()))
 	h.Header.Set("User-Agent", "aad-finout-sync - github.com/dfds/aad-finout-sync")
 
 	return nil
 }
 
-func (c *Client) GetCapabilities() ([]*GetCapabilitiesResponseContextCapability, error) {
-	req, err := http.NewRequest("GET", fmt.Sprintf("%s/system/legacy/aad-aws-sync", c.config.Host), nil)
+// GetCapabilities returns all capabilities with their members and contexts. Members and AWS accounts are requested per capability
+// if the path layout has separate endpoints for them.
+func (c *Client) GetCapabilities(ctx context.Context) ([]*GetCapabilitiesResponseContextCapability, error) {
+	rawData, err := c.get(ctx, c.config.Paths.Capabilities, "")
 	if err != nil {
 		return nil, err
 	}
-	err = c.prepareHttpRequest(req)
+
+	payload, err := decodeList[*GetCapabilitiesResponseContextCapability](rawData)
 	if err != nil {
 		return nil, err
 	}
 
-	resp, err := c.httpClient.Do(req)
+	for _, capability := range payload {
+		// The capability id doubles as root id in the current API.
+		if capability.RootID == "" {
+			capability.RootID = capability.ID
+		}
+
+		if c.config.Paths.Members != "" {
+			capability.Members, err = c.GetCapabilityMembers(ctx, capability.ID)
+			if err != nil {
+				return nil, err
+			}
+		}
+
+		if c.config.Paths.AwsAccount != "" {
+			account, err := c.GetCapabilityAwsAccount(ctx, capability.ID)
+			if err != nil && !errorx.IsOfType(err, NotFound) {
+				return nil, err
+			}
+			if account != nil {
+				capability.Contexts = []*GetCapabilitiesResponseContext{{ID: account.ID, AwsAccountID: account.AwsAccountID}}
+			}
+		}
+	}
+
+	return payload, nil
+}
+
+// GetCapabilityMembers returns the members of a capability. Members are identified by email, or by id where the email isn't included.
+func (c *Client) GetCapabilityMembers(ctx context.Context, id string) ([]*GetCapabilitiesResponseContextCapabilityMember, error) {
+	rawData, err := c.get(ctx, c.config.Paths.Members, id)
 	if err != nil {
 		return nil, err
 	}
 
-	defer resp.Body.Close()
+	members, err := decodeList[GetCapabilityMembersResponseMember](rawData)
+	if err != nil {
+		return nil, err
+	}
 
-	if resp.StatusCode != 200 {
-		return nil, fmt.Errorf("response returned unexpected status code: %d", resp.StatusCode)
+	payload := make([]*GetCapabilitiesResponseContextCapabilityMember, 0, len(members))
+	for _, member := range members {
+		email := member.Email
+		if email == "" {
+			email = member.ID
+		}
+		payload = append(payload, &GetCapabilitiesResponseContextCapabilityMember{Email: email, Role: member.Role})
 	}
 
-	rawData, err := io.ReadAll(resp.Body)
+	return payload, nil
+}
+
+// GetCapabilityAwsAccount returns the AWS account of a capability. NotFound is returned if the capability has no AWS account.
+func (c *Client) GetCapabilityAwsAccount(ctx context.Context, id string) (*GetCapabilityAwsAccountResponse, error) {
+	rawData, err := c.get(ctx, c.config.Paths.AwsAccount, id)
 	if err != nil {
 		return nil, err
 	}
 
-	var payload []*GetCapabilitiesResponseContextCapability
-
+	var payload *GetCapabilityAwsAccountResponse
 	err = json.Unmarshal(rawData, &payload)
 	if err != nil {
 		return nil, err
@@ -75,46 +184,86 @@ func (c *Client) GetCapabilities() ([]*GetCapabilitiesResponseContextCapability,
 	return payload, nil
 }
 
-func (c *Client) GetCapabilityMetadata(id string) (map[string]interface{}, error) {
-	req, err := http.NewRequest("GET", fmt.Sprintf("%s/capabilities/%s/metadata", c.config.Host, id), nil)
+// GetCapabilityMetadata returns the metadata of a capability. The capability service has returned the metadata object both as is
+// and encoded as a JSON string, both are accepted.
+func (c *Client) GetCapabilityMetadata(ctx context.Context, id string) (map[string]interface{}, error) {
+	rawData, err := c.get(ctx, c.config.Paths.Metadata, id)
 	if err != nil {
 		return nil, err
 	}
 
-	err = c.prepareHttpRequest(req)
+	var encoded string
+	if json.Unmarshal(rawData, &encoded) == nil {
+		rawData = []byte(encoded)
+	}
+
+	var payload map[string]interface{}
+
+	err = json.Unmarshal(rawData, &payload)
 	if err != nil {
 		return nil, err
 	}
 
-	resp, err := c.httpClient.Do(req)
+	return payload, nil
+}
+
+// get requests path, with {id} replaced by id, and returns the response body. Non-2xx responses are returned as errors wrapping ApiError.
+func (c *Client) get(ctx context.Context, path string, id string) ([]byte, error) {
+	path = strings.ReplaceAll(path, "{id}", url.PathEscape(id))
+	req, err := http.NewRequestWithContext(ctx, "GET", fmt.Sprintf("%s%s", strings.TrimSuffix(c.config.Host, "/"), path), nil)
 	if err != nil {
 		return nil, err
 	}
-
-	buf, err := io.ReadAll(resp.Body)
+	err = c.prepareHttpRequest(req)
 	if err != nil {
 		return nil, err
 	}
 
-	preDeserialise, err := strconv.Unquote(string(buf))
+	resp, err := c.httpClient.Do(req)
 	if err != nil {
 		return nil, err
 	}
 
-	var payload map[string]interface{}
+	defer resp.Body.Close()
 
-	err = json.Unmarshal([]byte(preDeserialise), &payload)
+	rawData, err := io.ReadAll(resp.Body)
 	if err != nil {
 		return nil, err
 	}
 
-	return payload, nil
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		apiErr := ApiError{StatusCode: resp.StatusCode, Body: strings.TrimSpace(string(rawData))}
+		if resp.StatusCode == http.StatusNotFound {
+			return nil, NotFound.Wrap(apiErr, fmt.Sprintf("GET %s returned status code %d", path, resp.StatusCode))
+		}
+		return nil, HttpError.Wrap(apiErr, fmt.Sprintf("GET %s returned status code %d", path, resp.StatusCode))
+	}
+
+	return rawData, nil
+}
+
+// decodeList accepts both a plain JSON array and an object with the array in items, as the legacy and current endpoints differ.
+func decodeList[T any](rawData []byte) ([]T, error) {
+	var payload []T
+	err := json.Unmarshal(rawData, &payload)
+	if err == nil {
+		return payload, nil
+	}
+
+	var wrapped struct {
+		Items []T `json:"items"`
+	}
+	if json.Unmarshal(rawData, &wrapped) == nil {
+		return wrapped.Items, nil
+	}
+
+	return nil, err
 }
 
 func (c *Client) RefreshAuth() error {
 	envToken := env.GetString("AAS_CAPSVC_TOKEN", "")
 	if envToken != "" {
-		c.tokenClient.Token = util.NewBearerToken(envToken)
+		c.tokenClient.SetToken(util.NewBearerToken(envToken))
 		return nil
 	}
 
@@ -123,13 +272,28 @@ func (c *Client) RefreshAuth() error {
 }
 
 func (c *Client) getNewToken() (*util.RefreshAuthResponse, error) {
+	loginEndpoint := "https://login.microsoftonline.com"
+	if c.config.LoginEndpoint != "" {
+		loginEndpoint = strings.TrimSuffix(c.config.LoginEndpoint, "/")
+	}
+	tokenEndpoint := fmt.Sprintf("%s/%s/oauth2/v2.0/token", loginEndpoint, c.config.TenantId)
+
 	reqPayload := url.Values{}
-	reqPayload.Set("client_id", c.config.ClientId)
 	reqPayload.Set("grant_type", "client_credentials")
 	reqPayload.Set("scope", c.config.Scope)
-	reqPayload.Set("client_secret", c.config.ClientSecret)
+	err := util.ClientCredentials{
+		Method:             c.config.AuthMethod,
+		ClientId:           c.config.ClientId,
+		ClientSecret:       c.config.ClientSecret,
+		CertificatePath:    c.config.CertificatePath,
+		PrivateKeyPath:     c.config.PrivateKeyPath,
+		FederatedTokenFile: c.config.FederatedTokenFile,
+	}.SetFormValues(reqPayload, tokenEndpoint)
+	if err != nil {
+		return nil, err
+	}
 
-	req, err := http.NewRequest("POST", fmt.Sprintf("https://login.microsoftonline.com/%s/oauth2/v2.0/token", c.config.TenantId), strings.NewReader(reqPayload.Encode()))
+	req, err := http.NewRequest("POST", tokenEndpoint, strings.NewReader(reqPayload.Encode()))
 	if err != nil {
 		return nil, err
 	}
@@ -163,6 +327,9 @@ func (c *Client) getNewToken() (*util.RefreshAuthResponse, error) {
 }
 
 func NewSsuClient(conf Config) *Client {
+	if conf.Paths == (Paths{}) {
+		conf.Paths = LegacyPaths
+	}
 	payload := &Client{
 		httpClient: http.DefaultClient,
 		config:     conf,
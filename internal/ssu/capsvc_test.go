@@ -1,10 +1,13 @@
 package ssu
 
 import (
+	"context"
 	"net/http"
+	"net/http/httptest"
 	"testing"
 	"time"
 
+	"github.com/joomcode/errorx"
 	"github.com/stretchr/testify/assert"
 	"go.dfds.cloud/aad-finout-sync/internal/util"
 )
@@ -42,3 +45,109 @@ func TestNewCapSvcClient(t *testing.T) {
 	capsvc := NewSsuClient(capsvcTestConfig)
 	assert.NotNil(t, capsvc)
 }
+
+func newTestClient(server *httptest.Server, paths Paths) *Client {
+	conf := capsvcTestConfig
+	conf.Host = server.URL
+	conf.Paths = paths
+	capsvc := NewSsuClient(conf)
+	capsvc.tokenClient = util.NewTokenClient(func() (*util.RefreshAuthResponse, error) {
+		return &util.RefreshAuthResponse{ExpiresIn: 3600, ExtExpiresIn: 3600, AccessToken: "dummy"}, nil
+	})
+	return capsvc
+}
+
+func TestClient_GetCapabilities_Legacy(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "/system/legacy/aad-aws-sync", r.URL.Path)
+		w.Write([]byte(`[{"id": "cap-a-xyz", "rootId": "cap-a", "members": [{"email": "alice@example.com"}], "contexts": [{"id": "ctx", "awsAccountId": "123456789012"}]}]`))
+	}))
+	defer server.Close()
+
+	caps, err := newTestClient(server, Paths{}).GetCapabilities(context.Background())
+	assert.NoError(t, err)
+	if assert.Len(t, caps, 1) {
+		assert.Equal(t, "cap-a", caps[0].RootID)
+		assert.True(t, caps[0].HasMember("alice@example.com"))
+		assert.Equal(t, "123456789012", caps[0].Contexts[0].AwsAccountID)
+	}
+}
+
+func TestClient_GetCapabilities_Rest(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/capabilities":
+			w.Write([]byte(`{"items": [{"id": "cap-a"}, {"id": "cap-b"}]}`))
+		case "/capabilities/cap-a/members":
+			w.Write([]byte(`{"items": [{"id": "alice@example.com", "name": "Alice"}, {"id": "bob", "email": "bob@example.com"}]}`))
+		case "/capabilities/cap-b/members":
+			w.Write([]byte(`[]`))
+		case "/capabilities/cap-a/awsaccount":
+			w.Write([]byte(`{"id": "account-a", "awsAccountId": "123456789012", "status": "Completed"}`))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer server.Close()
+
+	caps, err := newTestClient(server, RestPaths).GetCapabilities(context.Background())
+	assert.NoError(t, err)
+	if assert.Len(t, caps, 2) {
+		assert.Equal(t, "cap-a", caps[0].RootID)
+		assert.Equal(t, []*GetCapabilitiesResponseContextCapabilityMember{{Email: "alice@example.com"}, {Email: "bob@example.com"}}, caps[0].Members)
+		capContext, err := caps[0].GetContext()
+		assert.NoError(t, err)
+		assert.Equal(t, "123456789012", capContext.AwsAccountID)
+
+		assert.Empty(t, caps[1].Members)
+		assert.Empty(t, caps[1].Contexts)
+	}
+}
+
+func TestClient_GetCapabilityMetadata(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/capabilities/double/metadata":
+			w.Write([]byte(`"{\"dfds.cost.centre\":\"ti-arch\"}"`))
+		case "/capabilities/single/metadata":
+			w.Write([]byte(`{"dfds.cost.centre": "ti-arch"}`))
+		case "/capabilities/broken/metadata":
+			w.WriteHeader(http.StatusInternalServerError)
+			w.Write([]byte("oops"))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer server.Close()
+	capsvc := newTestClient(server, Paths{})
+
+	for _, id := range []string{"double", "single"} {
+		metadata, err := capsvc.GetCapabilityMetadata(context.Background(), id)
+		assert.NoError(t, err)
+		assert.Equal(t, map[string]interface{}{"dfds.cost.centre": "ti-arch"}, metadata)
+	}
+
+	_, err := capsvc.GetCapabilityMetadata(context.Background(), "missing")
+	assert.True(t, errorx.IsOfType(err, NotFound))
+
+	_, err = capsvc.GetCapabilityMetadata(context.Background(), "broken")
+	assert.True(t, errorx.IsOfType(err, HttpError))
+	if apiErr, ok := AsApiError(err); assert.True(t, ok) {
+		assert.Equal(t, http.StatusInternalServerError, apiErr.StatusCode)
+		assert.Equal(t, "oops", apiErr.Body)
+	}
+}
+
+func TestPathsForLayout(t *testing.T) {
+	paths, err := PathsForLayout("", Paths{})
+	assert.NoError(t, err)
+	assert.Equal(t, LegacyPaths, paths)
+
+	paths, err = PathsForLayout("rest", Paths{Metadata: "/v2/capabilities/{id}/metadata"})
+	assert.NoError(t, err)
+	assert.Equal(t, "/capabilities/{id}/members", paths.Members)
+	assert.Equal(t, "/v2/capabilities/{id}/metadata", paths.Metadata)
+
+	_, err = PathsForLayout("graphql", Paths{})
+	assert.Error(t, err)
+}
@@ -0,0 +1,37 @@
+package ssu
+
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/joomcode/errorx"
+)
+
+// ApiError is the non-2xx response of a capability service request.
+type ApiError struct {
+	StatusCode int
+	Body       string
+}
+
+func (e ApiError) Error() string {
+	if e.Body == "" {
+		return http.StatusText(e.StatusCode)
+	}
+	return fmt.Sprintf("%s: %s", http.StatusText(e.StatusCode), e.Body)
+}
+
+var (
+	SsuError  = errorx.NewNamespace("ssu")
+	HttpError = SsuError.NewType("http_error")
+	NotFound  = SsuError.NewType("not_found")
+)
+
+// AsApiError returns the response of a failed request, if err was returned for a non-2xx response.
+func AsApiError(err error) (ApiError, bool) {
+	if e := errorx.Cast(err); e != nil {
+		apiErr, ok := e.Cause().(ApiError)
+		return apiErr, ok
+	}
+
+	return ApiError{}, false
+}
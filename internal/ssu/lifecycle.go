@@ -0,0 +1,52 @@
+package ssu
+
+import "strings"
+
+const (
+	CapabilityStatusActive          = "Active"
+	CapabilityStatusPendingDeletion = "Pending Deletion"
+	CapabilityStatusDeleted         = "Deleted"
+	// CapabilityStatusUnknown is used for statuses this version doesn't know about.
+	CapabilityStatusUnknown = "Unknown"
+)
+
+// LifecyclePolicy decides what the jobs do for a capability in a given lifecycle status.
+type LifecyclePolicy struct {
+	// AllowNewResources allows creating groups, inviting guests, adding group members and owners, and assigning groups to applications.
+	AllowNewResources bool
+	// KeepExistingAccess keeps existing groups, members and application assignments. If unset, they are retired like those of capabilities that no longer exist.
+	KeepExistingAccess bool
+	// IncludeInCostRules includes the capability in the Finout cost centre rules and the cost reports.
+	IncludeInCostRules bool
+}
+
+// CapabilityLifecyclePolicies is the policy shared by all jobs, keyed by capability status.
+// Capabilities pending deletion keep what they have and still carry cost until they are deleted, but get nothing new.
+var CapabilityLifecyclePolicies = map[string]LifecyclePolicy{
+	CapabilityStatusActive:          {AllowNewResources: true, KeepExistingAccess: true, IncludeInCostRules: true},
+	CapabilityStatusPendingDeletion: {AllowNewResources: false, KeepExistingAccess: true, IncludeInCostRules: true},
+	CapabilityStatusDeleted:         {AllowNewResources: false, KeepExistingAccess: false, IncludeInCostRules: false},
+	// Unknown statuses are treated like pending deletion, so a new status never grants or removes access by accident.
+	CapabilityStatusUnknown: {AllowNewResources: false, KeepExistingAccess: true, IncludeInCostRules: true},
+}
+
+// LifecycleStatus returns the status of the capability as one of the CapabilityStatus constants. Capabilities without a status, as returned by
+// capability service versions that don't expose it, are active. The status is compared ignoring case, spaces, dashes and underscores.
+func (g *GetCapabilitiesResponseContextCapability) LifecycleStatus() string {
+	status := strings.NewReplacer(" ", "", "-", "", "_", "").Replace(strings.ToLower(g.Status))
+	switch status {
+	case "", "active":
+		return CapabilityStatusActive
+	case "pendingdeletion":
+		return CapabilityStatusPendingDeletion
+	case "deleted":
+		return CapabilityStatusDeleted
+	default:
+		return CapabilityStatusUnknown
+	}
+}
+
+// Lifecycle returns the policy for the capability's lifecycle status.
+func (g *GetCapabilitiesResponseContextCapability) Lifecycle() LifecyclePolicy {
+	return CapabilityLifecyclePolicies[g.LifecycleStatus()]
+}
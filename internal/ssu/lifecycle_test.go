@@ -0,0 +1,39 @@
+package ssu
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestGetCapabilitiesResponseContextCapability_LifecycleStatus(t *testing.T) {
+	for status, expected := range map[string]string{
+		"":                 CapabilityStatusActive,
+		"Active":           CapabilityStatusActive,
+		"Pending Deletion": CapabilityStatusPendingDeletion,
+		"PendingDeletion":  CapabilityStatusPendingDeletion,
+		"pending_deletion": CapabilityStatusPendingDeletion,
+		"DELETED":          CapabilityStatusDeleted,
+		"Suspended":        CapabilityStatusUnknown,
+	} {
+		capability := &GetCapabilitiesResponseContextCapability{Status: status}
+		assert.Equal(t, expected, capability.LifecycleStatus(), status)
+	}
+}
+
+func TestGetCapabilitiesResponseContextCapability_Lifecycle(t *testing.T) {
+	assert.Equal(t, LifecyclePolicy{AllowNewResources: true, KeepExistingAccess: true, IncludeInCostRules: true}, (&GetCapabilitiesResponseContextCapability{}).Lifecycle())
+
+	pending := (&GetCapabilitiesResponseContextCapability{Status: CapabilityStatusPendingDeletion}).Lifecycle()
+	assert.False(t, pending.AllowNewResources)
+	assert.True(t, pending.KeepExistingAccess)
+	assert.True(t, pending.IncludeInCostRules)
+
+	deleted := (&GetCapabilitiesResponseContextCapability{Status: CapabilityStatusDeleted}).Lifecycle()
+	assert.Equal(t, LifecyclePolicy{}, deleted)
+
+	// Unknown statuses neither grant nor remove access.
+	unknown := (&GetCapabilitiesResponseContextCapability{Status: "Suspended"}).Lifecycle()
+	assert.False(t, unknown.AllowNewResources)
+	assert.True(t, unknown.KeepExistingAccess)
+}
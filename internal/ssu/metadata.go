@@ -0,0 +1,126 @@
+package ssu
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"golang.org/x/sync/semaphore"
+)
+
+const DefaultMetadataConcurrency = 8
+
+// MetadataResult is the outcome of fetching the metadata of one capability.
+type MetadataResult struct {
+	Metadata map[string]interface{}
+	// Err is set if fetching failed. Metadata is still set if an earlier value was available, in which case Stale is set.
+	Err   error
+	Stale bool
+}
+
+// MetadataCache keeps the last fetched metadata per capability. It is safe for concurrent use, so it can be shared between handlers.
+type MetadataCache struct {
+	mu      sync.Mutex
+	entries map[string]metadataCacheEntry
+}
+
+type metadataCacheEntry struct {
+	metadata  map[string]interface{}
+	fetchedAt time.Time
+}
+
+func NewMetadataCache() *MetadataCache {
+	return &MetadataCache{entries: make(map[string]metadataCacheEntry)}
+}
+
+// get returns the cached metadata of a capability and whether it was fetched less than maxAge ago.
+func (m *MetadataCache) get(id string, maxAge time.Duration) (map[string]interface{}, bool, bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	entry, exists := m.entries[id]
+	if !exists {
+		return nil, false, false
+	}
+
+	return entry.metadata, true, time.Since(entry.fetchedAt) < maxAge
+}
+
+func (m *MetadataCache) set(id string, metadata map[string]interface{}) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.entries[id] = metadataCacheEntry{metadata: metadata, fetchedAt: time.Now()}
+}
+
+type MetadataOptions struct {
+	// Concurrency is the maximum amount of requests in flight, defaults to DefaultMetadataConcurrency.
+	Concurrency int
+	// Cache is used if set. Metadata fetched less than MaxAge ago isn't requested again, older metadata is used if requesting it fails.
+	Cache  *MetadataCache
+	MaxAge time.Duration
+}
+
+// GetCapabilitiesMetadata fetches the metadata of the capabilities with the given ids concurrently, keyed by capability id.
+// A failing capability doesn't affect the others, its error is returned in its result. An error is only returned if ctx is done.
+func (c *Client) GetCapabilitiesMetadata(ctx context.Context, ids []string, options MetadataOptions) (map[string]*MetadataResult, error) {
+	concurrency := options.Concurrency
+	if concurrency < 1 {
+		concurrency = DefaultMetadataConcurrency
+	}
+
+	payload := make(map[string]*MetadataResult)
+	payloadMutex := &sync.Mutex{}
+	var waitGroup sync.WaitGroup
+	sem := semaphore.NewWeighted(int64(concurrency))
+
+	// Cached results are kept apart from payload, which the workers write to, and merged once they are done.
+	cached := make(map[string]*MetadataResult)
+	for _, id := range ids {
+		if options.Cache != nil {
+			if metadata, _, fresh := options.Cache.get(id, options.MaxAge); fresh {
+				cached[id] = &MetadataResult{Metadata: metadata}
+				continue
+			}
+		}
+
+		err := sem.Acquire(ctx, 1)
+		if err != nil {
+			waitGroup.Wait()
+			return nil, err
+		}
+
+		waitGroup.Add(1)
+		go func(id string) {
+			defer waitGroup.Done()
+			defer sem.Release(1)
+
+			result := &MetadataResult{}
+			result.Metadata, result.Err = c.GetCapabilityMetadata(ctx, id)
+			if options.Cache != nil {
+				if result.Err == nil {
+					options.Cache.set(id, result.Metadata)
+				} else if metadata, exists, _ := options.Cache.get(id, options.MaxAge); exists {
+					result.Metadata = metadata
+					result.Stale = true
+				}
+			}
+
+			payloadMutex.Lock()
+			payload[id] = result
+			payloadMutex.Unlock()
+		}(id)
+	}
+
+	waitGroup.Wait()
+
+	if ctx.Err() != nil {
+		return nil, ctx.Err()
+	}
+
+	for id, result := range cached {
+		payload[id] = result
+	}
+
+	return payload, nil
+}
@@ -0,0 +1,110 @@
+package ssu
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestClient_GetCapabilitiesMetadata(t *testing.T) {
+	var inFlight, maxInFlight int32
+	var requests sync.Map
+	failing := atomic.Bool{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		current := atomic.AddInt32(&inFlight, 1)
+		defer atomic.AddInt32(&inFlight, -1)
+		for {
+			seen := atomic.LoadInt32(&maxInFlight)
+			if current <= seen || atomic.CompareAndSwapInt32(&maxInFlight, seen, current) {
+				break
+			}
+		}
+		time.Sleep(10 * time.Millisecond)
+
+		count, _ := requests.LoadOrStore(r.URL.Path, new(int32))
+		atomic.AddInt32(count.(*int32), 1)
+
+		if r.URL.Path == "/capabilities/broken/metadata" || failing.Load() {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		w.Write([]byte(`{"dfds.cost.centre": "ti-arch"}`))
+	}))
+	defer server.Close()
+	capsvc := newTestClient(server, Paths{})
+
+	ids := []string{"a", "b", "c", "d", "e", "broken"}
+	cache := NewMetadataCache()
+
+	results, err := capsvc.GetCapabilitiesMetadata(context.Background(), ids, MetadataOptions{Concurrency: 2, Cache: cache, MaxAge: time.Minute})
+	assert.NoError(t, err)
+	assert.LessOrEqual(t, atomic.LoadInt32(&maxInFlight), int32(2))
+	assert.Len(t, results, len(ids))
+	for _, id := range ids[:5] {
+		assert.NoError(t, results[id].Err)
+		assert.Equal(t, "ti-arch", results[id].Metadata["dfds.cost.centre"])
+	}
+	assert.Error(t, results["broken"].Err)
+	assert.Nil(t, results["broken"].Metadata)
+	assert.False(t, results["broken"].Stale)
+
+	// Fresh cache entries aren't requested again
+	_, err = capsvc.GetCapabilitiesMetadata(context.Background(), []string{"a"}, MetadataOptions{Cache: cache, MaxAge: time.Minute})
+	assert.NoError(t, err)
+	count, _ := requests.Load("/capabilities/a/metadata")
+	assert.Equal(t, int32(1), atomic.LoadInt32(count.(*int32)))
+
+	// Expired cache entries are requested again, and used if the request fails
+	failing.Store(true)
+	results, err = capsvc.GetCapabilitiesMetadata(context.Background(), []string{"a"}, MetadataOptions{Cache: cache, MaxAge: 0})
+	assert.NoError(t, err)
+	assert.Equal(t, int32(2), atomic.LoadInt32(count.(*int32)))
+	assert.Error(t, results["a"].Err)
+	assert.True(t, results["a"].Stale)
+	assert.Equal(t, "ti-arch", results["a"].Metadata["dfds.cost.centre"])
+}
+
+func TestClient_GetCapabilitiesMetadata_MixedCache(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"dfds.cost.centre": "ti-arch"}`))
+	}))
+	defer server.Close()
+	capsvc := newTestClient(server, Paths{})
+
+	// Every other id is cached, so cached results are collected while workers store theirs. Run with -race.
+	cache := NewMetadataCache()
+	var ids []string
+	for i := 0; i < 50; i++ {
+		id := fmt.Sprintf("cap-%d", i)
+		ids = append(ids, id)
+		if i%2 == 0 {
+			cache.set(id, map[string]interface{}{"dfds.cost.centre": "cached"})
+		}
+	}
+
+	results, err := capsvc.GetCapabilitiesMetadata(context.Background(), ids, MetadataOptions{Concurrency: 4, Cache: cache, MaxAge: time.Minute})
+	assert.NoError(t, err)
+	assert.Len(t, results, len(ids))
+	assert.Equal(t, "cached", results["cap-0"].Metadata["dfds.cost.centre"])
+	assert.Equal(t, "ti-arch", results["cap-1"].Metadata["dfds.cost.centre"])
+}
+
+func TestClient_GetCapabilitiesMetadata_Cancelled(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{}`))
+	}))
+	defer server.Close()
+	capsvc := newTestClient(server, Paths{})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	_, err := capsvc.GetCapabilitiesMetadata(ctx, []string{"a", "b"}, MetadataOptions{Concurrency: 1})
+	assert.ErrorIs(t, err, context.Canceled)
+}
@@ -0,0 +1,187 @@
+package ssu
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+const (
+	MetadataKeyCostCentre          = "dfds.cost.centre"
+	MetadataKeyServiceCriticality  = "dfds.service.criticality"
+	MetadataKeyServiceAvailability = "dfds.service.availability"
+	MetadataKeyDataClassification  = "dfds.data.classification"
+	MetadataKeyPlannedSunset       = "dfds.planned_sunset"
+)
+
+type MetadataValueType string
+
+const (
+	MetadataTypeString MetadataValueType = "string"
+	MetadataTypeDate   MetadataValueType = "date"
+)
+
+// MetadataKey declares a known capability metadata key and how its value is validated.
+type MetadataKey struct {
+	Name          string
+	Type          MetadataValueType
+	Required      bool
+	AllowedValues []string // compared case-insensitively, any value is allowed if empty
+	set           func(m *Metadata, value string, date time.Time)
+}
+
+// KnownMetadataKeys is the registry of metadata keys that are parsed into Metadata. Other keys are kept in Metadata.Unknown.
+var KnownMetadataKeys = []MetadataKey{
+	{
+		Name:     MetadataKeyCostCentre,
+		Type:     MetadataTypeString,
+		Required: true,
+		set:      func(m *Metadata, value string, _ time.Time) { m.CostCentre = value },
+	},
+	{
+		Name:          MetadataKeyServiceCriticality,
+		Type:          MetadataTypeString,
+		AllowedValues: []string{"low", "medium", "high"},
+		set:           func(m *Metadata, value string, _ time.Time) { m.ServiceCriticality = value },
+	},
+	{
+		Name:          MetadataKeyServiceAvailability,
+		Type:          MetadataTypeString,
+		AllowedValues: []string{"low", "medium", "high"},
+		set:           func(m *Metadata, value string, _ time.Time) { m.ServiceAvailability = value },
+	},
+	{
+		Name:          MetadataKeyDataClassification,
+		Type:          MetadataTypeString,
+		AllowedValues: []string{"public", "private", "confidential"},
+		set:           func(m *Metadata, value string, _ time.Time) { m.DataClassification = value },
+	},
+	{
+		Name: MetadataKeyPlannedSunset,
+		Type: MetadataTypeDate,
+		set: func(m *Metadata, _ string, date time.Time) {
+			m.PlannedSunset = &date
+		},
+	},
+}
+
+const (
+	MetadataIssueMissing      = "missing"
+	MetadataIssueInvalidType  = "invalidType"
+	MetadataIssueInvalidValue = "invalidValue"
+)
+
+// MetadataIssue is a validation problem with one metadata key of a capability.
+type MetadataIssue struct {
+	Key     string      `json:"key"`
+	Kind    string      `json:"kind"`
+	Value   interface{} `json:"value,omitempty"`
+	Message string      `json:"message"`
+}
+
+func (i MetadataIssue) String() string {
+	return fmt.Sprintf("%s: %s", i.Key, i.Message)
+}
+
+// Metadata is the typed metadata of a capability. Values of known keys that fail validation are left empty and reported in Issues.
+type Metadata struct {
+	CostCentre          string     `json:"costCentre,omitempty"`
+	ServiceCriticality  string     `json:"serviceCriticality,omitempty"`
+	ServiceAvailability string     `json:"serviceAvailability,omitempty"`
+	DataClassification  string     `json:"dataClassification,omitempty"`
+	PlannedSunset       *time.Time `json:"plannedSunset,omitempty"`
+	// Unknown holds the keys that aren't in KnownMetadataKeys, as returned by the capability service.
+	Unknown map[string]interface{} `json:"unknown,omitempty"`
+	Issues  []MetadataIssue        `json:"issues,omitempty"`
+}
+
+// ParseMetadata validates raw capability metadata against KnownMetadataKeys. It never fails, problems are collected in Metadata.Issues.
+func ParseMetadata(raw map[string]interface{}) *Metadata {
+	m := &Metadata{Unknown: make(map[string]interface{})}
+
+	known := make(map[string]bool)
+	for _, key := range KnownMetadataKeys {
+		known[key.Name] = true
+		key.parse(m, raw[key.Name])
+	}
+
+	for name, value := range raw {
+		if !known[name] {
+			m.Unknown[name] = value
+		}
+	}
+
+	return m
+}
+
+func (k MetadataKey) parse(m *Metadata, value interface{}) {
+	if value == nil {
+		if k.Required {
+			m.addIssue(k.Name, MetadataIssueMissing, nil, "required key is missing")
+		}
+		return
+	}
+
+	str, ok := value.(string)
+	if !ok {
+		m.addIssue(k.Name, MetadataIssueInvalidType, value, fmt.Sprintf("expected a %s, got %T", k.Type, value))
+		return
+	}
+
+	str = strings.TrimSpace(str)
+	if str == "" {
+		if k.Required {
+			m.addIssue(k.Name, MetadataIssueMissing, value, "required key is empty")
+		}
+		return
+	}
+
+	if len(k.AllowedValues) > 0 {
+		allowed := false
+		for _, allowedValue := range k.AllowedValues {
+			if strings.EqualFold(str, allowedValue) {
+				str = allowedValue
+				allowed = true
+				break
+			}
+		}
+		if !allowed {
+			m.addIssue(k.Name, MetadataIssueInvalidValue, value, fmt.Sprintf("expected one of %s", strings.Join(k.AllowedValues, ", ")))
+			return
+		}
+	}
+
+	var date time.Time
+	if k.Type == MetadataTypeDate {
+		var err error
+		date, err = parseMetadataDate(str)
+		if err != nil {
+			m.addIssue(k.Name, MetadataIssueInvalidValue, value, "expected a date formatted as YYYY-MM-DD or RFC 3339")
+			return
+		}
+	}
+
+	k.set(m, str, date)
+}
+
+func parseMetadataDate(value string) (time.Time, error) {
+	if date, err := time.Parse(time.DateOnly, value); err == nil {
+		return date, nil
+	}
+	return time.Parse(time.RFC3339, value)
+}
+
+func (m *Metadata) addIssue(key string, kind string, value interface{}, message string) {
+	m.Issues = append(m.Issues, MetadataIssue{Key: key, Kind: kind, Value: value, Message: message})
+}
+
+// HasIssue returns true if validation found a problem with the given key.
+func (m *Metadata) HasIssue(key string) bool {
+	for _, issue := range m.Issues {
+		if issue.Key == key {
+			return true
+		}
+	}
+
+	return false
+}
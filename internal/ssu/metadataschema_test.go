@@ -0,0 +1,87 @@
+package ssu
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseMetadata(t *testing.T) {
+	metadata := ParseMetadata(map[string]interface{}{
+		MetadataKeyCostCentre:          " ti-arch ",
+		MetadataKeyServiceCriticality:  "High",
+		MetadataKeyServiceAvailability: "medium",
+		MetadataKeyDataClassification:  "CONFIDENTIAL",
+		MetadataKeyPlannedSunset:       "2027-01-31",
+		"team.channel":                 "#cloud-engineering",
+	})
+
+	assert.Equal(t, "ti-arch", metadata.CostCentre)
+	assert.Equal(t, "high", metadata.ServiceCriticality)
+	assert.Equal(t, "medium", metadata.ServiceAvailability)
+	assert.Equal(t, "confidential", metadata.DataClassification)
+	if assert.NotNil(t, metadata.PlannedSunset) {
+		assert.Equal(t, time.Date(2027, 1, 31, 0, 0, 0, 0, time.UTC), *metadata.PlannedSunset)
+	}
+	assert.Equal(t, map[string]interface{}{"team.channel": "#cloud-engineering"}, metadata.Unknown)
+	assert.Empty(t, metadata.Issues)
+	assert.False(t, metadata.HasIssue(MetadataKeyCostCentre))
+
+	// Optional keys may be left out, an RFC 3339 timestamp is accepted as a date as well.
+	metadata = ParseMetadata(map[string]interface{}{MetadataKeyCostCentre: "ti-arch", MetadataKeyPlannedSunset: "2027-01-31T12:00:00Z"})
+	assert.Empty(t, metadata.Issues)
+	assert.Empty(t, metadata.ServiceCriticality)
+	if assert.NotNil(t, metadata.PlannedSunset) {
+		assert.Equal(t, time.Date(2027, 1, 31, 12, 0, 0, 0, time.UTC), *metadata.PlannedSunset)
+	}
+}
+
+func TestParseMetadata_Issues(t *testing.T) {
+	tests := []struct {
+		name     string
+		key      string
+		value    interface{}
+		kind     string
+		message  string
+		omitted  bool
+		expected MetadataIssue
+	}{
+		{name: "cost centre missing", key: MetadataKeyCostCentre, omitted: true, kind: MetadataIssueMissing, message: "required key is missing"},
+		{name: "cost centre null", key: MetadataKeyCostCentre, value: nil, kind: MetadataIssueMissing, message: "required key is missing"},
+		{name: "cost centre empty", key: MetadataKeyCostCentre, value: "  ", kind: MetadataIssueMissing, message: "required key is empty"},
+		{name: "cost centre number", key: MetadataKeyCostCentre, value: 42.0, kind: MetadataIssueInvalidType, message: "expected a string, got float64"},
+		{name: "cost centre list", key: MetadataKeyCostCentre, value: []interface{}{"ti-arch"}, kind: MetadataIssueInvalidType, message: "expected a string, got []interface {}"},
+		{name: "criticality type", key: MetadataKeyServiceCriticality, value: true, kind: MetadataIssueInvalidType, message: "expected a string, got bool"},
+		{name: "criticality value", key: MetadataKeyServiceCriticality, value: "critical", kind: MetadataIssueInvalidValue, message: "expected one of low, medium, high"},
+		{name: "availability type", key: MetadataKeyServiceAvailability, value: 99.9, kind: MetadataIssueInvalidType, message: "expected a string, got float64"},
+		{name: "availability value", key: MetadataKeyServiceAvailability, value: "24/7", kind: MetadataIssueInvalidValue, message: "expected one of low, medium, high"},
+		{name: "classification type", key: MetadataKeyDataClassification, value: map[string]interface{}{"level": "public"}, kind: MetadataIssueInvalidType, message: "expected a string, got map[string]interface {}"},
+		{name: "classification value", key: MetadataKeyDataClassification, value: "secret", kind: MetadataIssueInvalidValue, message: "expected one of public, private, confidential"},
+		{name: "sunset type", key: MetadataKeyPlannedSunset, value: 20270131.0, kind: MetadataIssueInvalidType, message: "expected a date, got float64"},
+		{name: "sunset value", key: MetadataKeyPlannedSunset, value: "31/01/2027", kind: MetadataIssueInvalidValue, message: "expected a date formatted as YYYY-MM-DD or RFC 3339"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			raw := map[string]interface{}{MetadataKeyCostCentre: "ti-arch"}
+			delete(raw, test.key)
+			if !test.omitted {
+				raw[test.key] = test.value
+			}
+
+			metadata := ParseMetadata(raw)
+			assert.Equal(t, []MetadataIssue{{Key: test.key, Kind: test.kind, Value: test.value, Message: test.message}}, metadata.Issues)
+			assert.Equal(t, test.key+": "+test.message, metadata.Issues[0].String())
+			assert.True(t, metadata.HasIssue(test.key))
+			assert.Empty(t, metadata.Unknown)
+		})
+	}
+
+	// Invalid values are left empty.
+	metadata := ParseMetadata(map[string]interface{}{MetadataKeyCostCentre: 42.0, MetadataKeyServiceCriticality: "critical", MetadataKeyPlannedSunset: "soon"})
+	assert.Empty(t, metadata.CostCentre)
+	assert.Empty(t, metadata.ServiceCriticality)
+	assert.Nil(t, metadata.PlannedSunset)
+	assert.Len(t, metadata.Issues, 3)
+}
@@ -21,14 +21,38 @@ func (g *GetCapabilitiesResponseContextCapability) GetContext() (*GetCapabilitie
 }
 
 type GetCapabilitiesResponseContextCapability struct {
-	ID          string `json:"id"`
-	Name        string `json:"name"`
-	RootID      string `json:"rootId"`
-	Description string `json:"description"`
-	Members     []struct {
-		Email string `json:"email"`
-	} `json:"members"`
-	Contexts []*GetCapabilitiesResponseContext `json:"contexts,omitempty"`
+	ID          string                                            `json:"id"`
+	Name        string                                            `json:"name"`
+	RootID      string                                            `json:"rootId"`
+	Description string                                            `json:"description"`
+	Status      string                                            `json:"status,omitempty"` // see LifecycleStatus
+	Members     []*GetCapabilitiesResponseContextCapabilityMember `json:"members"`
+	Contexts    []*GetCapabilitiesResponseContext                 `json:"contexts,omitempty"`
+}
+
+const (
+	MemberRoleOwner  = "Owner"
+	MemberRoleMember = "Member"
+)
+
+type GetCapabilitiesResponseContextCapabilityMember struct {
+	Email string `json:"email"`
+	Role  string `json:"role,omitempty"` // only set where the capability service exposes member roles
+}
+
+func (m *GetCapabilitiesResponseContextCapabilityMember) IsOwner() bool {
+	return strings.EqualFold(m.Role, MemberRoleOwner)
+}
+
+// HasMemberRoles returns true if the capability service exposed a role for any of the members. If it didn't, owners are unknown rather than absent.
+func (g *GetCapabilitiesResponseContextCapability) HasMemberRoles() bool {
+	for _, member := range g.Members {
+		if member.Role != "" {
+			return true
+		}
+	}
+
+	return false
 }
 
 func (g *GetCapabilitiesResponseContextCapability) HasMember(email string) bool {
@@ -48,3 +72,16 @@ type GetCapabilitiesResponseContext struct {
 	AwsRoleArn   string `json:"awsRoleArn"`
 	AwsRoleEmail string `json:"awsRoleEmail"`
 }
+
+type GetCapabilityMembersResponseMember struct {
+	ID    string `json:"id"`
+	Name  string `json:"name"`
+	Email string `json:"email"`
+	Role  string `json:"role,omitempty"`
+}
+
+type GetCapabilityAwsAccountResponse struct {
+	ID           string `json:"id"`
+	AwsAccountID string `json:"awsAccountId"`
+	Status       string `json:"status"`
+}
@@ -2,6 +2,7 @@ package util
 
 import (
 	"errors"
+	"sync"
 	"time"
 )
 
@@ -31,9 +32,11 @@ func (b *BearerToken) GetToken() string {
 	return b.token
 }
 
+// TokenClient caches a bearer token. RefreshAuth, SetToken and GetToken are safe for concurrent use.
 type TokenClient struct {
 	Token           *BearerToken
 	refreshAuthFunc func() (*RefreshAuthResponse, error)
+	mu              sync.Mutex
 }
 
 func NewBearerToken(token string) *BearerToken {
@@ -48,6 +51,9 @@ func NewTokenClient(authFunc func() (*RefreshAuthResponse, error)) *TokenClient
 }
 
 func (c *TokenClient) RefreshAuth() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
 	if c.Token != nil {
 		if !c.Token.IsExpired() {
 			//fmt.Println("Token has not expired, reusing token from cache")
@@ -70,3 +76,20 @@ func (c *TokenClient) RefreshAuth() error {
 
 	return nil
 }
+
+func (c *TokenClient) SetToken(token *BearerToken) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.Token = token
+}
+
+func (c *TokenClient) GetToken() string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.Token == nil {
+		return ""
+	}
+	return c.Token.GetToken()
+}
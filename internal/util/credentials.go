@@ -0,0 +1,179 @@
+package util
+
+import (
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+const (
+	ClientAuthSecret      = "secret"
+	ClientAuthCertificate = "certificate"
+	ClientAuthFederated   = "federated"
+)
+
+const clientAssertionType = "urn:ietf:params:oauth:client-assertion-type:jwt-bearer"
+
+// clientAssertionLifetime is how long a client assertion signed with a certificate is valid.
+const clientAssertionLifetime = 10 * time.Minute
+
+// ClientCredentials authenticate an application against the Microsoft identity platform in the client credentials flow.
+// Method selects between a client secret, a JWT signed with a certificate and a federated token, e.g. from AKS or EKS workload identity.
+type ClientCredentials struct {
+	Method       string
+	ClientId     string
+	ClientSecret string
+	// CertificatePath is a PEM file with the certificate registered on the application. It may hold the private key as well.
+	CertificatePath string
+	// PrivateKeyPath is a PEM file with the RSA private key of the certificate, if it isn't in CertificatePath.
+	PrivateKeyPath string
+	// FederatedTokenFile is read on every token request, as the token in it is rotated. Defaults to AZURE_FEDERATED_TOKEN_FILE, which is set by workload identity.
+	FederatedTokenFile string
+}
+
+// SetFormValues adds the client authentication to the form values of a token request sent to tokenEndpoint.
+func (c ClientCredentials) SetFormValues(values url.Values, tokenEndpoint string) error {
+	values.Set("client_id", c.ClientId)
+
+	switch c.Method {
+	case "", ClientAuthSecret:
+		values.Set("client_secret", c.ClientSecret)
+	case ClientAuthCertificate:
+		assertion, err := c.certificateAssertion(tokenEndpoint)
+		if err != nil {
+			return err
+		}
+		values.Set("client_assertion_type", clientAssertionType)
+		values.Set("client_assertion", assertion)
+	case ClientAuthFederated:
+		tokenFile := c.FederatedTokenFile
+		if tokenFile == "" {
+			tokenFile = os.Getenv("AZURE_FEDERATED_TOKEN_FILE")
+		}
+		if tokenFile == "" {
+			return errors.New("no federated token file configured")
+		}
+		token, err := os.ReadFile(tokenFile)
+		if err != nil {
+			return fmt.Errorf("unable to read federated token: %w", err)
+		}
+		values.Set("client_assertion_type", clientAssertionType)
+		values.Set("client_assertion", strings.TrimSpace(string(token)))
+	default:
+		return fmt.Errorf("unknown client authentication method %q", c.Method)
+	}
+
+	return nil
+}
+
+// certificateAssertion returns a JWT for tokenEndpoint signed with the certificate's private key, as described in
+// https://learn.microsoft.com/en-us/entra/identity-platform/certificate-credentials
+func (c ClientCredentials) certificateAssertion(tokenEndpoint string) (string, error) {
+	certificate, key, err := loadCertificate(c.CertificatePath, c.PrivateKeyPath)
+	if err != nil {
+		return "", err
+	}
+
+	thumbprint := sha1.Sum(certificate.Raw)
+	header := map[string]string{
+		"alg": "RS256",
+		"typ": "JWT",
+		"x5t": base64.RawURLEncoding.EncodeToString(thumbprint[:]),
+	}
+	now := time.Now()
+	claims := map[string]interface{}{
+		"aud": tokenEndpoint,
+		"iss": c.ClientId,
+		"sub": c.ClientId,
+		"jti": uuid.NewString(),
+		"nbf": now.Unix(),
+		"iat": now.Unix(),
+		"exp": now.Add(clientAssertionLifetime).Unix(),
+	}
+
+	serialisedHeader, err := json.Marshal(header)
+	if err != nil {
+		return "", err
+	}
+	serialisedClaims, err := json.Marshal(claims)
+	if err != nil {
+		return "", err
+	}
+
+	signingInput := base64.RawURLEncoding.EncodeToString(serialisedHeader) + "." + base64.RawURLEncoding.EncodeToString(serialisedClaims)
+	digest := sha256.Sum256([]byte(signingInput))
+	signature, err := rsa.SignPKCS1v15(rand.Reader, key, crypto.SHA256, digest[:])
+	if err != nil {
+		return "", err
+	}
+
+	return signingInput + "." + base64.RawURLEncoding.EncodeToString(signature), nil
+}
+
+func loadCertificate(certificatePath string, privateKeyPath string) (*x509.Certificate, *rsa.PrivateKey, error) {
+	if certificatePath == "" {
+		return nil, nil, errors.New("no certificate configured")
+	}
+	if privateKeyPath == "" {
+		privateKeyPath = certificatePath
+	}
+
+	data, err := os.ReadFile(certificatePath)
+	if err != nil {
+		return nil, nil, fmt.Errorf("unable to read certificate: %w", err)
+	}
+	var certificate *x509.Certificate
+	for block, rest := pem.Decode(data); block != nil; block, rest = pem.Decode(rest) {
+		if block.Type == "CERTIFICATE" {
+			certificate, err = x509.ParseCertificate(block.Bytes)
+			if err != nil {
+				return nil, nil, fmt.Errorf("unable to parse certificate: %w", err)
+			}
+			break
+		}
+	}
+	if certificate == nil {
+		return nil, nil, fmt.Errorf("no certificate found in %s", certificatePath)
+	}
+
+	data, err = os.ReadFile(privateKeyPath)
+	if err != nil {
+		return nil, nil, fmt.Errorf("unable to read private key: %w", err)
+	}
+	for block, rest := pem.Decode(data); block != nil; block, rest = pem.Decode(rest) {
+		switch block.Type {
+		case "RSA PRIVATE KEY":
+			key, err := x509.ParsePKCS1PrivateKey(block.Bytes)
+			if err != nil {
+				return nil, nil, fmt.Errorf("unable to parse private key: %w", err)
+			}
+			return certificate, key, nil
+		case "PRIVATE KEY":
+			key, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+			if err != nil {
+				return nil, nil, fmt.Errorf("unable to parse private key: %w", err)
+			}
+			rsaKey, ok := key.(*rsa.PrivateKey)
+			if !ok {
+				return nil, nil, errors.New("only RSA private keys are supported")
+			}
+			return certificate, rsaKey, nil
+		}
+	}
+
+	return nil, nil, fmt.Errorf("no private key found in %s", privateKeyPath)
+}
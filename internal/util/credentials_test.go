@@ -0,0 +1,142 @@
+package util
+
+import (
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"math/big"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// writeTestCertificate generates a self-signed certificate and writes it with its private key, PKCS #8 encoded, to keyPath.
+// If keyPath is empty, the key is written to the certificate file.
+func writeTestCertificate(t *testing.T, certPath string, keyPath string) (*x509.Certificate, *rsa.PrivateKey) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	assert.NoError(t, err)
+
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "aad-finout-sync test"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	assert.NoError(t, err)
+	certificate, err := x509.ParseCertificate(der)
+	assert.NoError(t, err)
+
+	pkcs8, err := x509.MarshalPKCS8PrivateKey(key)
+	assert.NoError(t, err)
+
+	certPem := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})
+	keyPem := pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: pkcs8})
+	if keyPath == "" {
+		assert.NoError(t, os.WriteFile(certPath, append(certPem, keyPem...), 0600))
+	} else {
+		assert.NoError(t, os.WriteFile(certPath, certPem, 0600))
+		assert.NoError(t, os.WriteFile(keyPath, keyPem, 0600))
+	}
+
+	return certificate, key
+}
+
+func TestClientCredentials_Secret(t *testing.T) {
+	values := url.Values{}
+	err := ClientCredentials{ClientId: "client", ClientSecret: "secret"}.SetFormValues(values, "https://login/token")
+	assert.NoError(t, err)
+	assert.Equal(t, "client", values.Get("client_id"))
+	assert.Equal(t, "secret", values.Get("client_secret"))
+	assert.Empty(t, values.Get("client_assertion"))
+}
+
+func TestClientCredentials_Certificate(t *testing.T) {
+	dir := t.TempDir()
+	for name, keyPath := range map[string]string{"combined": "", "separate": filepath.Join(dir, "key.pem")} {
+		t.Run(name, func(t *testing.T) {
+			certPath := filepath.Join(dir, name+".pem")
+			certificate, key := writeTestCertificate(t, certPath, keyPath)
+
+			values := url.Values{}
+			err := ClientCredentials{Method: ClientAuthCertificate, ClientId: "client", CertificatePath: certPath, PrivateKeyPath: keyPath}.SetFormValues(values, "https://login/tenant/oauth2/v2.0/token")
+			assert.NoError(t, err)
+			assert.Equal(t, "urn:ietf:params:oauth:client-assertion-type:jwt-bearer", values.Get("client_assertion_type"))
+			assert.Empty(t, values.Get("client_secret"))
+
+			parts := strings.Split(values.Get("client_assertion"), ".")
+			if !assert.Len(t, parts, 3) {
+				return
+			}
+
+			var header map[string]string
+			rawHeader, err := base64.RawURLEncoding.DecodeString(parts[0])
+			assert.NoError(t, err)
+			assert.NoError(t, json.Unmarshal(rawHeader, &header))
+			thumbprint := sha1.Sum(certificate.Raw)
+			assert.Equal(t, "RS256", header["alg"])
+			assert.Equal(t, base64.RawURLEncoding.EncodeToString(thumbprint[:]), header["x5t"])
+
+			var claims map[string]interface{}
+			rawClaims, err := base64.RawURLEncoding.DecodeString(parts[1])
+			assert.NoError(t, err)
+			assert.NoError(t, json.Unmarshal(rawClaims, &claims))
+			assert.Equal(t, "https://login/tenant/oauth2/v2.0/token", claims["aud"])
+			assert.Equal(t, "client", claims["iss"])
+			assert.Equal(t, "client", claims["sub"])
+			assert.NotEmpty(t, claims["jti"])
+			assert.Greater(t, claims["exp"].(float64), float64(time.Now().Unix()))
+
+			signature, err := base64.RawURLEncoding.DecodeString(parts[2])
+			assert.NoError(t, err)
+			digest := sha256.Sum256([]byte(parts[0] + "." + parts[1]))
+			assert.NoError(t, rsa.VerifyPKCS1v15(&key.PublicKey, crypto.SHA256, digest[:], signature))
+		})
+	}
+}
+
+func TestClientCredentials_Federated(t *testing.T) {
+	tokenFile := filepath.Join(t.TempDir(), "token")
+	assert.NoError(t, os.WriteFile(tokenFile, []byte("federated-token\n"), 0600))
+
+	values := url.Values{}
+	err := ClientCredentials{Method: ClientAuthFederated, ClientId: "client", FederatedTokenFile: tokenFile}.SetFormValues(values, "https://login/token")
+	assert.NoError(t, err)
+	assert.Equal(t, "federated-token", values.Get("client_assertion"))
+	assert.Equal(t, "urn:ietf:params:oauth:client-assertion-type:jwt-bearer", values.Get("client_assertion_type"))
+
+	// The token is read again on every request, as it's rotated.
+	assert.NoError(t, os.WriteFile(tokenFile, []byte("rotated-token"), 0600))
+	err = ClientCredentials{Method: ClientAuthFederated, ClientId: "client", FederatedTokenFile: tokenFile}.SetFormValues(values, "https://login/token")
+	assert.NoError(t, err)
+	assert.Equal(t, "rotated-token", values.Get("client_assertion"))
+
+	t.Setenv("AZURE_FEDERATED_TOKEN_FILE", tokenFile)
+	err = ClientCredentials{Method: ClientAuthFederated, ClientId: "client"}.SetFormValues(values, "https://login/token")
+	assert.NoError(t, err)
+	assert.Equal(t, "rotated-token", values.Get("client_assertion"))
+}
+
+func TestClientCredentials_Errors(t *testing.T) {
+	err := ClientCredentials{Method: "password"}.SetFormValues(url.Values{}, "https://login/token")
+	assert.Error(t, err)
+
+	err = ClientCredentials{Method: ClientAuthCertificate}.SetFormValues(url.Values{}, "https://login/token")
+	assert.Error(t, err)
+
+	t.Setenv("AZURE_FEDERATED_TOKEN_FILE", "")
+	err = ClientCredentials{Method: ClientAuthFederated}.SetFormValues(url.Values{}, "https://login/token")
+	assert.Error(t, err)
+}
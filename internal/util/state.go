@@ -0,0 +1,102 @@
+package util
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+// JsonStateFile persists state between job runs as JSON. Without a path the state is only kept in memory for the lifetime of the process.
+type JsonStateFile struct {
+	path   string
+	mu     sync.Mutex
+	memory []byte
+}
+
+func NewJsonStateFile(path string) *JsonStateFile {
+	return &JsonStateFile{path: path}
+}
+
+// Load reads the stored state into v. It returns false if no state has been stored yet.
+func (s *JsonStateFile) Load(v interface{}) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	data := s.memory
+	if s.path != "" {
+		var err error
+		data, err = os.ReadFile(s.path)
+		if err != nil {
+			if errors.Is(err, os.ErrNotExist) {
+				return false, nil
+			}
+			return false, err
+		}
+	}
+
+	if data == nil {
+		return false, nil
+	}
+
+	err := json.Unmarshal(data, v)
+	if err != nil {
+		return false, err
+	}
+
+	return true, nil
+}
+
+// Save stores v. Files are replaced atomically, so a crash while saving doesn't leave a partially written state behind.
+func (s *JsonStateFile) Save(v interface{}) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	data, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+
+	if s.path == "" {
+		s.memory = data
+		return nil
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(s.path), filepath.Base(s.path)+".*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	_, err = tmp.Write(data)
+	if err != nil {
+		tmp.Close()
+		return err
+	}
+
+	err = tmp.Close()
+	if err != nil {
+		return err
+	}
+
+	return os.Rename(tmp.Name(), s.path)
+}
+
+// Clear removes the stored state.
+func (s *JsonStateFile) Clear() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.memory = nil
+	if s.path == "" {
+		return nil
+	}
+
+	err := os.Remove(s.path)
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+
+	return nil
+}
@@ -0,0 +1,44 @@
+package util
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type testState struct {
+	Token string `json:"token"`
+}
+
+func TestJsonStateFile(t *testing.T) {
+	for _, path := range []string{"", filepath.Join(t.TempDir(), "state.json")} {
+		s := NewJsonStateFile(path)
+
+		var state testState
+		found, err := s.Load(&state)
+		assert.NoError(t, err)
+		assert.False(t, found)
+
+		err = s.Save(testState{Token: "dummy"})
+		assert.NoError(t, err)
+
+		found, err = NewJsonStateFile(path).Load(&state)
+		assert.NoError(t, err)
+		if path != "" {
+			assert.True(t, found)
+			assert.Equal(t, "dummy", state.Token)
+		}
+
+		found, err = s.Load(&state)
+		assert.NoError(t, err)
+		assert.True(t, found)
+		assert.Equal(t, "dummy", state.Token)
+
+		err = s.Clear()
+		assert.NoError(t, err)
+		found, err = s.Load(&state)
+		assert.NoError(t, err)
+		assert.False(t, found)
+	}
+}